@@ -0,0 +1,185 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"encoding/json"
+	"errors"
+	"time"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// BatchEncryptResult is one element of the JSON array written by EncryptBatchToJson and ReencryptBatch.
+type BatchEncryptResult struct {
+	Result        int32                        `json:"Result"`
+	DataRowRecord *appencryption.DataRowRecord `json:"DataRowRecord,omitempty"`
+}
+
+// BatchDecryptResult is one element of the JSON array written by DecryptBatchFromJson.
+type BatchDecryptResult struct {
+	Result int32  `json:"Result"`
+	Data   []byte `json:"Data,omitempty"`
+}
+
+/*
+  EncryptBatchToJson encrypts a JSON array of base64 encoded payloads for a single partition
+  using one session, and writes a JSON array of BatchEncryptResult in the same order.
+  A failing item does not fail the batch; check the Result of every element.
+*/
+//export EncryptBatchToJson
+func EncryptBatchToJson(partitionIdPtr unsafe.Pointer, dataJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptBatchToJson: Panic: %v", r)
+		}
+	}()
+
+	return encryptBatchToJson("EncryptBatchToJson", asherah.DefaultInstance, partitionIdPtr, dataJsonPtr, outputJsonPtr)
+}
+
+//export EncryptBatchToJsonWithInstance
+func EncryptBatchToJsonWithInstance(handle int64, partitionIdPtr unsafe.Pointer, dataJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptBatchToJsonWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return encryptBatchToJson("EncryptBatchToJsonWithInstance", handle, partitionIdPtr, dataJsonPtr, outputJsonPtr)
+}
+
+/*
+  DecryptBatchFromJson decrypts a JSON array of DataRowRecords for a single partition using
+  one session, and writes a JSON array of BatchDecryptResult in the same order.
+  A failing item does not fail the batch; check the Result of every element.
+*/
+//export DecryptBatchFromJson
+func DecryptBatchFromJson(partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptBatchFromJson: Panic: %v", r)
+		}
+	}()
+
+	return decryptBatchFromJson("DecryptBatchFromJson", asherah.DefaultInstance, partitionIdPtr, drrJsonPtr, outputJsonPtr)
+}
+
+//export DecryptBatchFromJsonWithInstance
+func DecryptBatchFromJsonWithInstance(handle int64, partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptBatchFromJsonWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return decryptBatchFromJson("DecryptBatchFromJsonWithInstance", handle, partitionIdPtr, drrJsonPtr, outputJsonPtr)
+}
+
+func encryptBatchToJson(caller string, handle int64, partitionIdPtr unsafe.Pointer, dataJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	start := time.Now()
+
+	var partitionId string
+	partitionId, result = cobhan.BufferToString(partitionIdPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert partitionIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var data [][]byte
+	result = cobhan.BufferToJsonStruct(dataJsonPtr, &data)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert dataJsonPtr cobhan buffer to JSON array %v", cobhan.CobhanErrorToString(result))
+	}
+
+	drrs, errs, err := asherah.EncryptBatchWithInstance(handle, partitionId, data)
+	if err != nil {
+		return reportError(batchErrorResult(err), caller+" failed: EncryptBatchWithInstance returned %v", err)
+	}
+
+	results := make([]BatchEncryptResult, len(drrs))
+	for n := range drrs {
+		if errs[n] != nil {
+			log.ErrorLogf(caller+": item %v failed: %v", n, errs[n])
+			results[n].Result = itemErrorResult(errs[n], ERR_ENCRYPT_FAILED)
+		} else {
+			results[n].DataRowRecord = drrs[n]
+		}
+		logOperation("encrypt", partitionId, start, results[n].Result)
+	}
+
+	return batchResultsToBuffer(caller, results, outputJsonPtr)
+}
+
+func decryptBatchFromJson(caller string, handle int64, partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	start := time.Now()
+
+	var partitionId string
+	partitionId, result = cobhan.BufferToString(partitionIdPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert partitionIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var drrs []appencryption.DataRowRecord
+	result = cobhan.BufferToJsonStruct(drrJsonPtr, &drrs)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert drrJsonPtr cobhan buffer to JSON array %v", cobhan.CobhanErrorToString(result))
+	}
+
+	data, errs, err := asherah.DecryptBatchWithInstance(handle, partitionId, drrs)
+	if err != nil {
+		return reportError(batchErrorResult(err), caller+" failed: DecryptBatchWithInstance returned %v", err)
+	}
+
+	results := make([]BatchDecryptResult, len(data))
+	for n := range data {
+		if errs[n] != nil {
+			log.ErrorLogf(caller+": item %v failed: %v", n, errs[n])
+			results[n].Result = itemErrorResult(errs[n], ERR_DECRYPT_FAILED)
+		} else {
+			results[n].Data = data[n]
+		}
+		logOperation("decrypt", partitionId, start, results[n].Result)
+	}
+
+	return batchResultsToBuffer(caller, results, outputJsonPtr)
+}
+
+func batchErrorResult(err error) int32 {
+	switch err {
+	case asherah.ErrAsherahNotInitialized:
+		return ERR_NOT_INITIALIZED
+	case asherah.ErrInstanceNotFound:
+		return ERR_INVALID_INSTANCE
+	default:
+		return ERR_GET_SESSION_FAILED
+	}
+}
+
+func itemErrorResult(err error, defaultResult int32) int32 {
+	if errors.Is(err, asherah.ErrAsherahTimeout) {
+		return ERR_TIMEOUT
+	}
+
+	return defaultResult
+}
+
+func batchResultsToBuffer(caller string, results interface{}, outputJsonPtr unsafe.Pointer) int32 {
+	result := cobhan.JsonToBuffer(results, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		if result == cobhan.ERR_BUFFER_TOO_SMALL {
+			outputBytes, err := json.Marshal(results)
+			if err == nil {
+				return reportError(result, caller+" failed: JsonToBuffer: Output buffer needed %v bytes", len(outputBytes))
+			}
+		}
+		return reportError(result, caller+" failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
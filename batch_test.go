@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestEncryptBatchToJsonAndDecryptBatchFromJsonCycle(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	inputs := [][]byte{[]byte("First"), []byte("Second"), []byte("Third")}
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	inputBuf := testAllocateJsonBuffer(t, inputs)
+	encryptedBuf := cobhan.AllocateBuffer(len(inputs) * EstimateBufferInt(16, len("Partition")))
+
+	result := EncryptBatchToJson(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&inputBuf), cobhan.Ptr(&encryptedBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptBatchToJson returned %v", result)
+	}
+
+	var encrypted []BatchEncryptResult
+	result = cobhan.BufferToJsonStruct(cobhan.Ptr(&encryptedBuf), &encrypted)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	if len(encrypted) != len(inputs) {
+		t.Fatalf("Expected %v results got %v", len(inputs), len(encrypted))
+	}
+
+	drrs := make([]interface{}, len(encrypted))
+	for n, item := range encrypted {
+		if item.Result != cobhan.ERR_NONE || item.DataRowRecord == nil {
+			t.Fatalf("Item %v returned %v", n, item.Result)
+		}
+		drrs[n] = item.DataRowRecord
+	}
+	// A corrupt record must not fail the rest of the batch
+	drrs = append(drrs, json.RawMessage(`{"Key":{"Created":1,"Key":"AAAA","ParentKeyMeta":{"KeyId":"x","Created":1}},"Data":"AAAA"}`))
+
+	drrBuf := testAllocateJsonBuffer(t, drrs)
+	decryptedBuf := cobhan.AllocateBuffer(len(drrBuf))
+
+	result = DecryptBatchFromJson(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&drrBuf), cobhan.Ptr(&decryptedBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptBatchFromJson returned %v", result)
+	}
+
+	var decrypted []BatchDecryptResult
+	result = cobhan.BufferToJsonStruct(cobhan.Ptr(&decryptedBuf), &decrypted)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	if len(decrypted) != len(inputs)+1 {
+		t.Fatalf("Expected %v results got %v", len(inputs)+1, len(decrypted))
+	}
+
+	for n, input := range inputs {
+		if decrypted[n].Result != cobhan.ERR_NONE {
+			t.Errorf("Item %v returned %v", n, decrypted[n].Result)
+		}
+		if string(decrypted[n].Data) != string(input) {
+			t.Errorf("Item %v decrypted to %v expected %v", n, string(decrypted[n].Data), string(input))
+		}
+	}
+
+	if decrypted[len(inputs)].Result != ERR_DECRYPT_FAILED {
+		t.Errorf("Expected corrupt item to return ERR_DECRYPT_FAILED got %v", decrypted[len(inputs)].Result)
+	}
+}
+
+func TestEncryptBatchToJsonWithoutInit(t *testing.T) {
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	inputBuf := testAllocateJsonBuffer(t, [][]byte{[]byte("First")})
+	encryptedBuf := cobhan.AllocateBuffer(256)
+
+	result := EncryptBatchToJson(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&inputBuf), cobhan.Ptr(&encryptedBuf))
+	if result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected EncryptBatchToJson to return ERR_NOT_INITIALIZED got %v", result)
+	}
+}
@@ -0,0 +1,89 @@
+// Command asherah-migrate copies the system and intermediate keys of one Asherah metastore to
+// another, for example when moving from rdbms to dynamodb:
+//
+//	asherah-migrate -source mysql.yaml -destination dynamodb.yaml -verify
+//
+// Each configuration file uses the SetupFromFile format; only its metastore fields are read, and
+// the memory metastore is rejected because it holds no keys outside the process. Progress is
+// written to stderr and the final MigrationReport to stdout as JSON. Keys already in the
+// destination are left unchanged, so the command can be run again after an interruption. It exits
+// with status 1 on failure and 2 if keys conflict or fail verification.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses the command line in args, migrates the keys and returns the exit status. The report
+// is written to stdout; usage, progress and errors go to stderr.
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("asherah-migrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	sourcePath := flags.String("source", "", "configuration file of the metastore to copy keys from")
+	destinationPath := flags.String("destination", "", "configuration file of the metastore to copy keys to")
+	dryRun := flags.Bool("dry-run", false, "report what would be copied without writing")
+	verify := flags.Bool("verify", false, "check every source key in the destination after copying")
+	batchSize := flags.Int("batch-size", 0, "keys read at a time (default 100)")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	if *sourcePath == "" || *destinationPath == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 1
+	}
+
+	migration := &asherah.Migration{DryRun: *dryRun, Verify: *verify, BatchSize: *batchSize}
+	if err := migration.Source.LoadFile(*sourcePath); err != nil {
+		fmt.Fprintf(stderr, "asherah-migrate: %s: %v\n", *sourcePath, err)
+		return 1
+	}
+	if err := migration.Destination.LoadFile(*destinationPath); err != nil {
+		fmt.Fprintf(stderr, "asherah-migrate: %s: %v\n", *destinationPath, err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := asherah.MigrateKeys(ctx, migration, func(progress asherah.MigrationReport) {
+		fmt.Fprintf(stderr, "scanned %d, copied %d, unchanged %d, revoked %d, conflicts %d, verified %d, mismatches %d\n",
+			progress.Scanned, progress.Copied, progress.Unchanged, progress.Revoked, len(progress.Conflicts),
+			progress.Verified, len(progress.Mismatches))
+	})
+	if report != nil {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "asherah-migrate: %v\n", err)
+		return 1
+	}
+
+	return exitStatus(report)
+}
+
+// exitStatus returns 2 if report lists keys that conflict or failed verification, and 0 otherwise.
+func exitStatus(report *asherah.MigrationReport) int {
+	if len(report.Conflicts) > 0 || len(report.Mismatches) > 0 {
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+func writeConfigForTesting(t *testing.T, name string, config string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile returned %v", err)
+	}
+	return path
+}
+
+func TestRunMigratesKeys(t *testing.T) {
+	// The source is a sqlmock connection pool, opened by the rdbms metastore through the driver
+	// sqlmock registers under its own name.
+	_, mock, err := sqlmock.NewWithDSN("asherah-migrate-source", sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.NewWithDSN returned %v", err)
+	}
+	for range 2 {
+		mock.ExpectQuery("SELECT id, key_record FROM encryption_key ORDER BY id, created LIMIT ?").WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "key_record"}).AddRow("_SK_s_p", `{"Created":1700000000,"Key":"a2V5"}`))
+	}
+
+	source := writeConfigForTesting(t, "source.yaml", "Metastore: rdbms\nSQLMetastoreDBType: sqlmock\nConnectionString: asherah-migrate-source\n")
+	destination := writeConfigForTesting(t, "destination.json", `{"Metastore":"test-debug-memory"}`)
+
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"-source", source, "-destination", destination, "-verify", "-batch-size", "10"}, &stdout, &stderr); status != 0 {
+		t.Fatalf("Expected status 0 got %v: %s", status, stderr.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	var report asherah.MigrationReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Unmarshal returned %v for %q", err, stdout.String())
+	}
+	if report.DryRun || report.Scanned != 1 || report.Copied != 1 || report.Verified != 1 || len(report.Mismatches) != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if !strings.Contains(stderr.String(), "scanned 1, copied 1") {
+		t.Errorf("Expected progress on stderr got %q", stderr.String())
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	source := writeConfigForTesting(t, "source.yaml", "Metastore: test-debug-memory\n")
+	destination := writeConfigForTesting(t, "destination.json", `{"Metastore":"test-debug-memory"}`)
+
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"-source", source, "-destination", destination, "-dry-run", "-verify"}, &stdout, &stderr); status != 0 {
+		t.Fatalf("Expected status 0 got %v: %s", status, stderr.String())
+	}
+
+	var report asherah.MigrationReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Unmarshal returned %v for %q", err, stdout.String())
+	}
+	if !report.DryRun || report.Scanned != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestRunRejectsBadArguments(t *testing.T) {
+	memory := writeConfigForTesting(t, "memory.yaml", "Metastore: memory\n")
+	valid := writeConfigForTesting(t, "valid.yaml", "Metastore: test-debug-memory\n")
+
+	for _, test := range []struct {
+		args   []string
+		status int
+		stderr string
+	}{
+		{[]string{"-h"}, 0, "-source"},
+		{[]string{}, 1, "-destination"},
+		{[]string{"-source", valid}, 1, "-destination"},
+		{[]string{"-source", valid, "-destination", valid, "extra"}, 1, "-source"},
+		{[]string{"-batch-size", "many"}, 1, "invalid value"},
+		{[]string{"-unknown"}, 1, "not defined"},
+		{[]string{"-source", filepath.Join(t.TempDir(), "missing.yaml"), "-destination", valid}, 1, "missing.yaml"},
+		{[]string{"-source", memory, "-destination", valid}, 1, "Source.Metastore"},
+		{[]string{"-source", valid, "-destination", memory}, 1, "Destination.Metastore"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if status := run(test.args, &stdout, &stderr); status != test.status || !strings.Contains(stderr.String(), test.stderr) {
+			t.Errorf("%q: expected status %v and %q on stderr got %v and %q", test.args, test.status, test.stderr, status, stderr.String())
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	key := appencryption.KeyMeta{ID: "_IK_a_s_p", Created: 1700000060}
+	for _, test := range []struct {
+		report asherah.MigrationReport
+		status int
+	}{
+		{asherah.MigrationReport{Copied: 3, Verified: 3}, 0},
+		{asherah.MigrationReport{Conflicts: []appencryption.KeyMeta{key}}, 2},
+		{asherah.MigrationReport{Mismatches: []appencryption.KeyMeta{key}}, 2},
+	} {
+		if status := exitStatus(&test.report); status != test.status {
+			t.Errorf("%+v: expected %v got %v", test.report, test.status, status)
+		}
+	}
+}
+
+// TestMainExitCode runs main in a child process, since it exits, and checks the status it exits with.
+// The child's arguments are passed newline-separated in ASHERAH_MIGRATE_TEST_ARGS.
+func TestMainExitCode(t *testing.T) {
+	if args, ok := os.LookupEnv("ASHERAH_MIGRATE_TEST_ARGS"); ok {
+		os.Args = []string{"asherah-migrate"}
+		if args != "" {
+			os.Args = append(os.Args, strings.Split(args, "\n")...)
+		}
+		main()
+		return
+	}
+
+	valid := writeConfigForTesting(t, "valid.yaml", "Metastore: test-debug-memory\n")
+	for args, expected := range map[string]int{
+		"": 1,
+		strings.Join([]string{"-source", valid, "-destination", valid}, "\n"): 0,
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestMainExitCode$")
+		cmd.Env = append(os.Environ(), "ASHERAH_MIGRATE_TEST_ARGS="+args)
+		err := cmd.Run()
+
+		status := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			status = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatalf("Run returned %v", err)
+		}
+		if status != expected {
+			t.Errorf("%q: expected exit status %v got %v", args, expected, status)
+		}
+	}
+}
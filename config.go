@@ -0,0 +1,66 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+// ConfigResult is written by GetConfigJson.
+type ConfigResult struct {
+	Options *asherah.Options `json:"Options"`
+	Build   BuildInfo        `json:"Build"`
+}
+
+/*
+  GetConfigJson writes the options in effect for the default instance, including the defaults
+  filled in by SetupJson, together with the library version, Go version and build details. Any
+  password in ConnectionString, DynamoDBEndpoint or TracingEndpoint is replaced by ***.
+  Durations are written as duration strings ("2h0m0s"), so the Options object is itself a
+  valid SetupJson configuration.
+*/
+//export GetConfigJson
+func GetConfigJson(outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "GetConfigJson: Panic: %v", r)
+		}
+	}()
+
+	return getConfigJson("GetConfigJson", asherah.DefaultInstance, outputJsonPtr)
+}
+
+//export GetConfigJsonWithInstance
+func GetConfigJsonWithInstance(handle int64, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "GetConfigJsonWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return getConfigJson("GetConfigJsonWithInstance", handle, outputJsonPtr)
+}
+
+func getConfigJson(caller string, handle int64, outputJsonPtr unsafe.Pointer) (result int32) {
+	options, err := asherah.GetOptions(handle)
+	if err != nil {
+		return reportError(instanceErrorResult(err), caller+" failed: GetOptions returned %v", err)
+	}
+
+	config := ConfigResult{
+		Options: options.Redacted(),
+		Build:   buildInfo(),
+	}
+
+	result = cobhan.JsonToBuffer(&config, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
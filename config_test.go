@@ -0,0 +1,72 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestGetConfigJson(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	buf := cobhan.AllocateBuffer(8192)
+	if result := GetConfigJson(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("GetConfigJson returned %v", result)
+	}
+
+	var config ConfigResult
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&buf), &config); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	if config.Options == nil || config.Options.ServiceName != "TestService" || config.Options.SessionCacheMaxSize != 2 {
+		t.Errorf("Unexpected options %+v", config.Options)
+	}
+	if config.Build.GoVersion != runtime.Version() || config.Build.Version == "" {
+		t.Errorf("Unexpected build info %+v", config.Build)
+	}
+}
+
+func TestGetConfigJsonRedactsConnectionString(t *testing.T) {
+	config := &asherah.Options{}
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "memory"
+	config.ConnectionString = "user:secret@tcp(localhost:3306)/db"
+
+	buf := testAllocateJsonBuffer(t, config)
+	handleBuf := cobhan.AllocateBuffer(8)
+	if result := CreateInstance(cobhan.Ptr(&buf), cobhan.Ptr(&handleBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("CreateInstance returned %v", result)
+	}
+	handle, _ := cobhan.BufferToInt64Safe(&handleBuf)
+	defer DestroyInstance(handle)
+
+	output := cobhan.AllocateBuffer(8192)
+	if result := GetConfigJsonWithInstance(handle, cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+		t.Fatalf("GetConfigJsonWithInstance returned %v", result)
+	}
+
+	var result ConfigResult
+	if code := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &result); code != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", code)
+	}
+
+	if result.Options.ConnectionString != "user:***@tcp(localhost:3306)/db" {
+		t.Errorf("Expected a redacted connection string got %q", result.Options.ConnectionString)
+	}
+	if result.Options.ExpireAfter == 0 || result.Options.CheckInterval == 0 {
+		t.Errorf("Expected defaults to be reported got %+v", result.Options)
+	}
+}
+
+func TestGetConfigJsonNotInitialized(t *testing.T) {
+	buf := cobhan.AllocateBuffer(8192)
+	if result := GetConfigJson(cobhan.Ptr(&buf)); result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+	}
+}
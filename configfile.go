@@ -0,0 +1,45 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+/*
+  SetupFromFile initializes the library from a YAML (.yaml, .yml), TOML (.toml) or JSON (.json)
+  configuration file using the SetupJson field names. String values may reference environment
+  variables as ${NAME}, and a value of the form file:/path/to/secret is replaced by the contents
+  of that file, so secrets such as ConnectionString need not be written into the configuration.
+  An unreadable or malformed file fails with ERR_BAD_CONFIG; the last error names the line of a
+  syntax error.
+*/
+//export SetupFromFile
+func SetupFromFile(pathPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "SetupFromFile: Panic: %v", r)
+		}
+	}()
+
+	var path string
+	path, result = cobhan.BufferToString(pathPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "SetupFromFile failed: Failed to convert pathPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	options, err := asherah.OptionsFromFile(path)
+	if err != nil {
+		return reportError(ERR_BAD_CONFIG, "SetupFromFile failed: %v", err)
+	}
+
+	log.DebugLogf("Successfully read config from %v", path)
+
+	return setup("SetupFromFile", options)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestSetupFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asherah.yaml")
+	config := "ServiceName: TestService\nProductID: TestProduct\nMetastore: ${TEST_METASTORE}\nKMS: static\nExpireAfter: 90d\n"
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile returned %v", err)
+	}
+	t.Setenv("TEST_METASTORE", "memory")
+
+	buf := testAllocateStringBuffer(t, path)
+	if result := SetupFromFile(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupFromFile returned %v", result)
+	}
+	defer Shutdown()
+
+	if report := testHealthCheck(t); !report.Healthy {
+		t.Errorf("Expected a healthy report got %+v", report)
+	}
+}
+
+func TestSetupFromFileSyntaxError(t *testing.T) {
+	lockThreadForTesting(t)
+
+	path := filepath.Join(t.TempDir(), "asherah.toml")
+	if err := os.WriteFile(path, []byte("ServiceName = \"TestService\"\nProductID =\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned %v", err)
+	}
+
+	buf := testAllocateStringBuffer(t, path)
+	if result := SetupFromFile(cobhan.Ptr(&buf)); result != ERR_BAD_CONFIG {
+		Shutdown()
+		t.Fatalf("Expected ERR_BAD_CONFIG got %v", result)
+	}
+
+	if detail := testGetLastError(t); detail.Code != ERR_BAD_CONFIG {
+		t.Errorf("Expected last error ERR_BAD_CONFIG got %+v", detail)
+	}
+}
@@ -7,6 +7,17 @@ const ERR_ENCRYPT_FAILED = -103
 const ERR_DECRYPT_FAILED = -104
 const ERR_BAD_CONFIG = -105
 const ERR_PANIC = -106
+const ERR_INVALID_INSTANCE = -107
+const ERR_INVALID_STREAM = -108
+const ERR_STREAM_TRUNCATED = -109
+const ERR_TIMEOUT = -110
+const ERR_UNKNOWN_METASTORE = -111
+const ERR_METASTORE_FAILED = -112
+const ERR_REPLICA_READ_CONSISTENCY = -113
+const ERR_KMS_FAILED = -114
+const ERR_METRICS_FAILED = -115
+const ERR_KEY_ROTATION_FAILED = -116
+const ERR_KEY_NOT_FOUND = -117
 
 const EstimatedEncryptionOverhead = 48
 const EstimatedEnvelopeOverhead = 185
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+/*
+  SetupFromEnv initializes the library from the ASHERAH_* environment variables listed on the
+  Options fields, e.g. ASHERAH_SERVICE_NAME, ASHERAH_EXPIRE_AFTER=90m, ASHERAH_VERBOSE=true and
+  ASHERAH_REGION_MAP=us-west-2=arn:...,us-east-1=arn:... A variable that cannot be parsed fails
+  with ERR_BAD_CONFIG.
+*/
+//export SetupFromEnv
+func SetupFromEnv() (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "SetupFromEnv: Panic: %v", r)
+		}
+	}()
+
+	options, err := asherah.OptionsFromEnv()
+	if err != nil {
+		return reportError(ERR_BAD_CONFIG, "SetupFromEnv failed: %v", err)
+	}
+
+	log.DebugLog("Successfully read config from environment")
+
+	return setup("SetupFromEnv", options)
+}
+
+/*
+  SetupFromEnvAndJson initializes the library from the ASHERAH_* environment variables, as
+  SetupFromEnv does, with any field present in configJson taking precedence.
+*/
+//export SetupFromEnvAndJson
+func SetupFromEnvAndJson(configJson unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "SetupFromEnvAndJson: Panic: %v", r)
+		}
+	}()
+
+	options, err := asherah.OptionsFromEnv()
+	if err != nil {
+		return reportError(ERR_BAD_CONFIG, "SetupFromEnvAndJson failed: %v", err)
+	}
+
+	options, result = mergeOptionsJson(configJson, options)
+	if result != cobhan.ERR_NONE {
+		return result
+	}
+
+	log.DebugLog("Successfully merged config JSON over environment")
+
+	return setup("SetupFromEnvAndJson", options)
+}
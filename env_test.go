@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+func setEnvForTesting(t *testing.T) {
+	t.Setenv("ASHERAH_SERVICE_NAME", "TestService")
+	t.Setenv("ASHERAH_PRODUCT_NAME", "TestProduct")
+	t.Setenv("ASHERAH_METASTORE_MODE", "memory")
+	t.Setenv("ASHERAH_KMS_MODE", "static")
+	t.Setenv("ASHERAH_ENABLE_SESSION_CACHING", "true")
+	t.Setenv("ASHERAH_SESSION_CACHE_DURATION", "1m")
+}
+
+func TestSetupFromEnv(t *testing.T) {
+	setEnvForTesting(t)
+
+	if result := SetupFromEnv(); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupFromEnv returned %v", result)
+	}
+	defer Shutdown()
+
+	if report := testHealthCheck(t); !report.Healthy {
+		t.Errorf("Expected a healthy report got %+v", report)
+	}
+}
+
+func TestSetupFromEnvBadValue(t *testing.T) {
+	setEnvForTesting(t)
+	t.Setenv("ASHERAH_EXPIRE_AFTER", "ninety days")
+
+	if result := SetupFromEnv(); result != ERR_BAD_CONFIG {
+		Shutdown()
+		t.Fatalf("Expected ERR_BAD_CONFIG got %v", result)
+	}
+}
+
+func TestSetupFromEnvAndJsonOverridesEnv(t *testing.T) {
+	setEnvForTesting(t)
+	t.Setenv("ASHERAH_METASTORE_MODE", "dynamodb")
+
+	config := testAllocateStringBuffer(t, `{"Metastore":"memory"}`)
+	if result := SetupFromEnvAndJson(cobhan.Ptr(&config)); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupFromEnvAndJson returned %v", result)
+	}
+	defer Shutdown()
+
+	if report := testHealthCheck(t); !report.Healthy {
+		t.Errorf("Expected a healthy report got %+v", report)
+	}
+}
+
+func TestSetupFromEnvAndJsonReplacesRegionMap(t *testing.T) {
+	setEnvForTesting(t)
+	t.Setenv("ASHERAH_REGION_MAP", "us-west-2=arn:aws:kms:us-west-2:111122223333:key/1")
+
+	config := testAllocateStringBuffer(t, `{"RegionMap":{"us-east-1":"arn:aws:kms:us-east-1:111122223333:key/2"}}`)
+	if result := SetupFromEnvAndJson(cobhan.Ptr(&config)); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupFromEnvAndJson returned %v", result)
+	}
+	defer Shutdown()
+
+	options, err := asherah.GetOptions(asherah.DefaultInstance)
+	if err != nil {
+		t.Fatalf("GetOptions returned %v", err)
+	}
+	if len(options.RegionMap) != 1 || options.RegionMap["us-east-1"] == "" {
+		t.Errorf("Expected the JSON RegionMap to replace the environment one got %v", options.RegionMap)
+	}
+}
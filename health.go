@@ -0,0 +1,55 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+/*
+  HealthCheck probes the configured metastore (a ping of the SQL connection, or a read of the
+  system key from DynamoDB) and performs a KMS round-trip on a random canary key, then writes
+  the per-component status and latency as JSON. The result is ERR_NONE whenever the report is
+  written; check Healthy in the report. An uninitialized library is reported with
+  Initialized false rather than ERR_NOT_INITIALIZED.
+*/
+//export HealthCheck
+func HealthCheck(outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "HealthCheck: Panic: %v", r)
+		}
+	}()
+
+	return healthCheck("HealthCheck", asherah.DefaultInstance, outputJsonPtr)
+}
+
+//export HealthCheckWithInstance
+func HealthCheckWithInstance(handle int64, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "HealthCheckWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return healthCheck("HealthCheckWithInstance", handle, outputJsonPtr)
+}
+
+func healthCheck(caller string, handle int64, outputJsonPtr unsafe.Pointer) (result int32) {
+	report, err := asherah.HealthCheck(handle)
+	if err != nil {
+		return reportError(ERR_INVALID_INSTANCE, caller+" failed: HealthCheck returned %v", err)
+	}
+
+	result = cobhan.JsonToBuffer(report, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
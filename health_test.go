@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/cobhan-go"
+)
+
+func testHealthCheck(t *testing.T) asherah.HealthReport {
+	buf := cobhan.AllocateBuffer(4096)
+	if result := HealthCheck(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("HealthCheck returned %v", result)
+	}
+
+	var report asherah.HealthReport
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&buf), &report); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	return report
+}
+
+func TestHealthCheckHealthy(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	report := testHealthCheck(t)
+	if !report.Healthy || !report.Initialized {
+		t.Errorf("Expected a healthy report got %+v", report)
+	}
+
+	for _, name := range []string{"metastore", "kms"} {
+		if report.Components[name].Status != asherah.HealthStatusOK {
+			t.Errorf("Expected %v ok got %+v", name, report.Components[name])
+		}
+	}
+}
+
+func TestHealthCheckNotInitialized(t *testing.T) {
+	report := testHealthCheck(t)
+	if report.Healthy || report.Initialized {
+		t.Errorf("Expected an uninitialized report got %+v", report)
+	}
+}
+
+func TestHealthCheckUnreachableDatabase(t *testing.T) {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "rdbms"
+	config.ConnectionString = "user:password@tcp(127.0.0.1:1)/db?timeout=1s"
+	config.OperationTimeout = 2 * time.Second
+	config.Verbose = Verbose
+
+	buf := testAllocateJsonBuffer(t, config)
+	if result := SetupJson(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupJson returned %v", result)
+	}
+	defer Shutdown()
+
+	report := testHealthCheck(t)
+	if report.Healthy || report.Components["metastore"].Status != asherah.HealthStatusError {
+		t.Errorf("Expected metastore error got %+v", report)
+	}
+	if report.Components["kms"].Status != asherah.HealthStatusOK {
+		t.Errorf("Expected kms ok got %+v", report.Components["kms"])
+	}
+}
+
+func TestHealthCheckWithInvalidInstance(t *testing.T) {
+	buf := cobhan.AllocateBuffer(4096)
+	if result := HealthCheckWithInstance(-1, cobhan.Ptr(&buf)); result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected ERR_INVALID_INSTANCE got %v", result)
+	}
+}
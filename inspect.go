@@ -0,0 +1,64 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"context"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+/*
+  InspectDataRowRecord reports the keys behind a DataRowRecord produced by EncryptToJson without
+  decrypting it: the intermediate key ID and created time, its parent system key, whether each
+  key exists in the metastore and whether it is expired under ExpireAfter or revoked, the
+  partition the intermediate key belongs to, and the ciphertext size. Problems in the report
+  lists every reason the record could not be decrypted. A metastore failure returns
+  ERR_METASTORE_FAILED.
+*/
+//export InspectDataRowRecord
+func InspectDataRowRecord(drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "InspectDataRowRecord: Panic: %v", r)
+		}
+	}()
+
+	return inspectDataRowRecord("InspectDataRowRecord", asherah.DefaultInstance, drrJsonPtr, outputJsonPtr)
+}
+
+//export InspectDataRowRecordWithInstance
+func InspectDataRowRecordWithInstance(handle int64, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "InspectDataRowRecordWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return inspectDataRowRecord("InspectDataRowRecordWithInstance", handle, drrJsonPtr, outputJsonPtr)
+}
+
+func inspectDataRowRecord(caller string, handle int64, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) int32 {
+	var drr appencryption.DataRowRecord
+	result := cobhan.BufferToJsonStruct(drrJsonPtr, &drr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert drrJsonPtr cobhan buffer to JSON %v", cobhan.CobhanErrorToString(result))
+	}
+
+	report, err := asherah.InspectDataRowRecord(context.Background(), handle, &drr)
+	if err != nil {
+		return reportError(keyErrorResult(err, ERR_METASTORE_FAILED), caller+" failed: InspectDataRowRecord returned %v", err)
+	}
+
+	result = cobhan.JsonToBuffer(report, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestInspectDataRowRecord(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partition := testAllocateStringBuffer(t, "Partition")
+	encrypted := testEncryptToJson(t, partition, "InputString")
+
+	output := cobhan.AllocateBuffer(4096)
+	if result := InspectDataRowRecord(cobhan.Ptr(&encrypted), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+		t.Fatalf("InspectDataRowRecord returned %v", result)
+	}
+
+	var report asherah.DataRowRecordReport
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &report); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	if report.Partition != "Partition" || report.IntermediateKey == nil || !report.IntermediateKey.Exists || report.SystemKey == nil || !report.SystemKey.Exists {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.CiphertextSize == 0 || len(report.Problems) != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestInspectDataRowRecordNotInitialized(t *testing.T) {
+	drr := testAllocateStringBuffer(t, `{"Key":{"Created":1,"Key":"AAAA","ParentKeyMeta":{"KeyId":"x","Created":1}},"Data":"AAAA"}`)
+	output := cobhan.AllocateBuffer(4096)
+
+	if result := InspectDataRowRecord(cobhan.Ptr(&drr), cobhan.Ptr(&output)); result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+	}
+	if result := InspectDataRowRecordWithInstance(-1, cobhan.Ptr(&drr), cobhan.Ptr(&output)); result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected ERR_INVALID_INSTANCE got %v", result)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,141 +15,98 @@ import (
 	"github.com/godaddy/asherah/go/appencryption/pkg/kms"
 	asherahLog "github.com/godaddy/asherah/go/appencryption/pkg/log"
 	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
-	"github.com/godaddy/asherah/go/securememory/memguard"
 )
 
-var globalSessionFactory *appencryption.SessionFactory
+var globalInstance atomic.Pointer[Instance]
 var globalInitialized int32 = 0
 
+// globalLock serializes Setup and Shutdown so the initialized flag and the instance change together.
+var globalLock sync.Mutex
+
 var ErrAsherahAlreadyInitialized = errors.New("asherah already initialized")
 var ErrAsherahNotInitialized = errors.New("asherah not initialized")
 var ErrAsherahFailedInitialization = errors.New("asherah failed initialization")
+var ErrUnknownMetastore = errors.New("unknown metastore type")
+var ErrMetastoreFailed = errors.New("failed to create metastore")
+var ErrReplicaReadConsistency = errors.New("invalid replica read consistency")
+var ErrKMSFailed = errors.New("failed to create KMS")
+var ErrMetricsListenFailed = errors.New("failed to start metrics listener")
+
+// asherahLogger forwards the Asherah library's debug output to the asherah-cobhan log, which drops
+// it unless the current level is debug. It is installed once, so later Verbose and LogLevel
+// changes apply to the library's output too.
+type asherahLogger struct{}
+
+func init() {
+	asherahLog.SetLogger(asherahLogger{})
+}
 
-type logFunc func(format string, v ...interface{})
-
-func (f logFunc) Debugf(format string, v ...interface{}) {
-	f(format, v...)
+func (asherahLogger) Debugf(format string, v ...interface{}) {
+	log.Logf(log.LevelDebug, log.ComponentAsherah, format, v...)
 }
 
 func Setup(options *Options) error {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
 	if !atomic.CompareAndSwapInt32(&globalInitialized, 0, 1) {
 		log.ErrorLog("Failed to initialize asherah: already initialized")
 		return ErrAsherahAlreadyInitialized
 	}
 
-	if options.Verbose && log.DebugLogf != nil {
-		asherahLog.SetLogger(logFunc(log.DebugLogf))
-	}
-
-	crypto := aead.NewAES256GCM()
-
-	if options.SessionCacheMaxSize == 0 {
-		options.SessionCacheMaxSize = appencryption.DefaultSessionCacheMaxSize
-	}
-
-	if options.SessionCacheDuration == 0 {
-		options.SessionCacheDuration = appencryption.DefaultSessionCacheDuration
-	}
-
-	if options.ExpireAfter == 0 {
-		options.ExpireAfter = appencryption.DefaultExpireAfter
-	}
-
-	if options.CheckInterval == 0 {
-		options.CheckInterval = appencryption.DefaultRevokedCheckInterval
-	}
+	// Roll back so a failed Setup can be retried, even if a dependency panics
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.StoreInt32(&globalInitialized, 0)
+			panic(r)
+		}
+	}()
 
-	globalSessionFactory = appencryption.NewSessionFactory(
-		&appencryption.Config{
-			Service: options.ServiceName,
-			Product: options.ProductID,
-			Policy:  NewCryptoPolicy(options),
-		},
-		NewMetastore(options),
-		NewKMS(options, crypto),
-		crypto,
-		appencryption.WithSecretFactory(new(memguard.SecretFactory)),
-		appencryption.WithMetrics(false),
-	)
-
-	if globalSessionFactory == nil {
-		log.ErrorLog("Failed to create session factory")
+	instance, err := newInstance(options)
+	if err != nil {
 		atomic.StoreInt32(&globalInitialized, 0)
-		return ErrAsherahFailedInitialization
+		return err
 	}
 
+	globalInstance.Store(instance)
+
 	return nil
 }
 
 func Shutdown() {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
 	if atomic.CompareAndSwapInt32(&globalInitialized, 1, 0) {
-		globalSessionFactory.Close()
-		globalSessionFactory = nil
-		closeConnection()
+		if instance := globalInstance.Swap(nil); instance != nil {
+			instance.Close()
+		}
 	}
 }
 
 func Encrypt(partitionId string, data []byte) (*appencryption.DataRowRecord, error) {
-	// Atomic read to prevent race with Shutdown()
-	if atomic.LoadInt32(&globalInitialized) == 0 {
-		log.ErrorLog("Failed to encrypt data: asherah is not initialized")
-		return nil, ErrAsherahNotInitialized
-	}
-
-	session, err := globalSessionFactory.GetSession(partitionId)
-	if err != nil {
-		log.ErrorLogf("Failed to get session for partition %v: %v", partitionId, err.Error())
-		return nil, err
-	}
-	defer session.Close()
-
-	ctx := context.Background()
-	return session.Encrypt(ctx, data)
+	return EncryptWithInstance(context.Background(), DefaultInstance, partitionId, data, 0)
 }
 
 func Decrypt(partitionId string, drr *appencryption.DataRowRecord) ([]byte, error) {
-	// Atomic read to prevent race with Shutdown()
-	if atomic.LoadInt32(&globalInitialized) == 0 {
-		log.ErrorLog("Failed to decrypt data: asherah is not initialized")
-		return nil, ErrAsherahNotInitialized
-	}
-
-	session, err := globalSessionFactory.GetSession(partitionId)
-	if err != nil {
-		log.ErrorLogf("Failed to get session for partition %v: %v", partitionId, err.Error())
-		return nil, err
-	}
-	defer session.Close()
-
-	ctx := context.Background()
-	return session.Decrypt(ctx, *drr)
+	return DecryptWithInstance(context.Background(), DefaultInstance, partitionId, drr, 0)
 }
 
-func NewMetastore(opts *Options) appencryption.Metastore {
+func NewMetastore(opts *Options) (appencryption.Metastore, error) {
 	switch opts.Metastore {
 	case "rdbms":
-		var dbType string
-		if len(opts.SQLMetastoreDBType) > 1 {
-			dbType = opts.SQLMetastoreDBType
-		} else {
-			dbType = "mysql"
+		dbType := sqlMetastoreDBType(opts)
+		db, err := newConnection(dbType, opts.ConnectionString, opts.ReplicaReadConsistency)
+		if errors.Is(err, ErrReplicaReadConsistency) {
+			log.ErrorLogf("Failed to set replica read consistency to '%s': %v", opts.ReplicaReadConsistency, err.Error())
+			return nil, fmt.Errorf("failed to set replica read consistency to '%s': %w", opts.ReplicaReadConsistency, err)
 		}
-		db, err := newConnection(dbType, opts.ConnectionString)
 		if err != nil {
-			log.ErrorLogf("PANIC: Failed to connect to %s database (connection: %s): %v", dbType, redactConnectionString(opts.ConnectionString), err.Error())
-			panic(fmt.Errorf("failed to connect to %s database: %w", dbType, err))
-		}
-
-		// set optional replica read consistency
-		if len(opts.ReplicaReadConsistency) > 0 {
-			err := setRdbmsReplicaReadConsistencyValue(opts.ReplicaReadConsistency)
-			if err != nil {
-				log.ErrorLogf("PANIC: Failed to set replica read consistency to '%s': %v", opts.ReplicaReadConsistency, err.Error())
-				panic(fmt.Errorf("failed to set replica read consistency to '%s': %w", opts.ReplicaReadConsistency, err))
-			}
+			log.ErrorLogf("Failed to connect to %s database (connection: %s): %v", dbType, redactConnectionString(opts.ConnectionString), err.Error())
+			return nil, fmt.Errorf("%w: failed to connect to %s database: %w", ErrMetastoreFailed, dbType, err)
 		}
 
-		return persistence.NewSQLMetastore(db, persistence.WithSQLMetastoreDBType(persistence.SQLMetastoreDBType(dbType)))
+		return persistence.NewSQLMetastore(db, persistence.WithSQLMetastoreDBType(persistence.SQLMetastoreDBType(dbType))), nil
 	case "dynamodb":
 		awsOpts := awssession.Options{
 			SharedConfigState: awssession.SharedConfigEnable,
@@ -162,52 +120,58 @@ func NewMetastore(opts *Options) appencryption.Metastore {
 			awsOpts.Config.Region = aws.String(opts.DynamoDBRegion)
 		}
 
+		sess, err := awssession.NewSessionWithOptions(awsOpts)
+		if err != nil {
+			log.ErrorLogf("Failed to create AWS session for DynamoDB metastore: %v", err.Error())
+			return nil, fmt.Errorf("%w: failed to create AWS session for DynamoDB: %w", ErrMetastoreFailed, err)
+		}
+
 		return persistence.NewDynamoDBMetastore(
-			awssession.Must(awssession.NewSessionWithOptions(awsOpts)),
+			sess,
 			persistence.WithDynamoDBRegionSuffix(opts.EnableRegionSuffix),
 			persistence.WithTableName(opts.DynamoDBTableName),
-		)
+		), nil
 	case "test-debug-memory":
 		// We don't warn if the user specifically asks for test-debug-memory
-		return persistence.NewMemoryMetastore()
+		return persistence.NewMemoryMetastore(), nil
 	case "memory":
 		log.ErrorLog("*** WARNING WARNING WARNING USING MEMORY METASTORE - THIS IS FOR TEST/DEBUG ONLY ***")
-		return persistence.NewMemoryMetastore()
+		return persistence.NewMemoryMetastore(), nil
 	default:
-		log.ErrorLogf("PANIC: Unknown metastore type: %v (valid options: rdbms, dynamodb, memory)", opts.Metastore)
-		panic(fmt.Errorf("unknown metastore type '%s' (valid options: rdbms, dynamodb, memory)", opts.Metastore))
+		log.ErrorLogf("Unknown metastore type: %v (valid options: rdbms, dynamodb, memory)", opts.Metastore)
+		return nil, fmt.Errorf("%w '%s' (valid options: rdbms, dynamodb, memory)", ErrUnknownMetastore, opts.Metastore)
 	}
 }
 
-func NewKMS(opts *Options, crypto appencryption.AEAD) appencryption.KeyManagementService {
+func NewKMS(opts *Options, crypto appencryption.AEAD) (appencryption.KeyManagementService, error) {
 	if opts.KMS == "static" {
 		log.ErrorLog("*** WARNING WARNING WARNING USING STATIC MASTER KEY - THIS IS FOR TEST/DEBUG ONLY ***")
 
 		m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", aead.NewAES256GCM())
 		if err != nil {
-			log.ErrorLogf("PANIC: Failed to create static master key for KMS type 'static': %v", err.Error())
-			panic(fmt.Errorf("failed to create static master key for KMS type 'static': %w", err))
+			log.ErrorLogf("Failed to create static master key for KMS type 'static': %v", err.Error())
+			return nil, fmt.Errorf("%w: failed to create static master key for KMS type 'static': %w", ErrKMSFailed, err)
 		}
 
-		return m
+		return m, nil
 	} else if opts.KMS == "test-debug-static" {
 		// We don't warn if the user specifically asks for test-debug-static
 		m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", crypto)
 		if err != nil {
-			log.ErrorLogf("PANIC: Failed to create static master key for KMS type 'test-debug-static': %v", err.Error())
-			panic(fmt.Errorf("failed to create static master key for KMS type 'test-debug-static': %w", err))
+			log.ErrorLogf("Failed to create static master key for KMS type 'test-debug-static': %v", err.Error())
+			return nil, fmt.Errorf("%w: failed to create static master key for KMS type 'test-debug-static': %w", ErrKMSFailed, err)
 		}
 
-		return m
+		return m, nil
 	}
 
 	m, err := kms.NewAWS(crypto, opts.PreferredRegion, opts.RegionMap)
 	if err != nil {
-		log.ErrorLogf("PANIC: Failed to create AWS KMS with preferred region '%s': %v", opts.PreferredRegion, err.Error())
-		panic(fmt.Errorf("failed to create AWS KMS with preferred region '%s': %w", opts.PreferredRegion, err))
+		log.ErrorLogf("Failed to create AWS KMS with preferred region '%s': %v", opts.PreferredRegion, err.Error())
+		return nil, fmt.Errorf("%w: failed to create AWS KMS with preferred region '%s': %w", ErrKMSFailed, opts.PreferredRegion, err)
 	}
 
-	return m
+	return m, nil
 }
 
 func NewCryptoPolicy(options *Options) *appencryption.CryptoPolicy {
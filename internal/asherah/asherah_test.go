@@ -0,0 +1,33 @@
+package asherah
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetupShutdownConcurrently(t *testing.T) {
+	options := &Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static"}
+	defer Shutdown()
+
+	for i := 0; i < 50; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_ = Setup(options)
+			}()
+			go func() {
+				defer wg.Done()
+				Shutdown()
+			}()
+		}
+		wg.Wait()
+
+		initialized := atomic.LoadInt32(&globalInitialized) == 1
+		if instance := globalInstance.Load(); initialized != (instance != nil) {
+			t.Fatalf("Expected the instance to be set only while initialized, initialized %v instance %v", initialized, instance)
+		}
+	}
+}
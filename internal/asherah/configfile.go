@@ -0,0 +1,168 @@
+package asherah
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileReferencePrefix marks a configuration value to be replaced by the contents of a file, e.g.
+// ConnectionString: file:/run/secrets/asherah-dsn. Relative paths are resolved against the
+// directory of the configuration file.
+const FileReferencePrefix = "file:"
+
+var ErrConfigFile = errors.New("failed to load configuration file")
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// OptionsFromFile returns Options read from a YAML (.yaml, .yml), TOML (.toml) or JSON (.json)
+// file, chosen by extension. Fields are named as in the SetupJson configuration.
+func OptionsFromFile(path string) (*Options, error) {
+	opts := &Options{}
+	if err := opts.LoadFile(path); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// LoadFile overwrites the fields of opts that are present in the configuration file at path. In
+// every string value, ${NAME} is first replaced by the environment variable NAME, and a value
+// starting with FileReferencePrefix is then replaced by the contents of the named file, without
+// trailing newlines. Syntax errors are reported with their line number.
+func (opts *Options) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigFile, err)
+	}
+
+	config := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	case ".toml":
+		_, err = toml.Decode(string(data), &config)
+	case ".json":
+		err = json.Unmarshal(data, &config)
+		if offset, ok := jsonErrorOffset(err); ok {
+			err = fmt.Errorf("line %d: %w", 1+bytes.Count(data[:offset], []byte("\n")), err)
+		}
+	default:
+		return fmt.Errorf("%w: %s: unsupported extension '%s' (expected .yaml, .yml, .toml or .json)", ErrConfigFile, path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrConfigFile, path, err)
+	}
+
+	resolved, err := resolveReferences("", config, filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrConfigFile, path, err)
+	}
+
+	encoded, err := json.Marshal(resolved)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrConfigFile, path, err)
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if err := json.Unmarshal(encoded, opts); errors.As(err, &typeError) {
+		return ValidationError{{Field: typeError.Field, Message: "expected " + typeError.Type.String() + ", got " + typeError.Value}}
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// jsonErrorOffset returns the byte offset at which a JSON decoding error was detected, if known.
+func jsonErrorOffset(err error) (int64, bool) {
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) {
+		return syntaxError.Offset, true
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return typeError.Offset, true
+	}
+
+	return 0, false
+}
+
+// resolveReferences returns value with the environment and file references in every string
+// replaced. key is the dotted path of value, used in errors.
+func resolveReferences(key string, value interface{}, dir string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return resolveString(key, v, dir)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			child := k
+			if key != "" {
+				child = key + "." + k
+			}
+
+			resolved, err := resolveReferences(child, v[k], dir)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = resolved
+		}
+	case []interface{}:
+		for n := range v {
+			resolved, err := resolveReferences(fmt.Sprintf("%s[%d]", key, n), v[n], dir)
+			if err != nil {
+				return nil, err
+			}
+			v[n] = resolved
+		}
+	}
+
+	return value, nil
+}
+
+func resolveString(key string, value string, dir string) (string, error) {
+	var missing []string
+	value = envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return env
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%s: environment variable %s is not set", key, strings.Join(missing, ", "))
+	}
+
+	path, ok := strings.CutPrefix(value, FileReferencePrefix)
+	if !ok {
+		return value, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
@@ -0,0 +1,98 @@
+package asherah
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("WriteFile returned %v", err)
+	}
+	return path
+}
+
+func TestOptionsFromFileFormats(t *testing.T) {
+	for name, contents := range map[string]string{
+		"asherah.yaml": "ServiceName: s\nProductID: p\nExpireAfter: 90d\nSessionCacheMaxSize: 10\nRegionMap:\n  us-west-2: arn\n",
+		"asherah.toml": "ServiceName = \"s\"\nProductID = \"p\"\nExpireAfter = \"90d\"\nSessionCacheMaxSize = 10\n[RegionMap]\nus-west-2 = \"arn\"\n",
+		"asherah.json": `{"ServiceName":"s","ProductID":"p","ExpireAfter":"90d","SessionCacheMaxSize":10,"RegionMap":{"us-west-2":"arn"}}`,
+	} {
+		opts, err := OptionsFromFile(writeConfigFile(t, name, contents))
+		if err != nil {
+			t.Errorf("%v: OptionsFromFile returned %v", name, err)
+			continue
+		}
+
+		if opts.ServiceName != "s" || opts.ProductID != "p" || opts.ExpireAfter != 90*24*time.Hour ||
+			opts.SessionCacheMaxSize != 10 || opts.RegionMap["us-west-2"] != "arn" {
+			t.Errorf("%v: unexpected options %+v", name, opts)
+		}
+	}
+}
+
+func TestOptionsFromFileReferences(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dsn"), []byte("user:secret@tcp(db:3306)/asherah\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned %v", err)
+	}
+	t.Setenv("TEST_SERVICE", "service")
+	t.Setenv("TEST_SECRETS", dir)
+
+	path := writeConfigFile(t, "asherah.yml", "ServiceName: ${TEST_SERVICE}-api\nConnectionString: file:${TEST_SECRETS}/dsn\n")
+	opts, err := OptionsFromFile(path)
+	if err != nil {
+		t.Fatalf("OptionsFromFile returned %v", err)
+	}
+
+	if opts.ServiceName != "service-api" {
+		t.Errorf("Expected ServiceName service-api got %q", opts.ServiceName)
+	}
+	if opts.ConnectionString != "user:secret@tcp(db:3306)/asherah" {
+		t.Errorf("Unexpected ConnectionString %q", opts.ConnectionString)
+	}
+}
+
+func TestOptionsFromFileRelativeFileReference(t *testing.T) {
+	path := writeConfigFile(t, "asherah.json", `{"ConnectionString":"file:dsn"}`)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "dsn"), []byte("dsn"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned %v", err)
+	}
+
+	opts, err := OptionsFromFile(path)
+	if err != nil || opts.ConnectionString != "dsn" {
+		t.Errorf("Unexpected result %+v %v", opts, err)
+	}
+}
+
+func TestOptionsFromFileErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		file     string
+		contents string
+		message  string
+	}{
+		"yaml syntax":     {"asherah.yaml", "ServiceName: s\nProductID: p\nKMS: aws: static\n", "line 3"},
+		"toml syntax":     {"asherah.toml", "ServiceName = \"s\"\nProductID = \n", "line 2"},
+		"json syntax":     {"asherah.json", "{\n\"ServiceName\": \"s\",\n}", "line 3"},
+		"extension":       {"asherah.ini", "ServiceName=s", "unsupported extension"},
+		"unset variable":  {"asherah.yaml", "ConnectionString: ${TEST_UNSET_VARIABLE}", "TEST_UNSET_VARIABLE is not set"},
+		"missing secret":  {"asherah.yaml", "ConnectionString: file:/nonexistent/dsn", "ConnectionString"},
+		"wrong type":      {"asherah.yaml", "SessionCacheMaxSize: lots", "SessionCacheMaxSize"},
+		"ambiguous value": {"asherah.yaml", "ExpireAfter: \"90\"", "ambiguous"},
+		"bare number":     {"asherah.yaml", "ExpireAfter: 90", "ExpireAfterSeconds"},
+	} {
+		_, err := OptionsFromFile(writeConfigFile(t, test.file, test.contents))
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%v: expected an error containing %q got %v", name, test.message, err)
+		}
+	}
+
+	if _, err := OptionsFromFile(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, ErrConfigFile) {
+		t.Errorf("Expected ErrConfigFile got %v", err)
+	}
+}
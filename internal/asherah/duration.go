@@ -0,0 +1,211 @@
+package asherah
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecondsSuffix names the JSON form of a duration field given as a number of seconds, e.g.
+// "ExpireAfterSeconds": 7776000.
+const SecondsSuffix = "Seconds"
+
+var dayComponent = regexp.MustCompile(`([0-9]+(?:\.[0-9]*)?|\.[0-9]+)d`)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ParseDuration parses a duration in time.ParseDuration syntax extended with a "d" (24 hour) unit,
+// e.g. "90d", "1d12h", "2h" or "30m". A number without a unit is rejected as ambiguous.
+func ParseDuration(s string) (time.Duration, error) {
+	trimmed := strings.TrimSpace(s)
+	if number, err := strconv.ParseFloat(trimmed, 64); err == nil && trimmed != "0" {
+		if math.Abs(number) < 1e6 {
+			return 0, fmt.Errorf("ambiguous duration '%s': add a unit such as %[1]sd, %[1]sh, %[1]sm or %[1]ss", trimmed)
+		}
+		return 0, fmt.Errorf("ambiguous duration '%s': add a unit (d, h, m, s, ms, us or ns)", trimmed)
+	}
+
+	var dayErr error
+	expanded := dayComponent.ReplaceAllStringFunc(trimmed, func(day string) string {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(day, "d"), 64)
+		if err != nil {
+			dayErr = err
+			return day
+		}
+		return strconv.FormatFloat(days*24, 'f', -1, 64) + "h"
+	})
+	if dayErr != nil {
+		return 0, fmt.Errorf("invalid duration '%s': %w", trimmed, dayErr)
+	}
+
+	d, err := time.ParseDuration(expanded)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s' (expected e.g. 90d, 2h, 30m or 45s)", trimmed)
+	}
+
+	return d, nil
+}
+
+// UnmarshalJSON decodes Options, accepting each time.Duration field as a ParseDuration string
+// ("90d"), as a number of seconds under the field name suffixed with Seconds, or as an integer
+// number of nanoseconds as SetupJson always has. An integer under a second other than 0 is almost
+// certainly a unit mistake and is rejected, as is setting more than one form of a field.
+// Problems with duration fields are returned as a ValidationError. A RegionMap in data replaces
+// the one already in opts instead of being merged into it.
+func (opts *Options) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	for key := range fields {
+		if strings.EqualFold(key, "RegionMap") {
+			opts.RegionMap = nil
+		}
+	}
+
+	var errs ValidationError
+	durations := map[int]time.Duration{}
+
+	optionsType := reflect.TypeOf(*opts)
+	for n := 0; n < optionsType.NumField(); n++ {
+		field := optionsType.Field(n)
+		if field.Type != durationType {
+			continue
+		}
+
+		var matched []string
+		for key, raw := range fields {
+			var d time.Duration
+			var err error
+			switch {
+			case strings.EqualFold(key, field.Name):
+				d, err = decodeDuration(field.Name, raw)
+			case strings.EqualFold(key, field.Name+SecondsSuffix):
+				d, err = decodeSeconds(raw)
+			default:
+				continue
+			}
+
+			matched = append(matched, key)
+			delete(fields, key)
+			if err != nil {
+				errs = append(errs, FieldError{Field: key, Message: err.Error()})
+				continue
+			}
+			durations[n] = d
+		}
+
+		if len(matched) > 1 {
+			errs = append(errs, FieldError{Field: field.Name, Message: fmt.Sprintf("ambiguous: set only one of %s", strings.Join(matched, ", "))})
+		}
+	}
+
+	if len(errs) > 0 {
+		slices.SortStableFunc(errs, func(a, b FieldError) int {
+			return strings.Compare(a.Field, b.Field)
+		})
+		return errs
+	}
+
+	// plain has the fields of Options but not this method, so decoding it cannot recurse.
+	type plain Options
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(rest, (*plain)(opts)); err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(opts).Elem()
+	for n, d := range durations {
+		value.Field(n).SetInt(int64(d))
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes Options with each time.Duration field as a duration string ("2h0m0s"), so
+// the output can be decoded by UnmarshalJSON.
+func (opts Options) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte('{')
+
+	value := reflect.ValueOf(opts)
+	for n := 0; n < value.NumField(); n++ {
+		if n > 0 {
+			out.WriteByte(',')
+		}
+
+		field := value.Field(n).Interface()
+		if d, ok := field.(time.Duration); ok {
+			field = d.String()
+		}
+
+		name, err := json.Marshal(value.Type().Field(n).Name)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(encoded)
+	}
+
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+func decodeDuration(name string, raw json.RawMessage) (time.Duration, error) {
+	raw = bytes.TrimSpace(raw)
+	if bytes.Equal(raw, []byte("null")) {
+		return 0, nil
+	}
+
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, err
+		}
+		return ParseDuration(s)
+	}
+
+	nanoseconds, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration string such as \"90d\" or whole nanoseconds, got %s: set %s%s for seconds", raw, name, SecondsSuffix)
+	}
+
+	d := time.Duration(nanoseconds)
+	if d != 0 && d > -time.Second && d < time.Second {
+		// Nobody configures a key expiry or timeout in nanoseconds; the number was meant in another unit.
+		return 0, fmt.Errorf("%s is %v, less than a second, as nanoseconds: use a string with a unit such as \"%v\", or set %s%s",
+			raw, d, d*time.Second, name, SecondsSuffix)
+	}
+
+	return d, nil
+}
+
+func decodeSeconds(raw json.RawMessage) (time.Duration, error) {
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err != nil {
+		return 0, fmt.Errorf("expected a number of seconds, got %s", bytes.TrimSpace(raw))
+	}
+
+	if math.IsInf(seconds*float64(time.Second), 0) || math.Abs(seconds*float64(time.Second)) > math.MaxInt64 {
+		return 0, fmt.Errorf("%v seconds is out of range", seconds)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,140 @@
+package asherah
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for input, expected := range map[string]time.Duration{
+		"90d":   90 * 24 * time.Hour,
+		"1.5d":  36 * time.Hour,
+		"1d12h": 36 * time.Hour,
+		"2h":    2 * time.Hour,
+		"30m":   30 * time.Minute,
+		"45s":   45 * time.Second,
+		"0":     0,
+	} {
+		d, err := ParseDuration(input)
+		if err != nil || d != expected {
+			t.Errorf("ParseDuration(%q) returned %v, %v expected %v", input, d, err, expected)
+		}
+	}
+
+	for _, input := range []string{"90", "1.5", "", "d", "90days", "2x"} {
+		if _, err := ParseDuration(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestOptionsUnmarshalDurations(t *testing.T) {
+	var opts Options
+	config := `{"ServiceName":"s","ExpireAfter":"90d","CheckInterval":"1000ns","sessionCacheDurationSeconds":7200,"OperationTimeout":null}`
+	if err := json.Unmarshal([]byte(config), &opts); err != nil {
+		t.Fatalf("Unmarshal returned %v", err)
+	}
+
+	if opts.ServiceName != "s" {
+		t.Errorf("Expected ServiceName s got %q", opts.ServiceName)
+	}
+	if opts.ExpireAfter != 90*24*time.Hour {
+		t.Errorf("Expected ExpireAfter 90d got %v", opts.ExpireAfter)
+	}
+	if opts.CheckInterval != 1000 {
+		t.Errorf("Expected CheckInterval 1000ns got %v", opts.CheckInterval)
+	}
+	if opts.SessionCacheDuration != 2*time.Hour {
+		t.Errorf("Expected SessionCacheDuration 2h got %v", opts.SessionCacheDuration)
+	}
+}
+
+func TestOptionsUnmarshalAcceptsNanoseconds(t *testing.T) {
+	var opts Options
+	if err := json.Unmarshal([]byte(`{"ExpireAfter":7776000000000000,"CheckInterval":-1000000000}`), &opts); err != nil {
+		t.Fatalf("Unmarshal returned %v", err)
+	}
+	if opts.ExpireAfter != 90*24*time.Hour || opts.CheckInterval != -time.Second {
+		t.Errorf("Expected 2160h0m0s and -1s got %v and %v", opts.ExpireAfter, opts.CheckInterval)
+	}
+}
+
+func TestOptionsUnmarshalRejectsSubSecondNumbers(t *testing.T) {
+	for _, config := range []string{`{"ExpireAfter":90}`, `{"CheckInterval":1.5}`, `{"SessionCacheDuration":7200}`, `{"OperationTimeout":-1}`} {
+		var opts Options
+		err := json.Unmarshal([]byte(config), &opts)
+		if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), SecondsSuffix) {
+			t.Errorf("%v: expected an ambiguous duration error got %v", config, err)
+		}
+	}
+
+	var opts Options
+	err := json.Unmarshal([]byte(`{"SessionCacheDuration":7200}`), &opts)
+	if err == nil || !strings.Contains(err.Error(), `"2h0m0s"`) {
+		t.Errorf("Expected a suggestion of 2h0m0s got %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"ExpireAfter":0}`), &opts); err != nil || opts.ExpireAfter != 0 {
+		t.Errorf("Expected 0 to be accepted got %v, %v", opts.ExpireAfter, err)
+	}
+}
+
+func TestOptionsMarshalRoundTrip(t *testing.T) {
+	opts := Options{ServiceName: "s", ExpireAfter: 90 * 24 * time.Hour, CheckInterval: time.Microsecond, RegionMap: RegionMap{"us-west-2": "arn"}}
+
+	data, err := json.Marshal(&opts)
+	if err != nil {
+		t.Fatalf("Marshal returned %v", err)
+	}
+
+	var decoded Options
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal of %s returned %v", data, err)
+	}
+	if decoded.ServiceName != "s" || decoded.ExpireAfter != opts.ExpireAfter || decoded.CheckInterval != time.Microsecond || decoded.RegionMap["us-west-2"] != "arn" {
+		t.Errorf("Expected %+v got %+v", opts, decoded)
+	}
+}
+
+func TestOptionsUnmarshalKeepsUnsetFields(t *testing.T) {
+	opts := Options{ExpireAfter: time.Hour, ProductID: "p"}
+	if err := json.Unmarshal([]byte(`{"ServiceName":"s"}`), &opts); err != nil {
+		t.Fatalf("Unmarshal returned %v", err)
+	}
+
+	if opts.ExpireAfter != time.Hour || opts.ProductID != "p" {
+		t.Errorf("Expected unset fields to be kept got %+v", opts)
+	}
+}
+
+func TestOptionsUnmarshalReplacesRegionMap(t *testing.T) {
+	opts := Options{RegionMap: RegionMap{"us-west-2": "arn1"}}
+	if err := json.Unmarshal([]byte(`{"regionmap":{"us-east-1":"arn2"}}`), &opts); err != nil {
+		t.Fatalf("Unmarshal returned %v", err)
+	}
+
+	if len(opts.RegionMap) != 1 || opts.RegionMap["us-east-1"] != "arn2" {
+		t.Errorf("Expected only us-east-1 got %v", opts.RegionMap)
+	}
+}
+
+func TestOptionsUnmarshalRejectsAmbiguousDurations(t *testing.T) {
+	var opts Options
+	err := json.Unmarshal([]byte(`{"ExpireAfter":"90","CheckInterval":"1h","CheckIntervalSeconds":60,"SessionCacheDurationSeconds":"1h"}`), &opts)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected ErrInvalidConfig got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, fieldError := range err.(ValidationError) {
+		fields[fieldError.Field] = true
+	}
+	for _, field := range []string{"ExpireAfter", "CheckInterval", "SessionCacheDurationSeconds"} {
+		if !fields[field] {
+			t.Errorf("Expected an error for %v got %v", field, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package asherah
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OptionsFromEnv returns Options populated from the variables named by their env tags.
+func OptionsFromEnv() (*Options, error) {
+	opts := &Options{}
+	if err := opts.LoadEnv(); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// LoadEnv sets every field whose env tag names a non-empty environment variable, leaving the
+// others untouched. Durations use ParseDuration syntax ("90d", "2h"), booleans
+// strconv.ParseBool syntax and RegionMap the REGION1=ARN1[,REGION2=ARN2] form. It returns a
+// ValidationError listing every variable that could not be parsed.
+func (opts *Options) LoadEnv() error {
+	var errs ValidationError
+
+	value := reflect.ValueOf(opts).Elem()
+	for n := 0; n < value.NumField(); n++ {
+		field := value.Type().Field(n)
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+
+		if err := setFieldFromString(value.Field(n), raw); err != nil {
+			errs = append(errs, FieldError{Field: field.Name, Message: fmt.Sprintf("%s: %v", name, err)})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func setFieldFromString(field reflect.Value, raw string) error {
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case RegionMap:
+		regionMap, err := ParseRegionMap(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(regionMap))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean '%s'", raw)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer '%s'", raw)
+		}
+		field.SetInt(int64(i))
+	default:
+		return fmt.Errorf("unsupported field type %v", field.Type())
+	}
+
+	return nil
+}
+
+// ParseRegionMap parses the REGION1=ARN1[,REGION2=ARN2] form used by ASHERAH_REGION_MAP.
+func ParseRegionMap(raw string) (RegionMap, error) {
+	regionMap := RegionMap{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		region, arn, ok := strings.Cut(entry, "=")
+		region, arn = strings.TrimSpace(region), strings.TrimSpace(arn)
+		if !ok || region == "" || arn == "" {
+			return nil, fmt.Errorf("invalid region map entry '%s' (expected REGION=ARN)", entry)
+		}
+
+		regionMap[region] = arn
+	}
+
+	return regionMap, nil
+}
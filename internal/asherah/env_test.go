@@ -0,0 +1,73 @@
+package asherah
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("ASHERAH_SERVICE_NAME", "service")
+	t.Setenv("ASHERAH_PRODUCT_NAME", "product")
+	t.Setenv("ASHERAH_EXPIRE_AFTER", "90m")
+	t.Setenv("ASHERAH_SESSION_CACHE_MAX_SIZE", "42")
+	t.Setenv("ASHERAH_ENABLE_SESSION_CACHING", "true")
+	t.Setenv("ASHERAH_VERBOSE", "0")
+	t.Setenv("ASHERAH_REGION_MAP", "us-west-2=arn:aws:kms:us-west-2:1:key/a, us-east-1=arn:aws:kms:us-east-1:1:key/b")
+
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatalf("OptionsFromEnv returned %v", err)
+	}
+
+	if opts.ServiceName != "service" || opts.ProductID != "product" {
+		t.Errorf("Unexpected names %q %q", opts.ServiceName, opts.ProductID)
+	}
+	if opts.ExpireAfter != 90*time.Minute {
+		t.Errorf("Expected ExpireAfter 90m got %v", opts.ExpireAfter)
+	}
+	if opts.SessionCacheMaxSize != 42 {
+		t.Errorf("Expected SessionCacheMaxSize 42 got %v", opts.SessionCacheMaxSize)
+	}
+	if !opts.EnableSessionCaching || opts.Verbose {
+		t.Errorf("Unexpected booleans EnableSessionCaching=%v Verbose=%v", opts.EnableSessionCaching, opts.Verbose)
+	}
+	if len(opts.RegionMap) != 2 || opts.RegionMap["us-east-1"] != "arn:aws:kms:us-east-1:1:key/b" {
+		t.Errorf("Unexpected RegionMap %v", opts.RegionMap)
+	}
+}
+
+func TestOptionsFromEnvReportsEveryProblem(t *testing.T) {
+	t.Setenv("ASHERAH_EXPIRE_AFTER", "90")
+	t.Setenv("ASHERAH_SESSION_CACHE_MAX_SIZE", "lots")
+	t.Setenv("ASHERAH_VERBOSE", "yes please")
+	t.Setenv("ASHERAH_REGION_MAP", "us-west-2")
+
+	_, err := OptionsFromEnv()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected ErrInvalidConfig got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, fieldError := range err.(ValidationError) {
+		fields[fieldError.Field] = true
+	}
+	for _, field := range []string{"ExpireAfter", "SessionCacheMaxSize", "Verbose", "RegionMap"} {
+		if !fields[field] {
+			t.Errorf("Expected an error for %v got %v", field, err)
+		}
+	}
+}
+
+func TestParseRegionMap(t *testing.T) {
+	regionMap, err := ParseRegionMap("r1=arn1,,r2=arn2")
+	if err != nil || len(regionMap) != 2 || regionMap["r1"] != "arn1" || regionMap["r2"] != "arn2" {
+		t.Errorf("Unexpected result %v %v", regionMap, err)
+	}
+
+	for _, raw := range []string{"r1", "=arn1", "r1=", "r1=arn1,r2"} {
+		if _, err := ParseRegionMap(raw); err == nil {
+			t.Errorf("Expected an error for %q", raw)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package asherah
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// Component statuses reported by HealthCheck.
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusError   = "error"
+	HealthStatusSkipped = "skipped"
+)
+
+// DefaultHealthCheckTimeout bounds each health probe when no OperationTimeout is configured.
+const DefaultHealthCheckTimeout = 10 * time.Second
+
+var errKMSCanaryMismatch = errors.New("KMS canary round-trip returned different key material")
+
+// ComponentHealth is the outcome of probing one dependency.
+type ComponentHealth struct {
+	Status    string  `json:"Status"`
+	LatencyMs float64 `json:"LatencyMs"`
+	Error     string  `json:"Error,omitempty"`
+}
+
+// HealthReport is the outcome of HealthCheck. Healthy is only true when every probed component is ok.
+type HealthReport struct {
+	Healthy     bool                       `json:"Healthy"`
+	Initialized bool                       `json:"Initialized"`
+	Components  map[string]ComponentHealth `json:"Components"`
+}
+
+// HealthCheck probes the metastore and KMS of the instance identified by handle. An uninitialized
+// default instance is reported as unhealthy rather than as an error.
+func HealthCheck(handle int64) (*HealthReport, error) {
+	instance, err := getInstance(handle)
+	if errors.Is(err, ErrAsherahNotInitialized) {
+		return uninitializedHealthReport(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return instance.HealthCheck(), nil
+}
+
+func uninitializedHealthReport() *HealthReport {
+	return &HealthReport{
+		Components: map[string]ComponentHealth{
+			"metastore": {Status: HealthStatusSkipped},
+			"kms":       {Status: HealthStatusSkipped},
+		},
+	}
+}
+
+// HealthCheck pings the metastore (the SQL connection for rdbms, otherwise a read of the system key)
+// and round-trips a random canary key through the KMS. Probes bypass the metrics and tracing
+// wrappers so they do not show up as application traffic. A closed instance is reported as
+// uninitialized.
+func (i *Instance) HealthCheck() *HealthReport {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	if i.checkOpen() != nil {
+		return uninitializedHealthReport()
+	}
+
+	report := &HealthReport{
+		Initialized: true,
+		Components: map[string]ComponentHealth{
+			"metastore": i.probe(i.pingMetastore),
+			"kms":       i.probe(i.pingKMS),
+		},
+	}
+
+	report.Healthy = true
+	for _, component := range report.Components {
+		if component.Status != HealthStatusOK {
+			report.Healthy = false
+		}
+	}
+
+	return report
+}
+
+func (i *Instance) probe(ping func(context.Context) error) ComponentHealth {
+	timeout := i.options.OperationTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := timeoutError(ctx, ping(ctx))
+	health := ComponentHealth{
+		Status:    HealthStatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		health.Status = HealthStatusError
+		health.Error = err.Error()
+	}
+
+	return health
+}
+
+func (i *Instance) pingMetastore(ctx context.Context) error {
+	if i.options.Metastore == "rdbms" {
+		return pingConnection(ctx, sqlMetastoreDBType(i.options), i.options.ConnectionString)
+	}
+
+	_, err := unwrapMetastore(i.metastore).LoadLatest(ctx, i.systemKeyID())
+	return err
+}
+
+func (i *Instance) pingKMS(ctx context.Context) error {
+	canary := make([]byte, 32)
+	if _, err := rand.Read(canary); err != nil {
+		return err
+	}
+
+	kms := unwrapKMS(i.kms)
+
+	encrypted, err := kms.EncryptKey(ctx, canary)
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := kms.DecryptKey(ctx, encrypted)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(canary, decrypted) {
+		return errKMSCanaryMismatch
+	}
+
+	return nil
+}
+
+// unwrapKMS returns the KMS underneath any metrics and tracing wrappers.
+func unwrapKMS(kms appencryption.KeyManagementService) appencryption.KeyManagementService {
+	for {
+		switch k := kms.(type) {
+		case meteredKMS:
+			kms = k.KeyManagementService
+		case tracedKMS:
+			kms = k.KeyManagementService
+		default:
+			return kms
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package asherah
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+type latestRecordingMetastore struct {
+	suffixedMetastore
+	id *string
+}
+
+func (m latestRecordingMetastore) LoadLatest(_ context.Context, id string) (*appencryption.EnvelopeKeyRecord, error) {
+	*m.id = id
+	return nil, nil
+}
+
+func TestInstanceHealthCheckReportsFailingMetastore(t *testing.T) {
+	instance := newBlockingInstance(t, 10*time.Millisecond)
+	defer instance.sessionFactory.Close()
+
+	report := instance.HealthCheck()
+	if report.Healthy || !report.Initialized {
+		t.Errorf("Expected an initialized, unhealthy report got %+v", report)
+	}
+
+	if metastore := report.Components["metastore"]; metastore.Status != HealthStatusError || metastore.Error == "" {
+		t.Errorf("Expected metastore error got %+v", metastore)
+	}
+
+	if kms := report.Components["kms"]; kms.Status != HealthStatusOK {
+		t.Errorf("Expected kms ok got %+v", kms)
+	}
+}
+
+func TestHealthCheckUninitialized(t *testing.T) {
+	report, err := HealthCheck(DefaultInstance)
+	if err != nil {
+		t.Fatalf("HealthCheck returned %v", err)
+	}
+
+	if report.Healthy || report.Initialized || report.Components["kms"].Status != HealthStatusSkipped {
+		t.Errorf("Expected an uninitialized report got %+v", report)
+	}
+}
+
+func TestHealthCheckUnknownInstance(t *testing.T) {
+	if _, err := HealthCheck(-1); err != ErrInstanceNotFound {
+		t.Errorf("Expected ErrInstanceNotFound got %v", err)
+	}
+}
+
+func TestPingMetastoreUsesRegionSuffix(t *testing.T) {
+	var id string
+	instance := &Instance{
+		options:   &Options{Metastore: "dynamodb", ServiceName: "s", ProductID: "p"},
+		metastore: meteredMetastore{latestRecordingMetastore{suffixedMetastore{persistence.NewMemoryMetastore()}, &id}},
+	}
+
+	if err := instance.pingMetastore(context.Background()); err != nil {
+		t.Fatalf("pingMetastore returned %v", err)
+	}
+	if id != "_SK_s_p_us-west-2" {
+		t.Errorf("Expected _SK_s_p_us-west-2 got %v", id)
+	}
+}
+
+func TestHealthCheckDestroyedInstance(t *testing.T) {
+	handle, err := CreateInstance(&Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static"})
+	if err != nil {
+		t.Fatalf("CreateInstance returned %v", err)
+	}
+	instance, _ := getInstance(handle)
+	if err := DestroyInstance(handle); err != nil {
+		t.Fatalf("DestroyInstance returned %v", err)
+	}
+
+	if report := instance.HealthCheck(); report.Initialized {
+		t.Errorf("Expected an uninitialized health report got %+v", report)
+	}
+}
+
+func TestHealthCheckBypassesMetrics(t *testing.T) {
+	enableMetricsForTesting(t)
+
+	instance := newBlockingInstance(t, 10*time.Millisecond)
+	defer instance.sessionFactory.Close()
+	instance.metastore = meteredMetastore{persistence.NewMemoryMetastore()}
+	instance.kms = meteredKMS{instance.kms}
+
+	loads, encrypts := metastoreLatest.Count(), kmsEncryptTimer.Count()
+
+	if report := instance.HealthCheck(); !report.Healthy {
+		t.Fatalf("Expected a healthy report got %+v", report)
+	}
+
+	if metastoreLatest.Count() != loads || kmsEncryptTimer.Count() != encrypts {
+		t.Error("Expected health probes not to be recorded as metastore or KMS calls")
+	}
+}
@@ -0,0 +1,133 @@
+package asherah
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// KeyReport describes a system or intermediate key as stored in the metastore.
+type KeyReport struct {
+	ID      string `json:"KeyId"`
+	Created int64  `json:"Created"`
+	Exists  bool   `json:"Exists"`
+	Revoked bool   `json:"Revoked"`
+	Expired bool   `json:"Expired"`
+}
+
+// DataRowRecordReport is written by InspectDataRowRecord. SystemKey is the parent of the
+// intermediate key and is only reported if the intermediate key exists. Problems lists every
+// reason the record could not be decrypted by this instance.
+type DataRowRecordReport struct {
+	Partition          string     `json:"Partition,omitempty"`
+	IntermediateKey    *KeyReport `json:"IntermediateKey,omitempty"`
+	SystemKey          *KeyReport `json:"SystemKey,omitempty"`
+	DataKeyCreated     int64      `json:"DataKeyCreated"`
+	EncryptedKeySize   int        `json:"EncryptedKeySize"`
+	CiphertextSize     int        `json:"CiphertextSize"`
+	ExpireAfterSeconds int64      `json:"ExpireAfterSeconds"`
+	Problems           []string   `json:"Problems,omitempty"`
+}
+
+// InspectDataRowRecord reports the keys of drr using the instance identified by handle. See
+// Instance.InspectDataRowRecord.
+func InspectDataRowRecord(ctx context.Context, handle int64, drr *appencryption.DataRowRecord) (*DataRowRecordReport, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to inspect data row record: instance %v: %v", handle, err)
+		return nil, err
+	}
+
+	return instance.InspectDataRowRecord(ctx, drr)
+}
+
+// InspectDataRowRecord looks up the intermediate key of drr and its parent system key in the
+// metastore without decrypting anything. Keys are reported expired or revoked under the current
+// ExpireAfter and their stored revocation flag; neither prevents decryption.
+func (i *Instance) InspectDataRowRecord(ctx context.Context, drr *appencryption.DataRowRecord) (report *DataRowRecordReport, err error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	if err := i.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	ctx, span := i.tracer.Start(ctx, "asherah.InspectDataRowRecord")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := i.newContext(ctx, 0)
+	defer cancel()
+
+	report = &DataRowRecordReport{
+		CiphertextSize:     len(drr.Data),
+		ExpireAfterSeconds: int64(i.options.ExpireAfter.Seconds()),
+	}
+
+	if drr.Key == nil {
+		report.Problems = append(report.Problems, "the record has no Key")
+		return report, nil
+	}
+	report.DataKeyCreated = drr.Key.Created
+	report.EncryptedKeySize = len(drr.Key.EncryptedKey)
+
+	if drr.Key.ParentKeyMeta == nil {
+		report.Problems = append(report.Problems, "the record has no ParentKeyMeta")
+		return report, nil
+	}
+
+	meta := drr.Key.ParentKeyMeta
+	partition, ok := i.keyPartition(meta.ID)
+	if ok {
+		report.Partition = partition
+	} else {
+		report.Problems = append(report.Problems, fmt.Sprintf("'%s' is not an intermediate key of service '%s' and product '%s'",
+			meta.ID, i.options.ServiceName, i.options.ProductID))
+	}
+
+	var ik *appencryption.EnvelopeKeyRecord
+	report.IntermediateKey, ik, err = i.inspectKey(ctx, *meta)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	if ik == nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("intermediate key %s created %d is not in the metastore", meta.ID, meta.Created))
+		return report, nil
+	}
+
+	if ik.ParentKeyMeta == nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("intermediate key %s created %d has no ParentKeyMeta", meta.ID, meta.Created))
+		return report, nil
+	}
+
+	var sk *appencryption.EnvelopeKeyRecord
+	report.SystemKey, sk, err = i.inspectKey(ctx, *ik.ParentKeyMeta)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	if sk == nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("system key %s created %d is not in the metastore", ik.ParentKeyMeta.ID, ik.ParentKeyMeta.Created))
+	}
+
+	return report, nil
+}
+
+func (i *Instance) inspectKey(ctx context.Context, meta appencryption.KeyMeta) (*KeyReport, *appencryption.EnvelopeKeyRecord, error) {
+	ekr, err := i.metastore.Load(ctx, meta.ID, meta.Created)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to load key %s created %d: %w", ErrMetastoreFailed, meta.ID, meta.Created, err)
+	}
+
+	report := &KeyReport{
+		ID:      meta.ID,
+		Created: meta.Created,
+		Expired: keyExpired(meta.Created, i.options.ExpireAfter),
+	}
+	if ekr != nil {
+		report.Exists = true
+		report.Revoked = ekr.Revoked
+	}
+
+	return report, ekr, nil
+}
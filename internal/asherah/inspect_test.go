@@ -0,0 +1,53 @@
+package asherah
+
+import (
+	"context"
+	"testing"
+
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+func TestInspectDataRowRecord(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	drr := testEncrypt(t, handle, "partition")
+
+	if err := RevokeKey(context.Background(), handle, *drr.Key.ParentKeyMeta); err != nil {
+		t.Fatalf("RevokeKey returned %v", err)
+	}
+
+	report, err := InspectDataRowRecord(context.Background(), handle, drr)
+	if err != nil {
+		t.Fatalf("InspectDataRowRecord returned %v", err)
+	}
+
+	if report.Partition != "partition" || len(report.Problems) != 0 || report.CiphertextSize != len(drr.Data) {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if ik := report.IntermediateKey; ik.ID != "_IK_partition_s_p" || ik.Created != drr.Key.ParentKeyMeta.Created || !ik.Exists || !ik.Revoked || ik.Expired {
+		t.Errorf("Unexpected intermediate key %+v", ik)
+	}
+	if sk := report.SystemKey; sk == nil || sk.ID != "_SK_s_p" || !sk.Exists || sk.Revoked {
+		t.Errorf("Unexpected system key %+v", sk)
+	}
+}
+
+func TestInspectDataRowRecordProblems(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+
+	report, err := InspectDataRowRecord(context.Background(), handle, &appencryption.DataRowRecord{
+		Key:  &appencryption.EnvelopeKeyRecord{Created: 1, ParentKeyMeta: &appencryption.KeyMeta{ID: "_IK_partition_other_p", Created: 1}},
+		Data: []byte("data"),
+	})
+	if err != nil {
+		t.Fatalf("InspectDataRowRecord returned %v", err)
+	}
+
+	if len(report.Problems) != 2 || report.IntermediateKey.Exists || report.SystemKey != nil || report.CiphertextSize != 4 {
+		t.Errorf("Expected a foreign, missing intermediate key got %+v", report)
+	}
+
+	report, err = InspectDataRowRecord(context.Background(), handle, &appencryption.DataRowRecord{})
+	if err != nil || len(report.Problems) != 1 || report.IntermediateKey != nil {
+		t.Errorf("Expected a record without a key to be reported got %+v, %v", report, err)
+	}
+}
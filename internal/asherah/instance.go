@@ -0,0 +1,478 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/crypto/aead"
+	"github.com/godaddy/asherah/go/securememory/memguard"
+)
+
+// DefaultInstance is the handle of the instance configured by Setup.
+const DefaultInstance int64 = 0
+
+var ErrInstanceNotFound = errors.New("asherah instance not found")
+var ErrAsherahTimeout = errors.New("asherah operation timed out")
+
+// ErrGetSessionFailed wraps the error of an operation that could not get a session for its
+// partition.
+var ErrGetSessionFailed = errors.New("failed to get session")
+
+var (
+	instancesLock  sync.RWMutex
+	instances      = map[int64]*Instance{}
+	lastInstanceID int64
+)
+
+// Instance is a session factory bound to a single service, product and metastore. Operations
+// hold lock for reading; Reconfigure and Close hold it for writing. RotateKeys and RevokeKey are
+// serialized by keysLock and only hold lock for writing while replacing the session factory.
+type Instance struct {
+	lock           sync.RWMutex
+	keysLock       sync.Mutex
+	sessionFactory *appencryption.SessionFactory
+	metastore      appencryption.Metastore
+	kms            appencryption.KeyManagementService
+	options        *Options
+	metricsServer  *metricsServer
+	tracer         trace.Tracer
+	tracerProvider *sdktrace.TracerProvider
+	closed         int32
+}
+
+func newInstance(options *Options) (*Instance, error) {
+	if err := options.Validate(); err != nil {
+		log.ErrorLogf("Invalid configuration: %v", err)
+		return nil, err
+	}
+
+	crypto := aead.NewAES256GCM()
+
+	applyDefaults(options)
+
+	metastore, err := NewMetastore(options)
+	if err != nil {
+		return nil, err
+	}
+
+	kms, err := NewKMS(options, crypto)
+	if err != nil {
+		if options.Metastore == "rdbms" {
+			closeConnection(sqlMetastoreDBType(options), options.ConnectionString)
+		}
+		return nil, err
+	}
+
+	if options.EnableMetrics || options.MetricsListenAddress != "" {
+		metricsEnabled.Store(true)
+	}
+
+	// Always metered, so an instance created before metrics are enabled is recorded once they are
+	metastore = meteredMetastore{metastore}
+	kms = meteredKMS{kms}
+
+	tracer := noopTracer
+	var tracerProvider *sdktrace.TracerProvider
+	if options.TracingEndpoint != "" {
+		tracerProvider, err = newTracerProvider(options)
+		if err != nil {
+			if options.Metastore == "rdbms" {
+				closeConnection(sqlMetastoreDBType(options), options.ConnectionString)
+			}
+			return nil, err
+		}
+		tracer = tracerProvider.Tracer(TracerName)
+		metastore = tracedMetastore{metastore, tracer}
+		kms = tracedKMS{kms, tracer}
+	}
+
+	sessionFactory := newSessionFactory(options, metastore, kms, crypto)
+	if sessionFactory == nil {
+		log.ErrorLog("Failed to create session factory")
+		if tracerProvider != nil {
+			shutdownTracerProvider(tracerProvider)
+		}
+		if options.Metastore == "rdbms" {
+			closeConnection(sqlMetastoreDBType(options), options.ConnectionString)
+		}
+		return nil, ErrAsherahFailedInitialization
+	}
+
+	var server *metricsServer
+	if options.MetricsListenAddress != "" {
+		server, err = startMetricsServer(options.MetricsListenAddress)
+		if err != nil {
+			sessionFactory.Close()
+			if tracerProvider != nil {
+				shutdownTracerProvider(tracerProvider)
+			}
+			if options.Metastore == "rdbms" {
+				closeConnection(sqlMetastoreDBType(options), options.ConnectionString)
+			}
+			return nil, err
+		}
+	}
+
+	return &Instance{
+		sessionFactory: sessionFactory,
+		metastore:      metastore,
+		kms:            kms,
+		options:        options,
+		metricsServer:  server,
+		tracer:         tracer,
+		tracerProvider: tracerProvider,
+	}, nil
+}
+
+// applyDefaults replaces unset cache and key durations and sizes with the Asherah defaults.
+func applyDefaults(options *Options) {
+	if options.SessionCacheMaxSize == 0 {
+		options.SessionCacheMaxSize = appencryption.DefaultSessionCacheMaxSize
+	}
+
+	if options.SessionCacheDuration == 0 {
+		options.SessionCacheDuration = appencryption.DefaultSessionCacheDuration
+	}
+
+	if options.ExpireAfter == 0 {
+		options.ExpireAfter = appencryption.DefaultExpireAfter
+	}
+
+	if options.CheckInterval == 0 {
+		options.CheckInterval = appencryption.DefaultRevokedCheckInterval
+	}
+}
+
+func newSessionFactory(options *Options, metastore appencryption.Metastore, kms appencryption.KeyManagementService, crypto appencryption.AEAD) *appencryption.SessionFactory {
+	return appencryption.NewSessionFactory(
+		&appencryption.Config{
+			Service: options.ServiceName,
+			Product: options.ProductID,
+			Policy:  NewCryptoPolicy(options),
+		},
+		metastore,
+		kms,
+		crypto,
+		appencryption.WithSecretFactory(new(memguard.SecretFactory)),
+		appencryption.WithMetrics(metricsEnabled.Load()),
+	)
+}
+
+// resetSessionFactory replaces the session factory with a new one over the same metastore and KMS,
+// so its session and key caches start empty. It holds lock for writing.
+func (i *Instance) resetSessionFactory() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if err := i.checkOpen(); err != nil {
+		return err
+	}
+
+	factory := newSessionFactory(i.options, i.metastore, i.kms, i.sessionFactory.Crypto)
+	if factory == nil {
+		return ErrAsherahFailedInitialization
+	}
+
+	i.sessionFactory.Close()
+	i.sessionFactory = factory
+
+	return nil
+}
+
+// Close releases the session factory, metrics listener, tracer and any database connection held by
+// the instance, after waiting for in-flight operations to finish.
+func (i *Instance) Close() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if atomic.CompareAndSwapInt32(&i.closed, 0, 1) {
+		if i.metricsServer != nil {
+			i.metricsServer.Close()
+		}
+		i.sessionFactory.Close()
+		if i.options.Metastore == "rdbms" {
+			closeConnection(sqlMetastoreDBType(i.options), i.options.ConnectionString)
+		}
+		if i.tracerProvider != nil {
+			if err := shutdownTracerProvider(i.tracerProvider); err != nil {
+				log.ErrorLogf("Failed to flush trace spans: %v", err)
+			}
+		}
+	}
+}
+
+// newContext returns the context for one operation. A positive timeout overrides the configured OperationTimeout.
+func (i *Instance) newContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = i.options.OperationTimeout
+	}
+
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+
+	return context.WithTimeout(parent, timeout)
+}
+
+// timeoutError reports a failure caused by an expired deadline as ErrAsherahTimeout.
+func timeoutError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrAsherahTimeout, err)
+	}
+
+	return err
+}
+
+// checkOpen returns ErrAsherahNotInitialized once the instance is closed. Callers that obtained the
+// instance before DestroyInstance or Shutdown must not use its session factory or connection after
+// taking lock.
+func (i *Instance) checkOpen() error {
+	if atomic.LoadInt32(&i.closed) != 0 {
+		return ErrAsherahNotInitialized
+	}
+
+	return nil
+}
+
+func (i *Instance) getSession(ctx context.Context, partitionId string) (*appencryption.Session, error) {
+	if err := i.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	_, span := i.tracer.Start(ctx, "asherah.GetSession")
+	start := time.Now()
+	session, err := i.sessionFactory.GetSession(partitionId)
+	recordOperation(sessionTimer, sessionErrors, start, err)
+	endSpan(span, err)
+	if err != nil {
+		log.ErrorLogf("Failed to get session for partition %v: %v", partitionId, err.Error())
+		return nil, fmt.Errorf("%w: %w", ErrGetSessionFailed, err)
+	}
+
+	if metricsEnabled.Load() && i.sessionFactory.Config.Policy.CacheSessions {
+		cachedSessions.record(session)
+	}
+
+	return session, nil
+}
+
+// Encrypt encrypts data for partitionId. Spans join any trace carried by ctx.
+func (i *Instance) Encrypt(ctx context.Context, partitionId string, data []byte, timeout time.Duration) (drr *appencryption.DataRowRecord, err error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	ctx, span := i.tracer.Start(ctx, "asherah.Encrypt", trace.WithAttributes(attribute.String("asherah.partition", partitionId)))
+	defer func() { endSpan(span, err) }()
+
+	session, err := i.getSession(ctx, partitionId)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	ctx, cancel := i.newContext(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	drr, err = session.Encrypt(ctx, data)
+	recordOperation(encryptTimer, encryptErrors, start, err)
+	return drr, timeoutError(ctx, err)
+}
+
+// Decrypt decrypts drr for partitionId. Spans join any trace carried by ctx.
+func (i *Instance) Decrypt(ctx context.Context, partitionId string, drr *appencryption.DataRowRecord, timeout time.Duration) (data []byte, err error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	ctx, span := i.tracer.Start(ctx, "asherah.Decrypt", trace.WithAttributes(attribute.String("asherah.partition", partitionId)))
+	defer func() { endSpan(span, err) }()
+
+	session, err := i.getSession(ctx, partitionId)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	ctx, cancel := i.newContext(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	data, err = session.Decrypt(ctx, *drr)
+	recordOperation(decryptTimer, decryptErrors, start, err)
+	return data, timeoutError(ctx, err)
+}
+
+// CreateInstance configures a new instance independent of the default one and returns its handle.
+func CreateInstance(options *Options) (int64, error) {
+	instance, err := newInstance(options)
+	if err != nil {
+		return 0, err
+	}
+
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+
+	lastInstanceID++
+	instances[lastInstanceID] = instance
+
+	return lastInstanceID, nil
+}
+
+// DestroyInstance closes the instance identified by handle and releases the handle.
+func DestroyInstance(handle int64) error {
+	if handle == DefaultInstance {
+		Shutdown()
+		return nil
+	}
+
+	instancesLock.Lock()
+	instance, ok := instances[handle]
+	delete(instances, handle)
+	instancesLock.Unlock()
+
+	if !ok {
+		log.ErrorLogf("Failed to destroy instance %v: no such instance", handle)
+		return ErrInstanceNotFound
+	}
+
+	instance.Close()
+	return nil
+}
+
+func getInstance(handle int64) (*Instance, error) {
+	if handle == DefaultInstance {
+		instance := globalInstance.Load()
+		if instance == nil {
+			return nil, ErrAsherahNotInitialized
+		}
+		return instance, nil
+	}
+
+	instancesLock.RLock()
+	defer instancesLock.RUnlock()
+
+	instance, ok := instances[handle]
+	if !ok {
+		return nil, ErrInstanceNotFound
+	}
+
+	return instance, nil
+}
+
+// EncryptWithInstance encrypts data using the instance identified by handle. A positive timeout
+// overrides the instance's OperationTimeout.
+func EncryptWithInstance(ctx context.Context, handle int64, partitionId string, data []byte, timeout time.Duration) (*appencryption.DataRowRecord, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to encrypt data: instance %v: %v", handle, err)
+		return nil, err
+	}
+
+	return instance.Encrypt(ctx, partitionId, data, timeout)
+}
+
+// DecryptWithInstance decrypts drr using the instance identified by handle. A positive timeout
+// overrides the instance's OperationTimeout.
+func DecryptWithInstance(ctx context.Context, handle int64, partitionId string, drr *appencryption.DataRowRecord, timeout time.Duration) ([]byte, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to decrypt data: instance %v: %v", handle, err)
+		return nil, err
+	}
+
+	return instance.Decrypt(ctx, partitionId, drr, timeout)
+}
+
+// EncryptBatch encrypts each payload with a single session for partitionId. Each payload gets its own
+// OperationTimeout deadline. The returned error is only set
+// when no payload could be attempted; per-payload failures are reported in the returned error slice.
+func (i *Instance) EncryptBatch(partitionId string, data [][]byte) ([]*appencryption.DataRowRecord, []error, error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	parent, span := i.tracer.Start(context.Background(), "asherah.EncryptBatch", trace.WithAttributes(
+		attribute.String("asherah.partition", partitionId), attribute.Int("asherah.batch_size", len(data))))
+	defer span.End()
+
+	session, err := i.getSession(parent, partitionId)
+	if err != nil {
+		spanError(span, err)
+		return nil, nil, err
+	}
+	defer session.Close()
+
+	drrs := make([]*appencryption.DataRowRecord, len(data))
+	errs := make([]error, len(data))
+	for n, payload := range data {
+		ctx, cancel := i.newContext(parent, 0)
+		start := time.Now()
+		drrs[n], err = session.Encrypt(ctx, payload)
+		recordOperation(encryptTimer, encryptErrors, start, err)
+		errs[n] = timeoutError(ctx, err)
+		cancel()
+	}
+
+	return drrs, errs, nil
+}
+
+// DecryptBatch decrypts each DataRowRecord with a single session for partitionId. Each record gets its own
+// OperationTimeout deadline. The returned error is only
+// set when no record could be attempted; per-record failures are reported in the returned error slice.
+func (i *Instance) DecryptBatch(partitionId string, drrs []appencryption.DataRowRecord) ([][]byte, []error, error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	parent, span := i.tracer.Start(context.Background(), "asherah.DecryptBatch", trace.WithAttributes(
+		attribute.String("asherah.partition", partitionId), attribute.Int("asherah.batch_size", len(drrs))))
+	defer span.End()
+
+	session, err := i.getSession(parent, partitionId)
+	if err != nil {
+		spanError(span, err)
+		return nil, nil, err
+	}
+	defer session.Close()
+
+	data := make([][]byte, len(drrs))
+	errs := make([]error, len(drrs))
+	for n, drr := range drrs {
+		ctx, cancel := i.newContext(parent, 0)
+		start := time.Now()
+		data[n], err = session.Decrypt(ctx, drr)
+		recordOperation(decryptTimer, decryptErrors, start, err)
+		errs[n] = timeoutError(ctx, err)
+		cancel()
+	}
+
+	return data, errs, nil
+}
+
+func EncryptBatchWithInstance(handle int64, partitionId string, data [][]byte) ([]*appencryption.DataRowRecord, []error, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to encrypt batch: instance %v: %v", handle, err)
+		return nil, nil, err
+	}
+
+	return instance.EncryptBatch(partitionId, data)
+}
+
+func DecryptBatchWithInstance(handle int64, partitionId string, drrs []appencryption.DataRowRecord) ([][]byte, []error, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to decrypt batch: instance %v: %v", handle, err)
+		return nil, nil, err
+	}
+
+	return instance.DecryptBatch(partitionId, drrs)
+}
@@ -0,0 +1,94 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/crypto/aead"
+	"github.com/godaddy/asherah/go/appencryption/pkg/kms"
+)
+
+// blockingMetastore never answers until the caller's context is done, like a hung database.
+type blockingMetastore struct{}
+
+func (blockingMetastore) Load(ctx context.Context, _ string, _ int64) (*appencryption.EnvelopeKeyRecord, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingMetastore) LoadLatest(ctx context.Context, _ string) (*appencryption.EnvelopeKeyRecord, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingMetastore) Store(ctx context.Context, _ string, _ int64, _ *appencryption.EnvelopeKeyRecord) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func newBlockingInstance(t *testing.T, timeout time.Duration) *Instance {
+	crypto := aead.NewAES256GCM()
+	m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", crypto)
+	if err != nil {
+		t.Fatalf("kms.NewStatic returned %v", err)
+	}
+
+	return &Instance{
+		sessionFactory: appencryption.NewSessionFactory(
+			&appencryption.Config{Service: "TestService", Product: "TestProduct"},
+			blockingMetastore{},
+			m,
+			crypto,
+		),
+		metastore: blockingMetastore{},
+		kms:       m,
+		options:   &Options{OperationTimeout: timeout},
+		tracer:    noopTracer,
+	}
+}
+
+func TestInstanceEncryptOperationTimeout(t *testing.T) {
+	instance := newBlockingInstance(t, 10*time.Millisecond)
+	defer instance.sessionFactory.Close()
+
+	_, err := instance.Encrypt(context.Background(), "Partition", []byte("InputData"), 0)
+	if !errors.Is(err, ErrAsherahTimeout) {
+		t.Errorf("Expected ErrAsherahTimeout, got %v", err)
+	}
+}
+
+func TestInstanceEncryptPerCallTimeoutOverridesOption(t *testing.T) {
+	instance := newBlockingInstance(t, time.Hour)
+	defer instance.sessionFactory.Close()
+
+	start := time.Now()
+	_, err := instance.Encrypt(context.Background(), "Partition", []byte("InputData"), 10*time.Millisecond)
+	if !errors.Is(err, ErrAsherahTimeout) {
+		t.Errorf("Expected ErrAsherahTimeout, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Minute {
+		t.Errorf("Per-call timeout was not applied, took %v", elapsed)
+	}
+}
+
+func TestDestroyedInstanceRejectsOperations(t *testing.T) {
+	handle, err := CreateInstance(&Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static"})
+	if err != nil {
+		t.Fatalf("CreateInstance returned %v", err)
+	}
+	instance, _ := getInstance(handle)
+	if err := DestroyInstance(handle); err != nil {
+		t.Fatalf("DestroyInstance returned %v", err)
+	}
+
+	if _, err := instance.Encrypt(context.Background(), "partition", []byte("data"), 0); err != ErrAsherahNotInitialized {
+		t.Errorf("Encrypt: expected ErrAsherahNotInitialized got %v", err)
+	}
+	if _, _, err := instance.DecryptBatch("partition", nil); err != ErrAsherahNotInitialized {
+		t.Errorf("DecryptBatch: expected ErrAsherahNotInitialized got %v", err)
+	}
+}
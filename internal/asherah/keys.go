@@ -0,0 +1,269 @@
+package asherah
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+const (
+	revokeKeyQuery = "UPDATE encryption_key SET key_record = ? WHERE id = ? AND created = ?"
+
+	dynamoDBPartitionKey = "Id"
+	dynamoDBSortKey      = "Created"
+	dynamoDBKeyRecord    = "KeyRecord"
+)
+
+// dynamoDBUpdater is implemented by the DynamoDB client behind persistence.DynamoDBMetastore. The
+// metastore only exposes the calls it makes itself.
+type dynamoDBUpdater interface {
+	UpdateItemWithContext(aws.Context, *dynamodb.UpdateItemInput, ...request.Option) (*dynamodb.UpdateItemOutput, error)
+}
+
+// unwrapMetastore returns the metastore underneath any metrics and tracing wrappers.
+func unwrapMetastore(metastore appencryption.Metastore) appencryption.Metastore {
+	for {
+		switch m := metastore.(type) {
+		case meteredMetastore:
+			metastore = m.Metastore
+		case tracedMetastore:
+			metastore = m.Metastore
+		default:
+			return metastore
+		}
+	}
+}
+
+// keyIDSuffix returns the region suffix Asherah appends to the key IDs of this instance, including
+// the separator, or "".
+func (i *Instance) keyIDSuffix() string {
+	if suffix := regionSuffix(i.metastore); suffix != "" {
+		return "_" + suffix
+	}
+
+	return ""
+}
+
+// systemKeyID returns the metastore ID of the system key shared by every partition of the instance.
+func (i *Instance) systemKeyID() string {
+	return fmt.Sprintf("_SK_%s_%s%s", i.options.ServiceName, i.options.ProductID, i.keyIDSuffix())
+}
+
+// intermediateKeyID returns the metastore ID of the intermediate key for partitionId.
+func (i *Instance) intermediateKeyID(partitionId string) string {
+	return fmt.Sprintf("_IK_%s_%s_%s%s", partitionId, i.options.ServiceName, i.options.ProductID, i.keyIDSuffix())
+}
+
+// keyPartition returns the partition of the intermediate key id, and false if id is not an
+// intermediate key of the instance.
+func (i *Instance) keyPartition(id string) (string, bool) {
+	suffix := fmt.Sprintf("_%s_%s%s", i.options.ServiceName, i.options.ProductID, i.keyIDSuffix())
+	if !strings.HasPrefix(id, "_IK_") || !strings.HasSuffix(id, suffix) || len(id) < len("_IK_")+len(suffix) {
+		return "", false
+	}
+
+	return id[len("_IK_") : len(id)-len(suffix)], true
+}
+
+// ownsKey reports whether id is the system key or the intermediate key of a partition of the instance.
+func (i *Instance) ownsKey(id string) bool {
+	_, ok := i.keyPartition(id)
+	return ok || id == i.systemKeyID()
+}
+
+// keyExpired reports whether a key created at created has outlived expireAfter.
+func keyExpired(created int64, expireAfter time.Duration) bool {
+	return time.Now().After(time.Unix(created, 0).Add(expireAfter))
+}
+
+// RevokeKey revokes a key of the instance identified by handle. See Instance.RevokeKey.
+func RevokeKey(ctx context.Context, handle int64, meta appencryption.KeyMeta) error {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to revoke key: instance %v: %v", handle, err)
+		return err
+	}
+
+	return instance.RevokeKey(ctx, meta)
+}
+
+// RevokeKey marks the system or intermediate key identified by meta revoked, as returned in the
+// ParentKeyMeta of a DataRowRecord or an intermediate key. If it is the latest key for its ID a
+// replacement is stored, since Asherah would otherwise keep using a revoked key created within the
+// current minute. Revoking a system key also forces a new intermediate key for every partition on
+// its next write. Caches of this instance are emptied; other processes stop using the key after
+// their CheckInterval. It returns ErrKeyNotFound if no such key is stored.
+func (i *Instance) RevokeKey(ctx context.Context, meta appencryption.KeyMeta) error {
+	i.keysLock.Lock()
+	defer i.keysLock.Unlock()
+
+	if err := i.revokeAndReplaceKey(ctx, meta); err != nil {
+		return err
+	}
+
+	return i.resetSessionFactory()
+}
+
+// revokeAndReplaceKey revokes the key of RevokeKey and stores its replacement, holding lock for
+// reading so encrypt and decrypt continue meanwhile.
+func (i *Instance) revokeAndReplaceKey(ctx context.Context, meta appencryption.KeyMeta) (err error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	if err := i.checkOpen(); err != nil {
+		return err
+	}
+
+	if !i.ownsKey(meta.ID) {
+		return ValidationError{{Field: "KeyId", Message: fmt.Sprintf("'%s' is not a system or intermediate key of service '%s' and product '%s'",
+			meta.ID, i.options.ServiceName, i.options.ProductID)}}
+	}
+
+	ctx, span := i.tracer.Start(ctx, "asherah.RevokeKey", trace.WithAttributes(
+		attribute.String("asherah.key_id", meta.ID), attribute.Int64("asherah.key_created", meta.Created)))
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := i.newContext(ctx, 0)
+	defer cancel()
+
+	latest, err := i.loadLatestKey(ctx, meta.ID)
+	if err != nil {
+		return timeoutError(ctx, err)
+	}
+
+	if err = i.revokeKey(ctx, meta.ID, meta.Created); err != nil {
+		return timeoutError(ctx, err)
+	}
+
+	if latest != nil && latest.Created == meta.Created {
+		if meta.ID == i.systemKeyID() {
+			_, err = i.rotateSystemKey(ctx)
+		} else {
+			err = i.rotateIntermediateKey(ctx, meta.ID, nil)
+		}
+		if err != nil {
+			return timeoutError(ctx, err)
+		}
+	}
+
+	log.DebugLogf("Revoked key %s created %d", meta.ID, meta.Created)
+
+	return nil
+}
+
+// revokeKey marks the key stored as id and created revoked. Keys are never deleted, so data
+// encrypted under a revoked key can still be decrypted; Asherah stops using it for new writes.
+func (i *Instance) revokeKey(ctx context.Context, id string, created int64) error {
+	ekr, err := i.metastore.Load(ctx, id, created)
+	if err != nil {
+		return fmt.Errorf("%w: failed to load key %s created %d: %w", ErrMetastoreFailed, id, created, err)
+	}
+	if ekr == nil {
+		return fmt.Errorf("%w: %s created %d", ErrKeyNotFound, id, created)
+	}
+	if ekr.Revoked {
+		return nil
+	}
+
+	key := *ekr
+	key.ID = id
+	if err = revokeStoredKey(ctx, i.metastore, i.options, &key); err != nil {
+		return fmt.Errorf("%w: failed to revoke key %s created %d: %w", ErrMetastoreFailed, id, created, err)
+	}
+
+	return nil
+}
+
+// revokeStoredKey marks ekr revoked in metastore, created from opts. ekr.ID must be set.
+func revokeStoredKey(ctx context.Context, metastore appencryption.Metastore, opts *Options, ekr *appencryption.EnvelopeKeyRecord) error {
+	switch metastore := unwrapMetastore(metastore).(type) {
+	case *persistence.MemoryMetastore:
+		metastore.Lock()
+		defer metastore.Unlock()
+
+		revoked := *metastore.Envelopes[ekr.ID][ekr.Created]
+		revoked.Revoked = true
+		metastore.Envelopes[ekr.ID][ekr.Created] = &revoked
+
+		return nil
+	case *persistence.SQLMetastore:
+		return revokeSQLKey(ctx, opts, ekr)
+	case *persistence.DynamoDBMetastore:
+		return revokeDynamoDBKey(ctx, metastore, ekr.ID, ekr.Created)
+	default:
+		return fmt.Errorf("%T does not support revoking keys", metastore)
+	}
+}
+
+// revokeSQLKey rewrites the key_record of the key with Revoked set. The SQL metastore stores the
+// record as the JSON encoding of the EnvelopeKeyRecord.
+func revokeSQLKey(ctx context.Context, opts *Options, ekr *appencryption.EnvelopeKeyRecord) error {
+	dbType := sqlMetastoreDBType(opts)
+	db, err := getConnection(dbType, opts.ConnectionString)
+	if err != nil {
+		return err
+	}
+
+	revoked := *ekr
+	revoked.Revoked = true
+	record, err := json.Marshal(&revoked)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, sqlPlaceholders(dbType, revokeKeyQuery), string(record), ekr.ID, time.Unix(ekr.Created, 0))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// revokeDynamoDBKey sets KeyRecord.Revoked on the item of the key.
+func revokeDynamoDBKey(ctx context.Context, metastore *persistence.DynamoDBMetastore, id string, created int64) error {
+	client, ok := metastore.GetClient().(dynamoDBUpdater)
+	if !ok {
+		return fmt.Errorf("DynamoDB client %T does not support UpdateItem", metastore.GetClient())
+	}
+
+	_, err := client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(metastore.GetTableName()),
+		Key: map[string]*dynamodb.AttributeValue{
+			dynamoDBPartitionKey: {S: aws.String(id)},
+			dynamoDBSortKey:      {N: aws.String(strconv.FormatInt(created, 10))},
+		},
+		UpdateExpression:    aws.String("SET #record.#revoked = :revoked"),
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":      aws.String(dynamoDBPartitionKey),
+			"#record":  aws.String(dynamoDBKeyRecord),
+			"#revoked": aws.String("Revoked"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":revoked": {BOOL: aws.Bool(true)},
+		},
+	})
+
+	return err
+}
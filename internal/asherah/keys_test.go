@@ -0,0 +1,173 @@
+package asherah
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+type updatingDynamoDBClient struct {
+	persistence.DynamoDBClientAPI
+	input *dynamodb.UpdateItemInput
+}
+
+func (c *updatingDynamoDBClient) UpdateItemWithContext(_ aws.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	c.input = input
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestSQLPlaceholders(t *testing.T) {
+	for dbType, expected := range map[string]string{
+		"mysql":    "UPDATE encryption_key SET key_record = ? WHERE id = ? AND created = ?",
+		"postgres": "UPDATE encryption_key SET key_record = $1 WHERE id = $2 AND created = $3",
+		"oracle":   "UPDATE encryption_key SET key_record = :1 WHERE id = :2 AND created = :3",
+	} {
+		if got := sqlPlaceholders(dbType, revokeKeyQuery); got != expected {
+			t.Errorf("%v: expected %q got %q", dbType, expected, got)
+		}
+	}
+}
+
+func TestUnwrapMetastore(t *testing.T) {
+	memory := persistence.NewMemoryMetastore()
+	if got := unwrapMetastore(tracedMetastore{Metastore: meteredMetastore{memory}}); got != memory {
+		t.Errorf("Expected the memory metastore got %T", got)
+	}
+}
+
+func TestRevokeKeyMemory(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	drr := testEncrypt(t, handle, "partition")
+	meta := drr.Key.ParentKeyMeta
+
+	if err := instance.revokeKey(context.Background(), meta.ID, meta.Created); err != nil {
+		t.Fatalf("revokeKey returned %v", err)
+	}
+	if ik := testLoadKey(t, instance, meta.ID, meta.Created); !ik.Revoked {
+		t.Error("Expected the key to be revoked")
+	}
+
+	if err := instance.revokeKey(context.Background(), meta.ID, meta.Created+1); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound got %v", err)
+	}
+}
+
+func TestRevokeDynamoDBKey(t *testing.T) {
+	sess, err := awssession.NewSession(&aws.Config{Region: aws.String("us-west-2")})
+	if err != nil {
+		t.Fatalf("NewSession returned %v", err)
+	}
+
+	client := &updatingDynamoDBClient{}
+	metastore := persistence.NewDynamoDBMetastore(sess, persistence.WithClient(client), persistence.WithTableName("Keys"))
+
+	if err := revokeDynamoDBKey(context.Background(), metastore, "_SK_s_p", 1700000000); err != nil {
+		t.Fatalf("revokeDynamoDBKey returned %v", err)
+	}
+
+	input := client.input
+	if *input.TableName != "Keys" || *input.Key["Id"].S != "_SK_s_p" || *input.Key["Created"].N != "1700000000" {
+		t.Errorf("Unexpected key %v in table %v", input.Key, *input.TableName)
+	}
+	if !*input.ExpressionAttributeValues[":revoked"].BOOL || *input.ExpressionAttributeNames["#record"] != "KeyRecord" {
+		t.Errorf("Unexpected update %v", input)
+	}
+}
+
+func TestRevokeSQLKey(t *testing.T) {
+	ekr := &appencryption.EnvelopeKeyRecord{ID: "_IK_a_s_p", Created: 1700000000, EncryptedKey: []byte("key"),
+		ParentKeyMeta: &appencryption.KeyMeta{ID: "_SK_s_p", Created: 1699999940}}
+	record := `{"Revoked":true,"Created":1700000000,"Key":"a2V5","ParentKeyMeta":{"KeyId":"_SK_s_p","Created":1699999940}}`
+
+	for dbType, query := range map[string]string{
+		"mysql":    revokeKeyQuery,
+		"postgres": "UPDATE encryption_key SET key_record = $1 WHERE id = $2 AND created = $3",
+	} {
+		opts := &Options{Metastore: "rdbms", SQLMetastoreDBType: dbType, ConnectionString: "revoke-sql-key"}
+		_, mock := newMockConnection(t, dbType, opts.ConnectionString)
+		mock.ExpectExec(query).WithArgs(record, "_IK_a_s_p", time.Unix(1700000000, 0)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := revokeSQLKey(context.Background(), opts, ekr); err != nil {
+			t.Errorf("%v: revokeSQLKey returned %v", dbType, err)
+		}
+		if ekr.Revoked {
+			t.Errorf("%v: expected the record passed in to be left unchanged", dbType)
+		}
+	}
+}
+
+func TestRevokeSQLKeyNotFound(t *testing.T) {
+	opts := &Options{Metastore: "rdbms", ConnectionString: "revoke-sql-key-not-found"}
+	_, mock := newMockConnection(t, "mysql", opts.ConnectionString)
+	mock.ExpectExec(revokeKeyQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := revokeSQLKey(context.Background(), opts, &appencryption.EnvelopeKeyRecord{ID: "_SK_s_p", Created: 1700000000})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows got %v", err)
+	}
+}
+
+func TestRevokeLatestIntermediateKeyRollsToFreshKey(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	before := testEncrypt(t, handle, "partition")
+
+	if err := RevokeKey(context.Background(), handle, *before.Key.ParentKeyMeta); err != nil {
+		t.Fatalf("RevokeKey returned %v", err)
+	}
+
+	if ik := testLoadKey(t, instance, before.Key.ParentKeyMeta.ID, before.Key.ParentKeyMeta.Created); !ik.Revoked {
+		t.Error("Expected the key to be revoked")
+	}
+
+	after := testEncrypt(t, handle, "partition")
+	if after.Key.ParentKeyMeta.Created <= before.Key.ParentKeyMeta.Created {
+		t.Errorf("Expected a fresh intermediate key got %+v", after.Key.ParentKeyMeta)
+	}
+
+	data, err := DecryptWithInstance(context.Background(), handle, "partition", before, 0)
+	if err != nil || string(data) != "data" {
+		t.Errorf("Expected to decrypt data written before revocation got %q, %v", data, err)
+	}
+}
+
+func TestRevokeLatestSystemKeyRollsToFreshKey(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	drr := testEncrypt(t, handle, "partition")
+	ik := testLoadKey(t, instance, drr.Key.ParentKeyMeta.ID, drr.Key.ParentKeyMeta.Created)
+
+	if err := RevokeKey(context.Background(), handle, *ik.ParentKeyMeta); err != nil {
+		t.Fatalf("RevokeKey returned %v", err)
+	}
+
+	sk, err := instance.metastore.LoadLatest(context.Background(), instance.systemKeyID())
+	if err != nil || sk == nil || sk.Revoked || sk.Created <= ik.ParentKeyMeta.Created {
+		t.Errorf("Expected a fresh system key got %+v, %v", sk, err)
+	}
+}
+
+func TestRevokeKeyRejectsOtherKeys(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+
+	for _, id := range []string{"", "_SK_other_p", "_IK_partition_s_other", "_IK_partition_other_p"} {
+		if err := RevokeKey(context.Background(), handle, appencryption.KeyMeta{ID: id, Created: 1}); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%q: expected ErrInvalidConfig got %v", id, err)
+		}
+	}
+
+	if err := RevokeKey(context.Background(), handle, appencryption.KeyMeta{ID: "_IK_partition_s_p", Created: 1}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound got %v", err)
+	}
+}
@@ -0,0 +1,443 @@
+package asherah
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+const (
+	KeyTypeSystem       = "system"
+	KeyTypeIntermediate = "intermediate"
+
+	defaultListKeysLimit = 100
+	maxListKeysLimit     = 1000
+
+	// maxListKeysBatches bounds the metastore reads of a single ListKeys call, so a table holding
+	// mostly keys of other services returns a short page rather than being read in one call.
+	maxListKeysBatches = 10
+
+	listKeysQuery      = "SELECT id, key_record FROM encryption_key ORDER BY id, created LIMIT ?"
+	listKeysAfterQuery = "SELECT id, key_record FROM encryption_key WHERE id > ? OR (id = ? AND created > ?) ORDER BY id, created LIMIT ?"
+	listKeyQuery       = "SELECT id, key_record FROM encryption_key WHERE id = ? ORDER BY created LIMIT ?"
+	listKeyAfterQuery  = "SELECT id, key_record FROM encryption_key WHERE id = ? AND created > ? ORDER BY created LIMIT ?"
+)
+
+// KeyFilter selects the keys returned by ListKeys. Type is KeyTypeSystem, KeyTypeIntermediate or
+// empty for both. Partition restricts the result to the intermediate keys of one partition. Limit
+// defaults to 100 and may be at most 1000. PageToken is the NextPageToken of the previous page.
+type KeyFilter struct {
+	Type      string `json:"Type,omitempty"`
+	Partition string `json:"Partition,omitempty"`
+	Limit     int    `json:"Limit,omitempty"`
+	PageToken string `json:"PageToken,omitempty"`
+}
+
+// KeyListing describes a stored system or intermediate key and the components of its ID.
+type KeyListing struct {
+	ID            string                 `json:"KeyId"`
+	Created       int64                  `json:"Created"`
+	Revoked       bool                   `json:"Revoked"`
+	Type          string                 `json:"Type"`
+	Partition     string                 `json:"Partition,omitempty"`
+	Service       string                 `json:"Service"`
+	Product       string                 `json:"Product"`
+	RegionSuffix  string                 `json:"RegionSuffix,omitempty"`
+	ParentKeyMeta *appencryption.KeyMeta `json:"ParentKeyMeta,omitempty"`
+}
+
+// KeyPage is a page of ListKeys. More keys may follow while NextPageToken is set, even if Keys
+// holds fewer than Limit keys.
+type KeyPage struct {
+	Keys          []KeyListing `json:"Keys"`
+	NextPageToken string       `json:"NextPageToken,omitempty"`
+}
+
+// keyCursor is the position of the last key read from the metastore, in (id, created) order for
+// the SQL and memory metastores and the DynamoDB ExclusiveStartKey otherwise. It is encoded as the
+// page token.
+type keyCursor struct {
+	ID      string `json:"KeyId"`
+	Created int64  `json:"Created"`
+}
+
+func (c *keyCursor) token() string {
+	if c == nil {
+		return ""
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseKeyCursor(token string) (*keyCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor keyCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+// keyScanner reads up to limit keys stored as id, or all keys if id is empty, following after. It
+// returns the cursor of the last key read, or nil once no keys follow.
+type keyScanner func(ctx context.Context, id string, after *keyCursor, limit int) ([]*appencryption.EnvelopeKeyRecord, *keyCursor, error)
+
+// dynamoDBScanner is implemented by the DynamoDB client behind persistence.DynamoDBMetastore.
+type dynamoDBScanner interface {
+	ScanWithContext(aws.Context, *dynamodb.ScanInput, ...request.Option) (*dynamodb.ScanOutput, error)
+}
+
+// ListKeys lists keys of the instance identified by handle. See Instance.ListKeys.
+func ListKeys(ctx context.Context, handle int64, filter KeyFilter) (*KeyPage, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to list keys: instance %v: %v", handle, err)
+		return nil, err
+	}
+
+	return instance.ListKeys(ctx, filter)
+}
+
+// ListKeys returns a page of the system and intermediate keys of the instance's service and
+// product stored in the metastore, ordered by ID and created time except for DynamoDB, which
+// returns them in table order. Keys of other services, products and regions are skipped.
+func (i *Instance) ListKeys(ctx context.Context, filter KeyFilter) (page *KeyPage, err error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	if err := i.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	if err := validateKeyFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	cursor, err := parseKeyCursor(filter.PageToken)
+	if err != nil {
+		return nil, ValidationError{{Field: "PageToken", Message: fmt.Sprintf("invalid page token: %v", err)}}
+	}
+
+	ctx, span := i.tracer.Start(ctx, "asherah.ListKeys", trace.WithAttributes(
+		attribute.String("asherah.key_type", filter.Type), attribute.Int("asherah.limit", filter.Limit)))
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := i.newContext(ctx, 0)
+	defer cancel()
+
+	scan, err := newKeyScanner(i.metastore, i.options)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	switch {
+	case filter.Type == KeyTypeSystem:
+		id = i.systemKeyID()
+	case filter.Partition != "":
+		id = i.intermediateKeyID(filter.Partition)
+	}
+
+	page = &KeyPage{Keys: []KeyListing{}}
+	for n := 0; n < maxListKeysBatches && len(page.Keys) < filter.Limit; n++ {
+		var keys []*appencryption.EnvelopeKeyRecord
+		keys, cursor, err = scan(ctx, id, cursor, filter.Limit-len(page.Keys))
+		if err != nil {
+			return nil, timeoutError(ctx, fmt.Errorf("%w: failed to list keys: %w", ErrMetastoreFailed, err))
+		}
+
+		for _, key := range keys {
+			if listing, ok := i.keyListing(key, filter); ok {
+				page.Keys = append(page.Keys, listing)
+			}
+		}
+
+		if cursor == nil {
+			break
+		}
+	}
+	page.NextPageToken = cursor.token()
+
+	return page, nil
+}
+
+func validateKeyFilter(filter *KeyFilter) error {
+	var errs ValidationError
+	switch filter.Type {
+	case "", KeyTypeSystem, KeyTypeIntermediate:
+	default:
+		errs = append(errs, FieldError{Field: "Type", Message: fmt.Sprintf("unknown key type '%s', expected '%s' or '%s'",
+			filter.Type, KeyTypeSystem, KeyTypeIntermediate)})
+	}
+	if filter.Partition != "" && filter.Type == KeyTypeSystem {
+		errs = append(errs, FieldError{Field: "Partition", Message: "system keys do not belong to a partition"})
+	}
+	if filter.Limit < 0 || filter.Limit > maxListKeysLimit {
+		errs = append(errs, FieldError{Field: "Limit", Message: fmt.Sprintf("must be between 0 and %d", maxListKeysLimit)})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultListKeysLimit
+	}
+
+	return nil
+}
+
+// keyListing describes key, and returns false if it is not a key of the instance matching filter.
+func (i *Instance) keyListing(key *appencryption.EnvelopeKeyRecord, filter KeyFilter) (KeyListing, bool) {
+	listing := KeyListing{
+		ID:            key.ID,
+		Created:       key.Created,
+		Revoked:       key.Revoked,
+		Service:       i.options.ServiceName,
+		Product:       i.options.ProductID,
+		RegionSuffix:  regionSuffix(i.metastore),
+		ParentKeyMeta: key.ParentKeyMeta,
+	}
+
+	if key.ID == i.systemKeyID() {
+		listing.Type = KeyTypeSystem
+	} else if partition, ok := i.keyPartition(key.ID); ok {
+		listing.Type = KeyTypeIntermediate
+		listing.Partition = partition
+	} else {
+		return KeyListing{}, false
+	}
+
+	if filter.Type != "" && filter.Type != listing.Type {
+		return KeyListing{}, false
+	}
+	if filter.Partition != "" && filter.Partition != listing.Partition {
+		return KeyListing{}, false
+	}
+
+	return listing, true
+}
+
+// newKeyScanner returns the keyScanner for metastore, created from opts.
+func newKeyScanner(metastore appencryption.Metastore, opts *Options) (keyScanner, error) {
+	switch metastore := unwrapMetastore(metastore).(type) {
+	case *persistence.MemoryMetastore:
+		return func(_ context.Context, id string, after *keyCursor, limit int) ([]*appencryption.EnvelopeKeyRecord, *keyCursor, error) {
+			return scanMemoryKeys(metastore, id, after, limit)
+		}, nil
+	case *persistence.SQLMetastore:
+		return func(ctx context.Context, id string, after *keyCursor, limit int) ([]*appencryption.EnvelopeKeyRecord, *keyCursor, error) {
+			return scanSQLKeys(ctx, opts, id, after, limit)
+		}, nil
+	case *persistence.DynamoDBMetastore:
+		return func(ctx context.Context, id string, after *keyCursor, limit int) ([]*appencryption.EnvelopeKeyRecord, *keyCursor, error) {
+			return scanDynamoDBKeys(ctx, metastore, id, after, limit)
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T does not support listing keys", ErrMetastoreFailed, metastore)
+	}
+}
+
+// lastKeyCursor returns the cursor after the last of keys, or nil if fewer than limit were read.
+func lastKeyCursor(keys []*appencryption.EnvelopeKeyRecord, limit int) *keyCursor {
+	if len(keys) < limit {
+		return nil
+	}
+
+	last := keys[len(keys)-1]
+	return &keyCursor{ID: last.ID, Created: last.Created}
+}
+
+func scanMemoryKeys(metastore *persistence.MemoryMetastore, id string, after *keyCursor, limit int) ([]*appencryption.EnvelopeKeyRecord, *keyCursor, error) {
+	metastore.RLock()
+	var keys []*appencryption.EnvelopeKeyRecord
+	for keyID, envelopes := range metastore.Envelopes {
+		if id != "" && keyID != id {
+			continue
+		}
+		for created, ekr := range envelopes {
+			if after != nil && (keyID < after.ID || keyID == after.ID && created <= after.Created) {
+				continue
+			}
+			key := *ekr
+			key.ID, key.Created = keyID, created
+			keys = append(keys, &key)
+		}
+	}
+	metastore.RUnlock()
+
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].ID != keys[b].ID {
+			return keys[a].ID < keys[b].ID
+		}
+		return keys[a].Created < keys[b].Created
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	return keys, lastKeyCursor(keys, limit), nil
+}
+
+// scanSQLKeys reads keys in primary key order, resuming after the (id, created) of the cursor.
+func scanSQLKeys(ctx context.Context, opts *Options, id string, after *keyCursor, limit int) ([]*appencryption.EnvelopeKeyRecord, *keyCursor, error) {
+	dbType := sqlMetastoreDBType(opts)
+	db, err := getConnection(dbType, opts.ConnectionString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var query string
+	var args []any
+	switch {
+	case id != "" && after != nil:
+		query, args = listKeyAfterQuery, []any{id, time.Unix(after.Created, 0), limit}
+	case id != "":
+		query, args = listKeyQuery, []any{id, limit}
+	case after != nil:
+		query, args = listKeysAfterQuery, []any{after.ID, after.ID, time.Unix(after.Created, 0), limit}
+	default:
+		query, args = listKeysQuery, []any{limit}
+	}
+
+	rows, err := db.QueryContext(ctx, sqlPlaceholders(dbType, query), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var keys []*appencryption.EnvelopeKeyRecord
+	for rows.Next() {
+		var id, record string
+		if err := rows.Scan(&id, &record); err != nil {
+			return nil, nil, err
+		}
+
+		key := &appencryption.EnvelopeKeyRecord{ID: id}
+		if err := json.Unmarshal([]byte(record), key); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal key %s: %w", id, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return keys, lastKeyCursor(keys, limit), nil
+}
+
+// scanDynamoDBKeys queries the items of id, or scans the table for system and intermediate keys if
+// id is empty. The cursor is the LastEvaluatedKey of DynamoDB.
+func scanDynamoDBKeys(ctx context.Context, metastore *persistence.DynamoDBMetastore, id string, after *keyCursor, limit int) ([]*appencryption.EnvelopeKeyRecord, *keyCursor, error) {
+	var startKey map[string]*dynamodb.AttributeValue
+	if after != nil {
+		startKey = map[string]*dynamodb.AttributeValue{
+			dynamoDBPartitionKey: {S: aws.String(after.ID)},
+			dynamoDBSortKey:      {N: aws.String(strconv.FormatInt(after.Created, 10))},
+		}
+	}
+
+	var items []map[string]*dynamodb.AttributeValue
+	var lastKey map[string]*dynamodb.AttributeValue
+	if id != "" {
+		out, err := metastore.GetClient().QueryWithContext(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(metastore.GetTableName()),
+			KeyConditionExpression:   aws.String("#id = :id"),
+			ExpressionAttributeNames: map[string]*string{"#id": aws.String(dynamoDBPartitionKey)},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":id": {S: aws.String(id)},
+			},
+			ExclusiveStartKey: startKey,
+			Limit:             aws.Int64(int64(limit)),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		items, lastKey = out.Items, out.LastEvaluatedKey
+	} else {
+		client, ok := metastore.GetClient().(dynamoDBScanner)
+		if !ok {
+			return nil, nil, fmt.Errorf("DynamoDB client %T does not support Scan", metastore.GetClient())
+		}
+
+		out, err := client.ScanWithContext(ctx, &dynamodb.ScanInput{
+			TableName:                aws.String(metastore.GetTableName()),
+			FilterExpression:         aws.String("begins_with(#id, :sk) OR begins_with(#id, :ik)"),
+			ExpressionAttributeNames: map[string]*string{"#id": aws.String(dynamoDBPartitionKey)},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":sk": {S: aws.String("_SK_")},
+				":ik": {S: aws.String("_IK_")},
+			},
+			ExclusiveStartKey: startKey,
+			Limit:             aws.Int64(int64(limit)),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		items, lastKey = out.Items, out.LastEvaluatedKey
+	}
+
+	keys := make([]*appencryption.EnvelopeKeyRecord, 0, len(items))
+	for _, item := range items {
+		var id string
+		if err := dynamodbattribute.Unmarshal(item[dynamoDBPartitionKey], &id); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal key id: %w", err)
+		}
+
+		var envelope persistence.DynamoDBEnvelope
+		if err := dynamodbattribute.Unmarshal(item[dynamoDBKeyRecord], &envelope); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal key %s: %w", id, err)
+		}
+
+		encryptedKey, err := base64.StdEncoding.DecodeString(envelope.EncryptedKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode key %s: %w", id, err)
+		}
+
+		keys = append(keys, &appencryption.EnvelopeKeyRecord{
+			ID:            id,
+			Created:       envelope.Created,
+			Revoked:       envelope.Revoked,
+			EncryptedKey:  encryptedKey,
+			ParentKeyMeta: envelope.ParentKeyMeta,
+		})
+	}
+
+	if lastKey == nil {
+		return keys, nil, nil
+	}
+
+	cursor := &keyCursor{}
+	if err := dynamodbattribute.Unmarshal(lastKey[dynamoDBPartitionKey], &cursor.ID); err != nil {
+		return nil, nil, err
+	}
+	if err := dynamodbattribute.Unmarshal(lastKey[dynamoDBSortKey], &cursor.Created); err != nil {
+		return nil, nil, err
+	}
+
+	return keys, cursor, nil
+}
@@ -0,0 +1,272 @@
+package asherah
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+type scanningDynamoDBClient struct {
+	persistence.DynamoDBClientAPI
+	scan  *dynamodb.ScanInput
+	query *dynamodb.QueryInput
+	items []map[string]*dynamodb.AttributeValue
+}
+
+func (c *scanningDynamoDBClient) ScanWithContext(_ aws.Context, input *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
+	c.scan = input
+	return &dynamodb.ScanOutput{Items: c.items, LastEvaluatedKey: c.items[len(c.items)-1]}, nil
+}
+
+func (c *scanningDynamoDBClient) QueryWithContext(_ aws.Context, input *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	c.query = input
+	return &dynamodb.QueryOutput{Items: c.items}, nil
+}
+
+func testDynamoDBKeyItem(id string, created string, revoked bool) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Id":      {S: aws.String(id)},
+		"Created": {N: aws.String(created)},
+		"KeyRecord": {M: map[string]*dynamodb.AttributeValue{
+			"Created": {N: aws.String(created)},
+			"Revoked": {BOOL: aws.Bool(revoked)},
+			"Key":     {S: aws.String("a2V5")},
+		}},
+	}
+}
+
+func TestListKeysMemory(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	testEncrypt(t, handle, "a")
+	testEncrypt(t, handle, "b")
+
+	page, err := ListKeys(context.Background(), handle, KeyFilter{})
+	if err != nil {
+		t.Fatalf("ListKeys returned %v", err)
+	}
+	if len(page.Keys) != 3 || page.NextPageToken != "" {
+		t.Fatalf("Expected 3 keys and no page token got %+v", page)
+	}
+
+	ik, sk := page.Keys[0], page.Keys[2]
+	if ik.ID != "_IK_a_s_p" || ik.Type != KeyTypeIntermediate || ik.Partition != "a" || ik.Service != "s" || ik.Product != "p" ||
+		ik.ParentKeyMeta == nil || ik.ParentKeyMeta.ID != "_SK_s_p" {
+		t.Errorf("Unexpected intermediate key %+v", ik)
+	}
+	if sk.ID != "_SK_s_p" || sk.Type != KeyTypeSystem || sk.Partition != "" || sk.Revoked {
+		t.Errorf("Unexpected system key %+v", sk)
+	}
+}
+
+func TestListKeysFilters(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	testEncrypt(t, handle, "a")
+	testEncrypt(t, handle, "b")
+
+	for filter, expected := range map[KeyFilter]string{
+		{Type: KeyTypeSystem}:                       "_SK_s_p",
+		{Type: KeyTypeIntermediate, Partition: "b"}: "_IK_b_s_p",
+		{Partition: "a"}:                            "_IK_a_s_p",
+	} {
+		page, err := ListKeys(context.Background(), handle, filter)
+		if err != nil || len(page.Keys) != 1 || page.Keys[0].ID != expected {
+			t.Errorf("%+v: expected %v got %+v, %v", filter, expected, page, err)
+		}
+	}
+}
+
+func TestListKeysPages(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	for _, partition := range []string{"a", "b", "c", "d"} {
+		testEncrypt(t, handle, partition)
+	}
+
+	var ids []string
+	filter := KeyFilter{Type: KeyTypeIntermediate, Limit: 3}
+	for {
+		page, err := ListKeys(context.Background(), handle, filter)
+		if err != nil {
+			t.Fatalf("ListKeys returned %v", err)
+		}
+		for _, key := range page.Keys {
+			ids = append(ids, key.ID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		filter.PageToken = page.NextPageToken
+	}
+
+	if len(ids) != 4 || ids[0] != "_IK_a_s_p" || ids[3] != "_IK_d_s_p" {
+		t.Errorf("Expected the intermediate keys of 4 partitions in order got %v", ids)
+	}
+}
+
+func TestListKeysRejectsBadFilters(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+
+	for _, filter := range []KeyFilter{
+		{Type: "data"},
+		{Type: KeyTypeSystem, Partition: "a"},
+		{Limit: -1},
+		{Limit: maxListKeysLimit + 1},
+		{PageToken: "not a token"},
+	} {
+		if _, err := ListKeys(context.Background(), handle, filter); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%+v: expected ErrInvalidConfig got %v", filter, err)
+		}
+	}
+}
+
+func TestListKeysDestroyedInstance(t *testing.T) {
+	handle, err := CreateInstance(&Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static"})
+	if err != nil {
+		t.Fatalf("CreateInstance returned %v", err)
+	}
+	instance, _ := getInstance(handle)
+	if err := DestroyInstance(handle); err != nil {
+		t.Fatalf("DestroyInstance returned %v", err)
+	}
+
+	if _, err := instance.ListKeys(context.Background(), KeyFilter{}); err != ErrAsherahNotInitialized {
+		t.Errorf("Expected ErrAsherahNotInitialized got %v", err)
+	}
+}
+
+func TestScanDynamoDBKeys(t *testing.T) {
+	sess, err := awssession.NewSession(&aws.Config{Region: aws.String("us-west-2")})
+	if err != nil {
+		t.Fatalf("NewSession returned %v", err)
+	}
+
+	client := &scanningDynamoDBClient{items: []map[string]*dynamodb.AttributeValue{
+		testDynamoDBKeyItem("_SK_s_p", "1700000000", false),
+		testDynamoDBKeyItem("_IK_a_s_p", "1700000060", true),
+	}}
+	metastore := persistence.NewDynamoDBMetastore(sess, persistence.WithClient(client), persistence.WithTableName("Keys"))
+
+	keys, cursor, err := scanDynamoDBKeys(context.Background(), metastore, "", &keyCursor{ID: "_SK_s_p", Created: 1}, 2)
+	if err != nil {
+		t.Fatalf("scanDynamoDBKeys returned %v", err)
+	}
+	if len(keys) != 2 || keys[1].ID != "_IK_a_s_p" || keys[1].Created != 1700000060 || !keys[1].Revoked {
+		t.Errorf("Unexpected keys %+v", keys)
+	}
+	if cursor == nil || cursor.ID != "_IK_a_s_p" || cursor.Created != 1700000060 {
+		t.Errorf("Unexpected cursor %+v", cursor)
+	}
+	if *client.scan.TableName != "Keys" || *client.scan.Limit != 2 || *client.scan.ExclusiveStartKey["Created"].N != "1" {
+		t.Errorf("Unexpected scan %v", client.scan)
+	}
+
+	client.items = client.items[:1]
+	keys, cursor, err = scanDynamoDBKeys(context.Background(), metastore, "_SK_s_p", nil, 10)
+	if err != nil || len(keys) != 1 || cursor != nil {
+		t.Errorf("Expected one key and no cursor got %+v, %+v, %v", keys, cursor, err)
+	}
+	if *client.query.ExpressionAttributeValues[":id"].S != "_SK_s_p" || client.query.ExclusiveStartKey != nil {
+		t.Errorf("Unexpected query %v", client.query)
+	}
+}
+
+func TestScanSQLKeysQueries(t *testing.T) {
+	after := &keyCursor{ID: "_IK_a_s_p", Created: 1700000000}
+
+	for _, test := range []struct {
+		dbType string
+		id     string
+		after  *keyCursor
+		query  string
+		args   []driver.Value
+	}{
+		{"mysql", "", nil, listKeysQuery, []driver.Value{2}},
+		{"mysql", "", after, listKeysAfterQuery, []driver.Value{"_IK_a_s_p", "_IK_a_s_p", time.Unix(1700000000, 0), 2}},
+		{"mysql", "_SK_s_p", nil, listKeyQuery, []driver.Value{"_SK_s_p", 2}},
+		{"mysql", "_SK_s_p", after, listKeyAfterQuery, []driver.Value{"_SK_s_p", time.Unix(1700000000, 0), 2}},
+		{"postgres", "", after,
+			"SELECT id, key_record FROM encryption_key WHERE id > $1 OR (id = $2 AND created > $3) ORDER BY id, created LIMIT $4",
+			[]driver.Value{"_IK_a_s_p", "_IK_a_s_p", time.Unix(1700000000, 0), 2}},
+		{"postgres", "_SK_s_p", after,
+			"SELECT id, key_record FROM encryption_key WHERE id = $1 AND created > $2 ORDER BY created LIMIT $3",
+			[]driver.Value{"_SK_s_p", time.Unix(1700000000, 0), 2}},
+	} {
+		opts := &Options{Metastore: "rdbms", SQLMetastoreDBType: test.dbType, ConnectionString: "scan-sql-keys-" + test.query}
+		_, mock := newMockConnection(t, test.dbType, opts.ConnectionString)
+		mock.ExpectQuery(test.query).WithArgs(test.args...).WillReturnRows(sqlmock.NewRows([]string{"id", "key_record"}).
+			AddRow("_SK_s_p", `{"Created":1700000060,"Key":"a2V5"}`).
+			AddRow("_IK_b_s_p", `{"Revoked":true,"Created":1700000120,"Key":"a2V5","ParentKeyMeta":{"KeyId":"_SK_s_p","Created":1700000060}}`))
+
+		keys, cursor, err := scanSQLKeys(context.Background(), opts, test.id, test.after, 2)
+		if err != nil {
+			t.Fatalf("%v %q %+v: scanSQLKeys returned %v", test.dbType, test.id, test.after, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%v %q %+v: %v", test.dbType, test.id, test.after, err)
+		}
+
+		if len(keys) != 2 || keys[0].ID != "_SK_s_p" || keys[0].Created != 1700000060 || string(keys[0].EncryptedKey) != "key" ||
+			keys[1].ID != "_IK_b_s_p" || !keys[1].Revoked || keys[1].ParentKeyMeta == nil || keys[1].ParentKeyMeta.ID != "_SK_s_p" {
+			t.Errorf("Unexpected keys %+v", keys)
+		}
+		if cursor == nil || cursor.ID != "_IK_b_s_p" || cursor.Created != 1700000120 {
+			t.Errorf("Unexpected cursor %+v", cursor)
+		}
+	}
+}
+
+func TestScanSQLKeysBadRecord(t *testing.T) {
+	opts := &Options{Metastore: "rdbms", ConnectionString: "scan-sql-keys-bad-record"}
+	_, mock := newMockConnection(t, "mysql", opts.ConnectionString)
+	mock.ExpectQuery(listKeysQuery).WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "key_record"}).AddRow("_SK_s_p", "not json"))
+
+	if _, _, err := scanSQLKeys(context.Background(), opts, "", nil, 10); err == nil {
+		t.Error("Expected an error for an undecodable key_record")
+	}
+}
+
+func TestListKeysSQLResumesWithinKey(t *testing.T) {
+	opts := &Options{ServiceName: "s", ProductID: "p", Metastore: "rdbms", ConnectionString: "list-keys-sql"}
+	db, mock := newMockConnection(t, "mysql", opts.ConnectionString)
+	instance := &Instance{metastore: persistence.NewSQLMetastore(db), options: opts, tracer: noopTracer}
+
+	columns := []string{"id", "key_record"}
+	mock.ExpectQuery(listKeysQuery).WithArgs(2).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow("_IK_a_s_p", `{"Created":1,"Key":"a2V5"}`).
+		AddRow("_IK_a_s_p", `{"Created":2,"Key":"a2V5"}`))
+	mock.ExpectQuery(listKeysAfterQuery).WithArgs("_IK_a_s_p", "_IK_a_s_p", time.Unix(2, 0), 2).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow("_IK_a_s_p", `{"Created":3,"Key":"a2V5"}`).
+		AddRow("_SK_s_p", `{"Created":1,"Key":"a2V5"}`))
+	mock.ExpectQuery(listKeysAfterQuery).WithArgs("_SK_s_p", "_SK_s_p", time.Unix(1, 0), 2).WillReturnRows(sqlmock.NewRows(columns))
+
+	var listed []string
+	filter := KeyFilter{Limit: 2}
+	for {
+		page, err := instance.ListKeys(context.Background(), filter)
+		if err != nil {
+			t.Fatalf("ListKeys returned %v", err)
+		}
+		for _, key := range page.Keys {
+			listed = append(listed, fmt.Sprintf("%s@%d", key.ID, key.Created))
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		filter.PageToken = page.NextPageToken
+	}
+
+	if expected := "_IK_a_s_p@1 _IK_a_s_p@2 _IK_a_s_p@3 _SK_s_p@1"; strings.Join(listed, " ") != expected {
+		t.Errorf("Expected %v got %v", expected, listed)
+	}
+}
@@ -0,0 +1,283 @@
+package asherah
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weak"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/rcrowley/go-metrics"
+)
+
+// MetricsPrefix is prepended to the metrics recorded by asherah-cobhan. Asherah's own metrics,
+// kept in the go-metrics DefaultRegistry, use appencryption.MetricsPrefix ("ael").
+const MetricsPrefix = "cobhan"
+
+// metricsEnabled is process-wide: once any instance enables metrics, they stay enabled, because
+// appencryption.WithMetrics(false) permanently unregisters Asherah's metrics. The cobhan metrics of
+// instances created earlier are recorded from then on; Asherah's own metrics are not.
+var metricsEnabled atomic.Bool
+
+// metricsRegistry is separate from the DefaultRegistry so Asherah clearing its metrics cannot remove ours.
+var metricsRegistry = metrics.NewRegistry()
+
+var (
+	encryptTimer    = metrics.GetOrRegisterTimer(MetricsPrefix+".encrypt", metricsRegistry)
+	encryptErrors   = metrics.GetOrRegisterCounter(MetricsPrefix+".encrypt.errors", metricsRegistry)
+	decryptTimer    = metrics.GetOrRegisterTimer(MetricsPrefix+".decrypt", metricsRegistry)
+	decryptErrors   = metrics.GetOrRegisterCounter(MetricsPrefix+".decrypt.errors", metricsRegistry)
+	sessionTimer    = metrics.GetOrRegisterTimer(MetricsPrefix+".session.get", metricsRegistry)
+	sessionErrors   = metrics.GetOrRegisterCounter(MetricsPrefix+".session.errors", metricsRegistry)
+	sessionHits     = metrics.GetOrRegisterCounter(MetricsPrefix+".session.cache.hits", metricsRegistry)
+	sessionMisses   = metrics.GetOrRegisterCounter(MetricsPrefix+".session.cache.misses", metricsRegistry)
+	kmsEncryptTimer = metrics.GetOrRegisterTimer(MetricsPrefix+".kms.encryptkey", metricsRegistry)
+	kmsDecryptTimer = metrics.GetOrRegisterTimer(MetricsPrefix+".kms.decryptkey", metricsRegistry)
+	kmsErrors       = metrics.GetOrRegisterCounter(MetricsPrefix+".kms.errors", metricsRegistry)
+	metastoreLoad   = metrics.GetOrRegisterTimer(MetricsPrefix+".metastore.load", metricsRegistry)
+	metastoreLatest = metrics.GetOrRegisterTimer(MetricsPrefix+".metastore.loadlatest", metricsRegistry)
+	metastoreStore  = metrics.GetOrRegisterTimer(MetricsPrefix+".metastore.store", metricsRegistry)
+	metastoreErrors = metrics.GetOrRegisterCounter(MetricsPrefix+".metastore.errors", metricsRegistry)
+)
+
+func init() {
+	metricsRegistry.Register(MetricsPrefix+".session.cache.size", metrics.NewFunctionalGauge(func() int64 { return cachedSessions.size() }))
+}
+
+// MetricsEnabled reports whether any instance has been configured with EnableMetrics.
+func MetricsEnabled() bool {
+	return metricsEnabled.Load()
+}
+
+func recordOperation(timer metrics.Timer, errors metrics.Counter, start time.Time, err error) {
+	if !metricsEnabled.Load() {
+		return
+	}
+
+	timer.UpdateSince(start)
+	if err != nil {
+		errors.Inc(1)
+	}
+}
+
+// RecordResult counts an FFI call to op by the result code it returned, as metric
+// "cobhan.<op>.result.<code>".
+func RecordResult(op string, code int32) {
+	if !metricsEnabled.Load() {
+		return
+	}
+
+	metrics.GetOrRegisterCounter(MetricsPrefix+"."+op+".result."+strconv.Itoa(int(code)), metricsRegistry).Inc(1)
+}
+
+// meteredMetastore records the latency and failures of every metastore call.
+type meteredMetastore struct {
+	appencryption.Metastore
+}
+
+func (m meteredMetastore) Load(ctx context.Context, id string, created int64) (*appencryption.EnvelopeKeyRecord, error) {
+	start := time.Now()
+	ekr, err := m.Metastore.Load(ctx, id, created)
+	recordOperation(metastoreLoad, metastoreErrors, start, err)
+	return ekr, err
+}
+
+func (m meteredMetastore) LoadLatest(ctx context.Context, id string) (*appencryption.EnvelopeKeyRecord, error) {
+	start := time.Now()
+	ekr, err := m.Metastore.LoadLatest(ctx, id)
+	recordOperation(metastoreLatest, metastoreErrors, start, err)
+	return ekr, err
+}
+
+func (m meteredMetastore) Store(ctx context.Context, id string, created int64, envelope *appencryption.EnvelopeKeyRecord) (bool, error) {
+	start := time.Now()
+	stored, err := m.Metastore.Store(ctx, id, created, envelope)
+	recordOperation(metastoreStore, metastoreErrors, start, err)
+	return stored, err
+}
+
+// GetRegionSuffix forwards to the wrapped metastore so region-suffixed key IDs are kept.
+func (m meteredMetastore) GetRegionSuffix() string {
+	return regionSuffix(m.Metastore)
+}
+
+// regionSuffixer is implemented by metastores that append a region suffix to key IDs.
+type regionSuffixer interface {
+	GetRegionSuffix() string
+}
+
+// regionSuffix returns the region suffix of metastore, or "" if it does not have one.
+func regionSuffix(metastore appencryption.Metastore) string {
+	if suffixer, ok := metastore.(regionSuffixer); ok {
+		return suffixer.GetRegionSuffix()
+	}
+
+	return ""
+}
+
+// cachedSessions tracks the sessions returned by the session caches of every instance. Asherah's
+// session cache has no hook for its loader, but it hands back the same *Session for a partition until
+// the session is evicted, so a session that was not returned before has just been loaded.
+var cachedSessions = &sessionCacheTracker{seen: map[weak.Pointer[appencryption.Session]]struct{}{}}
+
+type sessionCacheTracker struct {
+	lock sync.Mutex
+	seen map[weak.Pointer[appencryption.Session]]struct{}
+}
+
+// record counts session as a cache hit if it was returned before and as a miss otherwise. A session
+// is forgotten once it is garbage collected after its eviction.
+func (t *sessionCacheTracker) record(session *appencryption.Session) {
+	key := weak.Make(session)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.seen[key]; ok {
+		sessionHits.Inc(1)
+		return
+	}
+
+	sessionMisses.Inc(1)
+	t.seen[key] = struct{}{}
+	runtime.AddCleanup(session, t.forget, key)
+}
+
+// size returns the number of sessions loaded by the session caches that have not been garbage
+// collected. It is an approximate upper bound on the sessions the caches hold: an evicted session
+// is still counted until the next garbage collection after its last user closes it.
+func (t *sessionCacheTracker) size() int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return int64(len(t.seen))
+}
+
+func (t *sessionCacheTracker) forget(key weak.Pointer[appencryption.Session]) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.seen, key)
+}
+
+// meteredKMS records the latency and failures of every KMS call.
+type meteredKMS struct {
+	appencryption.KeyManagementService
+}
+
+func (k meteredKMS) EncryptKey(ctx context.Context, key []byte) ([]byte, error) {
+	start := time.Now()
+	encrypted, err := k.KeyManagementService.EncryptKey(ctx, key)
+	recordOperation(kmsEncryptTimer, kmsErrors, start, err)
+	return encrypted, err
+}
+
+func (k meteredKMS) DecryptKey(ctx context.Context, key []byte) ([]byte, error) {
+	start := time.Now()
+	decrypted, err := k.KeyManagementService.DecryptKey(ctx, key)
+	recordOperation(kmsDecryptTimer, kmsErrors, start, err)
+	return decrypted, err
+}
+
+// MetricSnapshot is the value of one metric. Rates are per second and durations are in milliseconds.
+type MetricSnapshot struct {
+	Type     string  `json:"Type"`
+	Count    int64   `json:"Count"`
+	Value    float64 `json:"Value,omitempty"`
+	Rate1    float64 `json:"Rate1,omitempty"`
+	Rate5    float64 `json:"Rate5,omitempty"`
+	Rate15   float64 `json:"Rate15,omitempty"`
+	RateMean float64 `json:"RateMean,omitempty"`
+	Min      float64 `json:"Min,omitempty"`
+	Max      float64 `json:"Max,omitempty"`
+	Mean     float64 `json:"Mean,omitempty"`
+	P50      float64 `json:"P50,omitempty"`
+	P95      float64 `json:"P95,omitempty"`
+	P99      float64 `json:"P99,omitempty"`
+}
+
+// MetricsSnapshot holds every asherah-cobhan and Asherah metric, keyed by name.
+type MetricsSnapshot struct {
+	Enabled bool                      `json:"Enabled"`
+	Metrics map[string]MetricSnapshot `json:"Metrics"`
+}
+
+// GetMetrics returns the current value of every metric. Metrics is empty unless metrics are enabled.
+func GetMetrics() *MetricsSnapshot {
+	snapshot := &MetricsSnapshot{
+		Enabled: metricsEnabled.Load(),
+		Metrics: map[string]MetricSnapshot{},
+	}
+
+	if !snapshot.Enabled {
+		return snapshot
+	}
+
+	for _, registry := range []metrics.Registry{metrics.DefaultRegistry, metricsRegistry} {
+		registry.Each(func(name string, metric interface{}) {
+			if value, ok := snapshotMetric(metric); ok {
+				snapshot.Metrics[name] = value
+			}
+		})
+	}
+
+	return snapshot
+}
+
+func snapshotMetric(metric interface{}) (MetricSnapshot, bool) {
+	const ms = float64(time.Millisecond)
+
+	switch m := metric.(type) {
+	case metrics.Counter:
+		return MetricSnapshot{Type: "counter", Count: m.Count()}, true
+	case metrics.Gauge:
+		return MetricSnapshot{Type: "gauge", Value: float64(m.Value())}, true
+	case metrics.GaugeFloat64:
+		return MetricSnapshot{Type: "gauge", Value: m.Value()}, true
+	case metrics.Meter:
+		s := m.Snapshot()
+		return MetricSnapshot{
+			Type:     "meter",
+			Count:    s.Count(),
+			Rate1:    s.Rate1(),
+			Rate5:    s.Rate5(),
+			Rate15:   s.Rate15(),
+			RateMean: s.RateMean(),
+		}, true
+	case metrics.Histogram:
+		s := m.Snapshot()
+		p := s.Percentiles([]float64{0.5, 0.95, 0.99})
+		return MetricSnapshot{
+			Type:  "histogram",
+			Count: s.Count(),
+			Min:   float64(s.Min()),
+			Max:   float64(s.Max()),
+			Mean:  s.Mean(),
+			P50:   p[0],
+			P95:   p[1],
+			P99:   p[2],
+		}, true
+	case metrics.Timer:
+		s := m.Snapshot()
+		p := s.Percentiles([]float64{0.5, 0.95, 0.99})
+		return MetricSnapshot{
+			Type:     "timer",
+			Count:    s.Count(),
+			Rate1:    s.Rate1(),
+			Rate5:    s.Rate5(),
+			Rate15:   s.Rate15(),
+			RateMean: s.RateMean(),
+			Min:      float64(s.Min()) / ms,
+			Max:      float64(s.Max()) / ms,
+			Mean:     s.Mean() / ms,
+			P50:      p[0] / ms,
+			P95:      p[1] / ms,
+			P99:      p[2] / ms,
+		}, true
+	}
+
+	return MetricSnapshot{}, false
+}
@@ -0,0 +1,213 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/crypto/aead"
+	"github.com/godaddy/asherah/go/appencryption/pkg/kms"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+func enableMetricsForTesting(t *testing.T) {
+	previous := metricsEnabled.Swap(true)
+	t.Cleanup(func() { metricsEnabled.Store(previous) })
+}
+
+func TestMeteredMetastoreRecordsCalls(t *testing.T) {
+	enableMetricsForTesting(t)
+
+	loads, failures := metastoreLatest.Count(), metastoreErrors.Count()
+
+	metastore := meteredMetastore{blockingMetastore{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := metastore.LoadLatest(ctx, "_SK_service_product"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled got %v", err)
+	}
+
+	if got := metastoreLatest.Count() - loads; got != 1 {
+		t.Errorf("Expected 1 loadlatest got %v", got)
+	}
+	if got := metastoreErrors.Count() - failures; got != 1 {
+		t.Errorf("Expected 1 error got %v", got)
+	}
+}
+
+func TestEnableMetricsMetersEarlierInstances(t *testing.T) {
+	previous := metricsEnabled.Swap(false)
+	t.Cleanup(func() { metricsEnabled.Store(previous) })
+
+	earlier, err := CreateInstance(&Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static"})
+	if err != nil {
+		t.Fatalf("CreateInstance returned %v", err)
+	}
+	defer DestroyInstance(earlier)
+
+	later, err := CreateInstance(&Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static", EnableMetrics: true})
+	if err != nil {
+		t.Fatalf("CreateInstance returned %v", err)
+	}
+	defer DestroyInstance(later)
+
+	stores, encrypts := metastoreStore.Count(), kmsEncryptTimer.Count()
+	if _, err := EncryptWithInstance(context.Background(), earlier, "partition", []byte("data"), 0); err != nil {
+		t.Fatalf("EncryptWithInstance returned %v", err)
+	}
+
+	if metastoreStore.Count() == stores || kmsEncryptTimer.Count() == encrypts {
+		t.Errorf("Expected the earlier instance's metastore and KMS calls to be recorded")
+	}
+}
+
+type suffixedMetastore struct {
+	appencryption.Metastore
+}
+
+func (suffixedMetastore) GetRegionSuffix() string {
+	return "us-west-2"
+}
+
+func TestWrappedMetastoresKeepRegionSuffix(t *testing.T) {
+	inner := suffixedMetastore{persistence.NewMemoryMetastore()}
+
+	for name, metastore := range map[string]appencryption.Metastore{
+		"metered": meteredMetastore{inner},
+		"traced":  tracedMetastore{Metastore: meteredMetastore{inner}},
+	} {
+		suffixer, ok := metastore.(interface{ GetRegionSuffix() string })
+		if !ok {
+			t.Errorf("%v: expected GetRegionSuffix to be forwarded", name)
+		} else if got := suffixer.GetRegionSuffix(); got != "us-west-2" {
+			t.Errorf("%v: expected us-west-2 got %v", name, got)
+		}
+	}
+
+	if got := regionSuffix(meteredMetastore{persistence.NewMemoryMetastore()}); got != "" {
+		t.Errorf("Expected no suffix got %v", got)
+	}
+}
+
+func TestGetMetricsReportsOperations(t *testing.T) {
+	enableMetricsForTesting(t)
+
+	crypto := aead.NewAES256GCM()
+	m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", crypto)
+	if err != nil {
+		t.Fatalf("kms.NewStatic returned %v", err)
+	}
+
+	instance := &Instance{
+		sessionFactory: appencryption.NewSessionFactory(
+			&appencryption.Config{Service: "TestService", Product: "TestProduct", Policy: appencryption.NewCryptoPolicy()},
+			meteredMetastore{persistence.NewMemoryMetastore()},
+			meteredKMS{m},
+			crypto,
+		),
+		options: &Options{},
+		tracer:  noopTracer,
+	}
+	defer instance.sessionFactory.Close()
+
+	drr, err := instance.Encrypt(context.Background(), "Partition", []byte("InputData"), 0)
+	if err != nil {
+		t.Fatalf("Encrypt returned %v", err)
+	}
+	if _, err := instance.Decrypt(context.Background(), "Partition", drr, 0); err != nil {
+		t.Fatalf("Decrypt returned %v", err)
+	}
+
+	snapshot := GetMetrics()
+	if !snapshot.Enabled {
+		t.Error("Expected metrics to be enabled")
+	}
+
+	for _, name := range []string{"cobhan.encrypt", "cobhan.decrypt", "cobhan.session.get", "cobhan.kms.encryptkey", "cobhan.metastore.store"} {
+		metric, ok := snapshot.Metrics[name]
+		if !ok || metric.Type != "timer" || metric.Count == 0 {
+			t.Errorf("Expected %v to be a recorded timer got %+v", name, metric)
+		}
+	}
+}
+
+func TestSessionCacheHitsAndMisses(t *testing.T) {
+	enableMetricsForTesting(t)
+
+	crypto := aead.NewAES256GCM()
+	m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", crypto)
+	if err != nil {
+		t.Fatalf("kms.NewStatic returned %v", err)
+	}
+
+	for _, caching := range []bool{true, false} {
+		options := &Options{ServiceName: "TestService", ProductID: "TestProduct", EnableSessionCaching: caching}
+		applyDefaults(options)
+		instance := &Instance{
+			sessionFactory: newSessionFactory(options, suffixedMetastore{persistence.NewMemoryMetastore()}, m, crypto),
+			options:        options,
+			tracer:         noopTracer,
+		}
+
+		hits, misses := sessionHits.Count(), sessionMisses.Count()
+		for _, partition := range []string{"First", "First", "Second", "First", ""} {
+			instance.Encrypt(context.Background(), partition, []byte("InputData"), 0)
+		}
+		instance.sessionFactory.Close()
+
+		expectedHits, expectedMisses := int64(2), int64(2)
+		if !caching {
+			expectedHits, expectedMisses = 0, 0
+		}
+		if got := sessionHits.Count() - hits; got != expectedHits {
+			t.Errorf("Caching %v: expected %v hits got %v", caching, expectedHits, got)
+		}
+		if got := sessionMisses.Count() - misses; got != expectedMisses {
+			t.Errorf("Caching %v: expected %v misses got %v", caching, expectedMisses, got)
+		}
+	}
+}
+
+// TestSessionCacheReturnsCachedSession guards the assumption sessionCacheTracker relies on: Asherah's
+// session cache returns the same *Session for a cached partition and a new one for any other.
+func TestSessionCacheReturnsCachedSession(t *testing.T) {
+	crypto := aead.NewAES256GCM()
+	m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", crypto)
+	if err != nil {
+		t.Fatalf("kms.NewStatic returned %v", err)
+	}
+
+	options := &Options{ServiceName: "TestService", ProductID: "TestProduct", EnableSessionCaching: true}
+	applyDefaults(options)
+	factory := newSessionFactory(options, persistence.NewMemoryMetastore(), m, crypto)
+	defer factory.Close()
+
+	first, err := factory.GetSession("First")
+	if err != nil {
+		t.Fatalf("GetSession returned %v", err)
+	}
+	defer first.Close()
+	again, _ := factory.GetSession("First")
+	defer again.Close()
+	second, _ := factory.GetSession("Second")
+	defer second.Close()
+
+	if first != again {
+		t.Error("Expected the cached session to be returned for the same partition")
+	}
+	if first == second {
+		t.Error("Expected a new session for another partition")
+	}
+}
+
+func TestGetMetricsEmptyWhenDisabled(t *testing.T) {
+	previous := metricsEnabled.Swap(false)
+	defer metricsEnabled.Store(previous)
+
+	snapshot := GetMetrics()
+	if snapshot.Enabled || len(snapshot.Metrics) != 0 {
+		t.Errorf("Expected empty snapshot got %+v", snapshot)
+	}
+}
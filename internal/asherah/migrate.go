@@ -0,0 +1,242 @@
+package asherah
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+const (
+	defaultMigrateBatchSize = 100
+	maxMigrateBatchSize     = 1000
+)
+
+// Migration copies every key from the Source metastore to the Destination metastore. Source and
+// Destination use the metastore fields of Options (Metastore, ConnectionString, SQLMetastoreDBType,
+// DynamoDBEndpoint, DynamoDBRegion and DynamoDBTableName); other fields are ignored. Neither may be
+// a memory metastore, which holds no keys outside the process. BatchSize is the number of keys read
+// at a time and defaults to 100.
+type Migration struct {
+	Source      Options `json:"Source"`
+	Destination Options `json:"Destination"`
+	DryRun      bool    `json:"DryRun,omitempty"`
+	Verify      bool    `json:"Verify,omitempty"`
+	BatchSize   int     `json:"BatchSize,omitempty"`
+}
+
+// MigrationReport counts the keys handled by MigrateKeys. Copied keys were missing from the
+// destination, Unchanged keys were already there, and Revoked keys were there but revoked only in
+// the source. Conflicts were stored in the destination with a different key or parent and are left
+// alone. Mismatches lists the keys the verify pass found missing or different in the destination.
+// In a dry run the counts are what a migration would do.
+type MigrationReport struct {
+	DryRun     bool                    `json:"DryRun"`
+	Scanned    int                     `json:"Scanned"`
+	Copied     int                     `json:"Copied"`
+	Unchanged  int                     `json:"Unchanged"`
+	Revoked    int                     `json:"Revoked"`
+	Conflicts  []appencryption.KeyMeta `json:"Conflicts"`
+	Verified   int                     `json:"Verified"`
+	Mismatches []appencryption.KeyMeta `json:"Mismatches"`
+}
+
+// MigrateKeys copies every key of the Source metastore to the Destination metastore and, if
+// Verify is set, then checks that each source key is stored identically in the destination.
+// Keys keep their IDs, so a Destination with EnableRegionSuffix set is rejected. It is
+// idempotent: keys already in the destination are left unchanged, except that a key revoked in
+// the source is revoked in the destination. progress, if not nil, is called after every batch.
+func MigrateKeys(ctx context.Context, migration *Migration, progress func(MigrationReport)) (*MigrationReport, error) {
+	if err := migration.validate(); err != nil {
+		return nil, err
+	}
+
+	source, err := NewMetastore(&migration.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer closeMetastore(&migration.Source)
+
+	destination, err := NewMetastore(&migration.Destination)
+	if err != nil {
+		return nil, err
+	}
+	defer closeMetastore(&migration.Destination)
+
+	return migrateKeys(ctx, migration, source, destination, progress)
+}
+
+func (m *Migration) validate() error {
+	var errs ValidationError
+	for _, side := range []struct {
+		name string
+		opts *Options
+	}{{"Source", &m.Source}, {"Destination", &m.Destination}} {
+		switch metastore := side.opts.Metastore; {
+		case metastore == "":
+			errs = append(errs, FieldError{Field: side.name + ".Metastore", Message: "is required"})
+		case metastore == "memory":
+			// A memory metastore starts empty and is discarded on exit, so nothing would be copied or kept.
+			errs = append(errs, FieldError{Field: side.name + ".Metastore", Message: "cannot be memory (valid options: rdbms, dynamodb)"})
+		case !slices.Contains(Choices("Metastore"), metastore) && !slices.Contains(hiddenChoices["Metastore"], metastore):
+			errs = append(errs, FieldError{Field: side.name + ".Metastore", Message: fmt.Sprintf("unknown value '%s' (valid options: rdbms, dynamodb)", metastore)})
+		}
+		errs = append(errs, metastoreFieldErrors(side.opts, side.name+".")...)
+	}
+
+	if m.Destination.EnableRegionSuffix {
+		// The suffix is part of the key IDs a session looks up, and keys are copied with their IDs.
+		errs = append(errs, FieldError{Field: "Destination.EnableRegionSuffix", Message: "is not supported; keys are copied with their source IDs"})
+	}
+	if m.Source.Metastore == "rdbms" && m.Destination.Metastore == "rdbms" && m.Source.ConnectionString == m.Destination.ConnectionString {
+		errs = append(errs, FieldError{Field: "Destination.ConnectionString", Message: "must differ from Source.ConnectionString"})
+	}
+	if m.BatchSize < 0 || m.BatchSize > maxMigrateBatchSize {
+		errs = append(errs, FieldError{Field: "BatchSize", Message: fmt.Sprintf("must be between 0 and %d", maxMigrateBatchSize)})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// closeMetastore releases the connection opened by NewMetastore for opts.
+func closeMetastore(opts *Options) {
+	if opts.Metastore == "rdbms" {
+		closeConnection(sqlMetastoreDBType(opts), opts.ConnectionString)
+	}
+}
+
+func migrateKeys(ctx context.Context, migration *Migration, source, destination appencryption.Metastore, progress func(MigrationReport)) (*MigrationReport, error) {
+	report := &MigrationReport{
+		DryRun:     migration.DryRun,
+		Conflicts:  []appencryption.KeyMeta{},
+		Mismatches: []appencryption.KeyMeta{},
+	}
+
+	err := scanAllKeys(ctx, source, &migration.Source, migration.BatchSize, func(keys []*appencryption.EnvelopeKeyRecord) error {
+		for _, key := range keys {
+			report.Scanned++
+			if err := migrateKey(ctx, destination, &migration.Destination, key, report); err != nil {
+				return err
+			}
+		}
+
+		if progress != nil {
+			progress(*report)
+		}
+		return nil
+	})
+	if err != nil || !migration.Verify {
+		return report, err
+	}
+
+	err = scanAllKeys(ctx, source, &migration.Source, migration.BatchSize, func(keys []*appencryption.EnvelopeKeyRecord) error {
+		for _, key := range keys {
+			stored, err := destination.Load(ctx, key.ID, key.Created)
+			if err != nil {
+				return fmt.Errorf("%w: failed to load key %s created %d: %w", ErrMetastoreFailed, key.ID, key.Created, err)
+			}
+
+			if stored == nil || !sameKey(stored, key) || stored.Revoked != key.Revoked {
+				log.LogFields(log.LevelWarn, log.ComponentAsherah, "Migrated key does not match", log.Fields{"key_id": key.ID, "created": key.Created})
+				report.Mismatches = append(report.Mismatches, appencryption.KeyMeta{ID: key.ID, Created: key.Created})
+				continue
+			}
+			report.Verified++
+		}
+
+		if progress != nil {
+			progress(*report)
+		}
+		return nil
+	})
+
+	return report, err
+}
+
+// scanAllKeys calls fn with every key of metastore, created from opts, batchSize keys at a time.
+func scanAllKeys(ctx context.Context, metastore appencryption.Metastore, opts *Options, batchSize int, fn func([]*appencryption.EnvelopeKeyRecord) error) error {
+	if batchSize == 0 {
+		batchSize = defaultMigrateBatchSize
+	}
+
+	scan, err := newKeyScanner(metastore, opts)
+	if err != nil {
+		return err
+	}
+
+	var cursor *keyCursor
+	for {
+		var keys []*appencryption.EnvelopeKeyRecord
+		keys, cursor, err = scan(ctx, "", cursor, batchSize)
+		if err != nil {
+			return fmt.Errorf("%w: failed to read keys: %w", ErrMetastoreFailed, err)
+		}
+
+		if err := fn(keys); err != nil {
+			return err
+		}
+
+		if cursor == nil {
+			return nil
+		}
+	}
+}
+
+// migrateKey stores key in destination unless it is already there, and records the outcome in
+// report. Nothing is written in a dry run.
+func migrateKey(ctx context.Context, destination appencryption.Metastore, opts *Options, key *appencryption.EnvelopeKeyRecord, report *MigrationReport) error {
+	stored, err := destination.Load(ctx, key.ID, key.Created)
+	if err != nil {
+		return fmt.Errorf("%w: failed to load key %s created %d: %w", ErrMetastoreFailed, key.ID, key.Created, err)
+	}
+
+	if stored == nil && !report.DryRun {
+		ok, err := destination.Store(ctx, key.ID, key.Created, key)
+		if !ok {
+			// Another writer may have stored the key since it was loaded.
+			if stored, _ = destination.Load(ctx, key.ID, key.Created); stored == nil {
+				return fmt.Errorf("%w: failed to store key %s created %d: %v", ErrMetastoreFailed, key.ID, key.Created, err)
+			}
+		}
+	}
+
+	switch {
+	case stored == nil:
+		report.Copied++
+	case !sameKey(stored, key):
+		log.LogFields(log.LevelWarn, log.ComponentAsherah, "Destination holds a different key", log.Fields{"key_id": key.ID, "created": key.Created})
+		report.Conflicts = append(report.Conflicts, appencryption.KeyMeta{ID: key.ID, Created: key.Created})
+	case key.Revoked && !stored.Revoked:
+		if !report.DryRun {
+			if err := revokeStoredKey(ctx, destination, opts, key); err != nil {
+				return fmt.Errorf("%w: failed to revoke key %s created %d: %w", ErrMetastoreFailed, key.ID, key.Created, err)
+			}
+		}
+		report.Revoked++
+	default:
+		report.Unchanged++
+	}
+
+	return nil
+}
+
+// sameKey reports whether a and b hold the same encrypted key under the same parent, ignoring
+// their revocation.
+func sameKey(a, b *appencryption.EnvelopeKeyRecord) bool {
+	if a.Created != b.Created || !bytes.Equal(a.EncryptedKey, b.EncryptedKey) {
+		return false
+	}
+
+	if a.ParentKeyMeta == nil || b.ParentKeyMeta == nil {
+		return a.ParentKeyMeta == b.ParentKeyMeta
+	}
+
+	return *a.ParentKeyMeta == *b.ParentKeyMeta
+}
@@ -0,0 +1,158 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+func testMigrationSource(t *testing.T) *persistence.MemoryMetastore {
+	t.Helper()
+
+	source := persistence.NewMemoryMetastore()
+	for _, ekr := range []*appencryption.EnvelopeKeyRecord{
+		{ID: "_SK_s_p", Created: 1700000000, EncryptedKey: []byte("sk")},
+		{ID: "_IK_a_s_p", Created: 1700000060, EncryptedKey: []byte("ik-a"), ParentKeyMeta: &appencryption.KeyMeta{ID: "_SK_s_p", Created: 1700000000}},
+		{ID: "_IK_b_s_p", Created: 1700000060, EncryptedKey: []byte("ik-b"), ParentKeyMeta: &appencryption.KeyMeta{ID: "_SK_s_p", Created: 1700000000}},
+	} {
+		if _, err := source.Store(context.Background(), ekr.ID, ekr.Created, ekr); err != nil {
+			t.Fatalf("Store returned %v", err)
+		}
+	}
+
+	return source
+}
+
+func testMigration(dryRun bool) *Migration {
+	return &Migration{
+		Source:      Options{Metastore: "test-debug-memory"},
+		Destination: Options{Metastore: "test-debug-memory"},
+		DryRun:      dryRun,
+		Verify:      true,
+		BatchSize:   2,
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	source := testMigrationSource(t)
+	destination := persistence.NewMemoryMetastore()
+
+	var batches int
+	report, err := migrateKeys(context.Background(), testMigration(false), source, destination, func(MigrationReport) { batches++ })
+	if err != nil {
+		t.Fatalf("migrateKeys returned %v", err)
+	}
+	if report.Scanned != 3 || report.Copied != 3 || report.Verified != 3 || len(report.Mismatches) != 0 || batches != 4 {
+		t.Errorf("Unexpected report %+v after %d batches", report, batches)
+	}
+
+	ik, err := destination.Load(context.Background(), "_IK_a_s_p", 1700000060)
+	if err != nil || ik == nil || string(ik.EncryptedKey) != "ik-a" || ik.ParentKeyMeta.ID != "_SK_s_p" {
+		t.Errorf("Expected the intermediate key in the destination got %+v, %v", ik, err)
+	}
+
+	report, err = migrateKeys(context.Background(), testMigration(false), source, destination, nil)
+	if err != nil || report.Copied != 0 || report.Unchanged != 3 || report.Verified != 3 {
+		t.Errorf("Expected a second migration to change nothing got %+v, %v", report, err)
+	}
+}
+
+func TestMigrateKeysFromSQL(t *testing.T) {
+	migration := testMigration(false)
+	migration.Source = Options{Metastore: "rdbms", ConnectionString: "migrate-keys-from-sql"}
+	db, mock := newMockConnection(t, "mysql", migration.Source.ConnectionString)
+
+	columns := []string{"id", "key_record"}
+	for range 2 {
+		mock.ExpectQuery(listKeysQuery).WithArgs(2).WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("_IK_a_s_p", `{"Created":1700000060,"Key":"aWstYQ==","ParentKeyMeta":{"KeyId":"_SK_s_p","Created":1700000000}}`).
+			AddRow("_IK_b_s_p", `{"Created":1700000060,"Key":"aWstYg==","ParentKeyMeta":{"KeyId":"_SK_s_p","Created":1700000000}}`))
+		mock.ExpectQuery(listKeysAfterQuery).WithArgs("_IK_b_s_p", "_IK_b_s_p", time.Unix(1700000060, 0), 2).WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("_SK_s_p", `{"Revoked":true,"Created":1700000000,"Key":"c2s="}`))
+	}
+
+	destination := persistence.NewMemoryMetastore()
+	report, err := migrateKeys(context.Background(), migration, persistence.NewSQLMetastore(db), destination, nil)
+	if err != nil {
+		t.Fatalf("migrateKeys returned %v", err)
+	}
+	if report.Scanned != 3 || report.Copied != 3 || report.Verified != 3 || len(report.Mismatches) != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	ik, err := destination.Load(context.Background(), "_IK_b_s_p", 1700000060)
+	if err != nil || ik == nil || string(ik.EncryptedKey) != "ik-b" || ik.ParentKeyMeta.ID != "_SK_s_p" {
+		t.Errorf("Expected the intermediate key in the destination got %+v, %v", ik, err)
+	}
+	if sk, _ := destination.Load(context.Background(), "_SK_s_p", 1700000000); sk == nil || !sk.Revoked || string(sk.EncryptedKey) != "sk" {
+		t.Errorf("Expected the revoked system key in the destination got %+v", sk)
+	}
+}
+
+func TestMigrateKeysDryRun(t *testing.T) {
+	source := testMigrationSource(t)
+	destination := persistence.NewMemoryMetastore()
+
+	report, err := migrateKeys(context.Background(), testMigration(true), source, destination, nil)
+	if err != nil {
+		t.Fatalf("migrateKeys returned %v", err)
+	}
+	if !report.DryRun || report.Copied != 3 || report.Verified != 0 || len(report.Mismatches) != 3 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(destination.Envelopes) != 0 {
+		t.Errorf("Expected a dry run not to write got %v", destination.Envelopes)
+	}
+}
+
+func TestMigrateKeysRevokesAndReportsConflicts(t *testing.T) {
+	source := testMigrationSource(t)
+	destination := persistence.NewMemoryMetastore()
+	if _, err := migrateKeys(context.Background(), testMigration(false), source, destination, nil); err != nil {
+		t.Fatalf("migrateKeys returned %v", err)
+	}
+
+	if err := revokeStoredKey(context.Background(), source, nil, &appencryption.EnvelopeKeyRecord{ID: "_IK_a_s_p", Created: 1700000060}); err != nil {
+		t.Fatalf("revokeStoredKey returned %v", err)
+	}
+	destination.Envelopes["_IK_b_s_p"][1700000060] = &appencryption.EnvelopeKeyRecord{Created: 1700000060, EncryptedKey: []byte("other")}
+
+	report, err := migrateKeys(context.Background(), testMigration(false), source, destination, nil)
+	if err != nil {
+		t.Fatalf("migrateKeys returned %v", err)
+	}
+	if report.Revoked != 1 || report.Unchanged != 1 || len(report.Conflicts) != 1 || report.Conflicts[0].ID != "_IK_b_s_p" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].ID != "_IK_b_s_p" {
+		t.Errorf("Expected the conflicting key to fail verification got %+v", report.Mismatches)
+	}
+
+	if ik, _ := destination.Load(context.Background(), "_IK_a_s_p", 1700000060); ik == nil || !ik.Revoked {
+		t.Errorf("Expected the key to be revoked in the destination got %+v", ik)
+	}
+	if ik, _ := destination.Load(context.Background(), "_IK_b_s_p", 1700000060); ik == nil || string(ik.EncryptedKey) != "other" {
+		t.Errorf("Expected the conflicting key to be left alone got %+v", ik)
+	}
+}
+
+func TestMigrateKeysRejectsBadMigrations(t *testing.T) {
+	for _, migration := range []*Migration{
+		{Destination: Options{Metastore: "test-debug-memory"}},
+		{Source: Options{Metastore: "test-debug-memory"}, Destination: Options{Metastore: "redis"}},
+		{Source: Options{Metastore: "test-debug-memory"}, Destination: Options{Metastore: "rdbms"}},
+		{Source: Options{Metastore: "test-debug-memory"}, Destination: Options{Metastore: "test-debug-memory"}, BatchSize: maxMigrateBatchSize + 1},
+		{Source: Options{Metastore: "test-debug-memory"}, Destination: Options{Metastore: "test-debug-memory", EnableRegionSuffix: true}},
+		{Source: Options{Metastore: "memory"}, Destination: Options{Metastore: "test-debug-memory"}},
+		{Source: Options{Metastore: "test-debug-memory"}, Destination: Options{Metastore: "memory"}},
+	} {
+		if _, err := MigrateKeys(context.Background(), migration, nil); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%+v: expected ErrInvalidConfig got %v", migration, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package asherah
 
 import (
+	"maps"
 	"time"
 )
 
@@ -26,7 +27,29 @@ type Options struct {
 	EnableSessionCaching   bool          `long:"enable-session-caching" description:"Enable shared session caching" env:"ASHERAH_ENABLE_SESSION_CACHING"`
 	DisableZeroCopy    bool          `long:"disable-zero-copy" description:"Disable zero-copy FFI input buffers to prevent use-after-free from caller runtime" env:"ASHERAH_DISABLE_ZERO_COPY"`
 	NullDataCheck      bool          `long:"null-data-check" description:"Log an error if input data is all null before or after encryption" env:"ASHERAH_NULL_DATA_CHECK"`
+	OperationTimeout       time.Duration `long:"operation-timeout" description:"The maximum amount of time an encrypt or decrypt may spend in metastore and KMS calls (0 for no limit)" env:"ASHERAH_OPERATION_TIMEOUT"`
+	EnableMetrics          bool          `long:"enable-metrics" description:"Record operation, session lookup, session cache, KMS and metastore metrics for GetMetricsJson" env:"ASHERAH_ENABLE_METRICS"`
+	MetricsListenAddress   string        `long:"metrics-listen-address" description:"Serve metrics in Prometheus text format at http://<address>/metrics (implies --enable-metrics)" env:"ASHERAH_METRICS_LISTEN_ADDRESS"`
+	TracingEndpoint        string        `long:"tracing-endpoint" description:"Export OpenTelemetry spans over OTLP/HTTP to this collector (host:port or URL)" env:"ASHERAH_TRACING_ENDPOINT"`
+	LogFormat              string        `long:"log-format" choice:"text" choice:"json" default:"text" description:"Write log output as plain text or as one JSON object per line" env:"ASHERAH_LOG_FORMAT"`
+	LogLevel               string        `long:"log-level" choice:"error" choice:"warn" choice:"info" choice:"debug" default:"error" description:"The least severe level of log output to write (Verbose implies debug)" env:"ASHERAH_LOG_LEVEL"`
 	Verbose                bool          `short:"v" long:"verbose" description:"Enable verbose logging output" env:"ASHERAH_VERBOSE"`
 }
 
 type RegionMap map[string]string
+
+func (opts *Options) clone() *Options {
+	c := *opts
+	c.RegionMap = maps.Clone(opts.RegionMap)
+	return &c
+}
+
+// Redacted returns a copy of opts with any password in ConnectionString, DynamoDBEndpoint and
+// TracingEndpoint masked, suitable for logging or returning to callers.
+func (opts *Options) Redacted() *Options {
+	c := opts.clone()
+	c.ConnectionString = redactConnectionString(c.ConnectionString)
+	c.DynamoDBEndpoint = redactConnectionString(c.DynamoDBEndpoint)
+	c.TracingEndpoint = redactConnectionString(c.TracingEndpoint)
+	return c
+}
@@ -0,0 +1,186 @@
+package asherah
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+// PrometheusNamespace is prepended to every metric name in the Prometheus exposition.
+const PrometheusNamespace = "asherah"
+
+var resultMetricName = regexp.MustCompile(`^` + MetricsPrefix + `\.([a-z]+)\.result\.(-?[0-9]+)$`)
+var invalidPrometheusChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// prometheusHelp describes metrics whose go-metrics name alone would mislead. Any other metric is
+// described by its go-metrics name.
+var prometheusHelp = map[string]string{
+	MetricsPrefix + ".session.cache.size": "Approximate upper bound on the sessions held by the session caches; evicted sessions count until garbage collected",
+}
+
+// prometheusFamily is one metric family in the exposition, with a sample per label set.
+type prometheusFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []string
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition format. Timers are
+// written as summaries in seconds, and results counted by RecordResult as a counter per op
+// labelled with the result code.
+func WritePrometheus(w io.Writer) error {
+	families := map[string]*prometheusFamily{}
+	family := func(name string, kind string, help string) *prometheusFamily {
+		f, ok := families[name]
+		if !ok {
+			f = &prometheusFamily{name: name, kind: kind, help: help}
+			families[name] = f
+		}
+		return f
+	}
+
+	for _, registry := range []metrics.Registry{metrics.DefaultRegistry, metricsRegistry} {
+		registry.Each(func(name string, metric interface{}) {
+			if match := resultMetricName.FindStringSubmatch(name); match != nil {
+				counter, ok := metric.(metrics.Counter)
+				if !ok {
+					return
+				}
+				f := family(prometheusName(MetricsPrefix+"."+match[1]+".results")+"_total", "counter",
+					"Calls to "+match[1]+" by result code")
+				f.samples = append(f.samples, fmt.Sprintf("%s{code=%q} %d", f.name, match[2], counter.Count()))
+				return
+			}
+
+			writeMetric(family, prometheusName(name), name, metric)
+		})
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		sort.Strings(f.samples)
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, sample := range f.samples {
+			fmt.Fprintln(out, sample)
+		}
+	}
+
+	return out.Flush()
+}
+
+func writeMetric(family func(string, string, string) *prometheusFamily, name string, source string, metric interface{}) {
+	help, ok := prometheusHelp[source]
+	if !ok {
+		help = source
+	}
+
+	switch m := metric.(type) {
+	case metrics.Counter:
+		f := family(name+"_total", "counter", help)
+		f.samples = append(f.samples, fmt.Sprintf("%s %d", f.name, m.Count()))
+	case metrics.Gauge:
+		f := family(name, "gauge", help)
+		f.samples = append(f.samples, fmt.Sprintf("%s %d", f.name, m.Value()))
+	case metrics.GaugeFloat64:
+		f := family(name, "gauge", help)
+		f.samples = append(f.samples, fmt.Sprintf("%s %g", f.name, m.Value()))
+	case metrics.Meter:
+		f := family(name+"_total", "counter", help)
+		f.samples = append(f.samples, fmt.Sprintf("%s %d", f.name, m.Count()))
+	case metrics.Histogram:
+		s := m.Snapshot()
+		writeSummary(family(name, "summary", help), s.Percentiles([]float64{0.5, 0.95, 0.99}), float64(s.Sum()), s.Count(), 1)
+	case metrics.Timer:
+		s := m.Snapshot()
+		writeSummary(family(name+"_seconds", "summary", help+" (seconds)"), s.Percentiles([]float64{0.5, 0.95, 0.99}), float64(s.Sum()), s.Count(), float64(time.Second))
+	}
+}
+
+func writeSummary(f *prometheusFamily, percentiles []float64, sum float64, count int64, scale float64) {
+	for n, quantile := range []string{"0.5", "0.95", "0.99"} {
+		f.samples = append(f.samples, fmt.Sprintf("%s{quantile=%q} %g", f.name, quantile, percentiles[n]/scale))
+	}
+	f.samples = append(f.samples,
+		fmt.Sprintf("%s_sum %g", f.name, sum/scale),
+		fmt.Sprintf("%s_count %d", f.name, count))
+}
+
+// prometheusName converts a go-metrics name such as "ael.kms.aws.generatedatakey.us-west-2" to a
+// valid Prometheus metric name.
+func prometheusName(name string) string {
+	return PrometheusNamespace + "_" + invalidPrometheusChars.ReplaceAllString(strings.ToLower(name), "_")
+}
+
+// metricsServer serves WritePrometheus at /metrics until closed.
+type metricsServer struct {
+	server *http.Server
+	addr   string
+	done   chan struct{}
+}
+
+func startMetricsServer(address string) (*metricsServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMetricsListenFailed, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := WritePrometheus(w); err != nil {
+			log.ErrorLogf("Failed to write metrics: %v", err)
+		}
+	})
+
+	s := &metricsServer{
+		server: &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		addr:   listener.Addr().String(),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.ErrorLogf("Metrics listener on %v failed: %v", address, err)
+		}
+	}()
+
+	log.DebugLogf("Serving metrics at http://%v/metrics", s.addr)
+
+	return s, nil
+}
+
+// Addr returns the address the listener is bound to, which differs from the configured address when it used port 0.
+func (s *metricsServer) Addr() string {
+	return s.addr
+}
+
+// Close stops accepting scrapes and waits up to five seconds for in-flight ones to finish.
+func (s *metricsServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.ErrorLogf("Failed to stop metrics listener: %v", err)
+	}
+	<-s.done
+}
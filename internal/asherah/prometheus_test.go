@@ -0,0 +1,140 @@
+package asherah
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"weak"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/crypto/aead"
+	"github.com/godaddy/asherah/go/appencryption/pkg/kms"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+func TestPrometheusName(t *testing.T) {
+	got := prometheusName("ael.kms.aws.generatedatakey.us-west-2")
+	if got != "asherah_ael_kms_aws_generatedatakey_us_west_2" {
+		t.Errorf("Unexpected name %v", got)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	enableMetricsForTesting(t)
+
+	RecordResult("encrypt", 0)
+	RecordResult("encrypt", -103)
+	encryptTimer.Update(2 * time.Millisecond)
+
+	var out bytes.Buffer
+	if err := WritePrometheus(&out); err != nil {
+		t.Fatalf("WritePrometheus returned %v", err)
+	}
+
+	text := out.String()
+	for _, expected := range []string{
+		"# TYPE asherah_cobhan_encrypt_results_total counter\n",
+		`asherah_cobhan_encrypt_results_total{code="-103"} `,
+		`asherah_cobhan_encrypt_results_total{code="0"} `,
+		"# TYPE asherah_cobhan_encrypt_seconds summary\n",
+		`asherah_cobhan_encrypt_seconds{quantile="0.99"} `,
+		"asherah_cobhan_encrypt_seconds_count ",
+		"# TYPE asherah_cobhan_metastore_errors_total counter\n",
+		"# HELP asherah_cobhan_session_cache_size Approximate upper bound on the sessions held by the session caches; evicted sessions count until garbage collected\n# TYPE asherah_cobhan_session_cache_size gauge\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected output to contain %q:\n%v", expected, text)
+		}
+	}
+}
+
+func TestWritePrometheusSessionCacheSize(t *testing.T) {
+	enableMetricsForTesting(t)
+
+	previous := cachedSessions
+	cachedSessions = &sessionCacheTracker{seen: map[weak.Pointer[appencryption.Session]]struct{}{}}
+	t.Cleanup(func() { cachedSessions = previous })
+
+	crypto := aead.NewAES256GCM()
+	m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", crypto)
+	if err != nil {
+		t.Fatalf("kms.NewStatic returned %v", err)
+	}
+
+	options := &Options{ServiceName: "TestService", ProductID: "TestProduct", EnableSessionCaching: true}
+	applyDefaults(options)
+	instance := &Instance{
+		sessionFactory: newSessionFactory(options, persistence.NewMemoryMetastore(), m, crypto),
+		options:        options,
+		tracer:         noopTracer,
+	}
+	for _, partition := range []string{"First", "Second", "First"} {
+		if _, err := instance.Encrypt(context.Background(), partition, []byte("InputData"), 0); err != nil {
+			t.Fatalf("Encrypt returned %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WritePrometheus(&out); err != nil {
+		t.Fatalf("WritePrometheus returned %v", err)
+	}
+	if !strings.Contains(out.String(), "\nasherah_cobhan_session_cache_size 2\n") {
+		t.Errorf("Expected a session cache size of 2:\n%v", out.String())
+	}
+
+	instance.sessionFactory.Close()
+
+	for deadline := time.Now().Add(5 * time.Second); cachedSessions.size() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the closed session cache to be released got size %v", cachedSessions.size())
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetricsServerStopsOnClose(t *testing.T) {
+	server, err := startMetricsServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startMetricsServer returned %v", err)
+	}
+
+	url := "http://" + server.Addr() + "/metrics"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %v returned %v", url, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "# TYPE ") {
+		t.Errorf("Unexpected response %v: %s", resp.Status, body)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %v", resp.Header.Get("Content-Type"))
+	}
+
+	server.Close()
+
+	if _, err := http.Get(url); err == nil {
+		t.Error("Expected the listener to be closed")
+	}
+}
+
+func TestMetricsServerListenFailure(t *testing.T) {
+	server, err := startMetricsServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startMetricsServer returned %v", err)
+	}
+	defer server.Close()
+
+	if _, err := startMetricsServer(server.Addr()); !errors.Is(err, ErrMetricsListenFailed) {
+		t.Errorf("Expected ErrMetricsListenFailed got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package asherah
+
+import (
+	"reflect"
+	"slices"
+)
+
+// reloadableFields are the Options that Reconfigure may change. Every other field identifies the
+// keys an instance reads and writes, owns a connection, listener or session cache, or is a
+// process-wide setting read without synchronization (DisableZeroCopy). The session cache fields are
+// left out on purpose: Asherah cannot resize its session cache, and replacing the session factory
+// would empty every session and key cache, causing the burst of KMS and metastore calls that
+// Reconfigure exists to avoid.
+var reloadableFields = []string{
+	"CheckInterval",
+	"ExpireAfter",
+	"LogFormat",
+	"LogLevel",
+	"NullDataCheck",
+	"OperationTimeout",
+	"Verbose",
+}
+
+// GetOptions returns a copy of the effective Options of the instance identified by handle,
+// including the defaults applied by Setup.
+func GetOptions(handle int64) (*Options, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	instance.lock.RLock()
+	defer instance.lock.RUnlock()
+
+	return instance.options.clone(), nil
+}
+
+// Reconfigure applies options to the instance identified by handle without closing it. See
+// Instance.Reconfigure.
+func Reconfigure(handle int64, options *Options) error {
+	instance, err := getInstance(handle)
+	if err != nil {
+		return err
+	}
+
+	return instance.Reconfigure(options)
+}
+
+// Reconfigure applies the reloadableFields of options, waiting for in-flight operations to finish.
+// It returns a ValidationError, changing nothing, if options is invalid or differs from the
+// current options in any other field. CheckInterval and ExpireAfter take effect on the next key
+// lookup and keep every cached key.
+func (i *Instance) Reconfigure(options *Options) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	options = options.clone()
+	applyDefaults(options)
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if err := i.checkOpen(); err != nil {
+		return err
+	}
+
+	var errs ValidationError
+	current, updated := reflect.ValueOf(i.options).Elem(), reflect.ValueOf(options).Elem()
+	for n := 0; n < current.NumField(); n++ {
+		name := current.Type().Field(n).Name
+		if reflect.DeepEqual(current.Field(n).Interface(), updated.Field(n).Interface()) {
+			continue
+		}
+
+		if !slices.Contains(reloadableFields, name) {
+			errs = append(errs, FieldError{Field: name, Message: "is not hot-reloadable; it cannot be changed without Shutdown and Setup"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// The key caches read these from the shared policy on every lookup.
+	i.sessionFactory.Config.Policy.ExpireKeyAfter = options.ExpireAfter
+	i.sessionFactory.Config.Policy.RevokeCheckInterval = options.CheckInterval
+
+	i.options = options
+
+	return nil
+}
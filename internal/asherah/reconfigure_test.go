@@ -0,0 +1,128 @@
+package asherah
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	asherahLog "github.com/godaddy/asherah/go/appencryption/pkg/log"
+)
+
+func newReconfigurableInstance(t *testing.T) int64 {
+	handle, err := CreateInstance(&Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static", EnableSessionCaching: true})
+	if err != nil {
+		t.Fatalf("CreateInstance returned %v", err)
+	}
+	t.Cleanup(func() { _ = DestroyInstance(handle) })
+	return handle
+}
+
+func TestReconfigureKeepsSessionFactory(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	factory := instance.sessionFactory
+
+	options, err := GetOptions(handle)
+	if err != nil {
+		t.Fatalf("GetOptions returned %v", err)
+	}
+	options.CheckInterval = 5 * time.Minute
+	options.ExpireAfter = 48 * time.Hour
+	options.OperationTimeout = time.Second
+	options.NullDataCheck = true
+
+	if err := Reconfigure(handle, options); err != nil {
+		t.Fatalf("Reconfigure returned %v", err)
+	}
+
+	if instance.sessionFactory != factory {
+		t.Error("Expected the session factory to be kept")
+	}
+	if policy := factory.Config.Policy; policy.RevokeCheckInterval != 5*time.Minute || policy.ExpireKeyAfter != 48*time.Hour {
+		t.Errorf("Expected the policy to be updated got %+v", policy)
+	}
+	if current, _ := GetOptions(handle); current.OperationTimeout != time.Second || !current.NullDataCheck {
+		t.Errorf("Expected the options to be updated got %+v", current)
+	}
+}
+
+func TestReconfigureRejectsSessionCacheChanges(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	factory := instance.sessionFactory
+
+	options, _ := GetOptions(handle)
+	options.SessionCacheMaxSize = 10
+	options.DisableZeroCopy = true
+
+	err := Reconfigure(handle, options)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected ErrInvalidConfig got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, fieldError := range err.(ValidationError) {
+		fields[fieldError.Field] = true
+	}
+	if len(fields) != 2 || !fields["DisableZeroCopy"] || !fields["SessionCacheMaxSize"] {
+		t.Errorf("Expected DisableZeroCopy and SessionCacheMaxSize errors got %v", err)
+	}
+
+	if instance.sessionFactory != factory {
+		t.Error("Expected the session factory to be kept")
+	}
+}
+
+func TestReconfigureRejectsIdentityChanges(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+
+	options, _ := GetOptions(handle)
+	options.ServiceName = "other"
+	options.Metastore = "test-debug-memory"
+	options.CheckInterval = time.Minute
+
+	err := Reconfigure(handle, options)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected ErrInvalidConfig got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, fieldError := range err.(ValidationError) {
+		fields[fieldError.Field] = true
+	}
+	if len(fields) != 2 || !fields["ServiceName"] || !fields["Metastore"] {
+		t.Errorf("Expected ServiceName and Metastore errors got %v", err)
+	}
+
+	if current, _ := GetOptions(handle); current.CheckInterval == time.Minute || current.ServiceName != "s" {
+		t.Errorf("Expected nothing to change got %+v", current)
+	}
+}
+
+func TestReconfigureUninitialized(t *testing.T) {
+	if err := Reconfigure(DefaultInstance, &Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static"}); err != ErrAsherahNotInitialized {
+		t.Errorf("Expected ErrAsherahNotInitialized got %v", err)
+	}
+}
+
+func TestAsherahLogFollowsLogLevel(t *testing.T) {
+	var messages []string
+	log.SetCallback(func(level log.Level, timestamp time.Time, component string, message string) {
+		if component == log.ComponentAsherah {
+			messages = append(messages, message)
+		}
+	})
+	t.Cleanup(func() {
+		log.SetCallback(nil)
+		log.SetLevel(log.LevelError)
+	})
+
+	log.SetLevel(log.LevelError)
+	asherahLog.Debugf("hidden")
+	log.SetLevel(log.LevelDebug)
+	asherahLog.Debugf("shown %d", 1)
+
+	if len(messages) != 1 || messages[0] != "shown 1" {
+		t.Errorf("Expected only the message logged at debug level got %q", messages)
+	}
+}
@@ -0,0 +1,106 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// ErrDecryptFailed wraps the error of a Reencrypt that could not decrypt its DataRowRecord, as
+// opposed to one that could not encrypt it again.
+var ErrDecryptFailed = errors.New("failed to decrypt data row record")
+
+// reencrypt decrypts drr with session and encrypts the plaintext again, which uses the current
+// intermediate key of the session's partition. The plaintext is wiped before returning.
+func (i *Instance) reencrypt(ctx context.Context, session *appencryption.Session, drr *appencryption.DataRowRecord, timeout time.Duration) (*appencryption.DataRowRecord, error) {
+	ctx, cancel := i.newContext(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	data, err := session.Decrypt(ctx, *drr)
+	recordOperation(decryptTimer, decryptErrors, start, err)
+	if err != nil {
+		return nil, timeoutError(ctx, fmt.Errorf("%w: %w", ErrDecryptFailed, err))
+	}
+	defer clear(data)
+
+	start = time.Now()
+	reencrypted, err := session.Encrypt(ctx, data)
+	recordOperation(encryptTimer, encryptErrors, start, err)
+	return reencrypted, timeoutError(ctx, err)
+}
+
+// Reencrypt decrypts drr for partitionId and encrypts it again under the partition's current
+// intermediate key, so records written under expired or revoked keys can be migrated. Spans join
+// any trace carried by ctx.
+func (i *Instance) Reencrypt(ctx context.Context, partitionId string, drr *appencryption.DataRowRecord, timeout time.Duration) (reencrypted *appencryption.DataRowRecord, err error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	ctx, span := i.tracer.Start(ctx, "asherah.Reencrypt", trace.WithAttributes(attribute.String("asherah.partition", partitionId)))
+	defer func() { endSpan(span, err) }()
+
+	session, err := i.getSession(ctx, partitionId)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return i.reencrypt(ctx, session, drr, timeout)
+}
+
+// ReencryptBatch re-encrypts each DataRowRecord with a single session for partitionId. Each record
+// gets its own OperationTimeout deadline. The returned error is only set when no record could be
+// attempted; per-record failures are reported in the returned error slice.
+func (i *Instance) ReencryptBatch(partitionId string, drrs []appencryption.DataRowRecord) ([]*appencryption.DataRowRecord, []error, error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	parent, span := i.tracer.Start(context.Background(), "asherah.ReencryptBatch", trace.WithAttributes(
+		attribute.String("asherah.partition", partitionId), attribute.Int("asherah.batch_size", len(drrs))))
+	defer span.End()
+
+	session, err := i.getSession(parent, partitionId)
+	if err != nil {
+		spanError(span, err)
+		return nil, nil, err
+	}
+	defer session.Close()
+
+	reencrypted := make([]*appencryption.DataRowRecord, len(drrs))
+	errs := make([]error, len(drrs))
+	for n := range drrs {
+		reencrypted[n], errs[n] = i.reencrypt(parent, session, &drrs[n], 0)
+	}
+
+	return reencrypted, errs, nil
+}
+
+// ReencryptWithInstance re-encrypts drr using the instance identified by handle. A positive timeout
+// overrides the instance's OperationTimeout.
+func ReencryptWithInstance(ctx context.Context, handle int64, partitionId string, drr *appencryption.DataRowRecord, timeout time.Duration) (*appencryption.DataRowRecord, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to re-encrypt data: instance %v: %v", handle, err)
+		return nil, err
+	}
+
+	return instance.Reencrypt(ctx, partitionId, drr, timeout)
+}
+
+func ReencryptBatchWithInstance(handle int64, partitionId string, drrs []appencryption.DataRowRecord) ([]*appencryption.DataRowRecord, []error, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to re-encrypt batch: instance %v: %v", handle, err)
+		return nil, nil, err
+	}
+
+	return instance.ReencryptBatch(partitionId, drrs)
+}
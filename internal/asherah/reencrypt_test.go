@@ -0,0 +1,50 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+func TestReencryptUsesCurrentIntermediateKey(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	before := testEncrypt(t, handle, "partition")
+
+	if err := RotateKeys(context.Background(), handle, "partition", RotateScope{}); err != nil {
+		t.Fatalf("RotateKeys returned %v", err)
+	}
+
+	after, err := ReencryptWithInstance(context.Background(), handle, "partition", before, 0)
+	if err != nil {
+		t.Fatalf("ReencryptWithInstance returned %v", err)
+	}
+	if after.Key.ParentKeyMeta.Created <= before.Key.ParentKeyMeta.Created {
+		t.Errorf("Expected the rotated intermediate key got %+v", after.Key.ParentKeyMeta)
+	}
+
+	data, err := DecryptWithInstance(context.Background(), handle, "partition", after, 0)
+	if err != nil || string(data) != "data" {
+		t.Errorf("Expected to decrypt the re-encrypted record got %q, %v", data, err)
+	}
+}
+
+func TestReencryptBatchReportsDecryptFailures(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	drr := testEncrypt(t, handle, "partition")
+	corrupt := *drr
+	corrupt.Data = []byte("corrupt")
+
+	reencrypted, errs, err := ReencryptBatchWithInstance(handle, "partition", []appencryption.DataRowRecord{*drr, corrupt})
+	if err != nil {
+		t.Fatalf("ReencryptBatchWithInstance returned %v", err)
+	}
+
+	if errs[0] != nil || reencrypted[0] == nil {
+		t.Errorf("Expected the first record to be re-encrypted got %v", errs[0])
+	}
+	if !errors.Is(errs[1], ErrDecryptFailed) {
+		t.Errorf("Expected ErrDecryptFailed got %v", errs[1])
+	}
+}
@@ -0,0 +1,243 @@
+package asherah
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// RotateScope selects the keys replaced by RotateKeys. The intermediate key of the partition is
+// always replaced when a partition is given, and the system key when none is.
+type RotateScope struct {
+	SystemKey       bool `json:"SystemKey"`
+	IntermediateKey bool `json:"IntermediateKey"`
+}
+
+// RotateKeys replaces keys of the instance identified by handle. See Instance.RotateKeys.
+func RotateKeys(ctx context.Context, handle int64, partitionId string, scope RotateScope) error {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to rotate keys: instance %v: %v", handle, err)
+		return err
+	}
+
+	return instance.RotateKeys(ctx, partitionId, scope)
+}
+
+// RotateKeys stores new keys in the metastore and revokes the keys they replace, so the next write
+// uses the new keys. Rotating the system key revokes the current one, which forces a new
+// intermediate key for every partition of the service on its next write; Asherah can only do so
+// once the minute the old intermediate key was created in has passed, so the intermediate key of
+// partitionId is replaced here as well. It is created under the current system key, or under a
+// new one if the system key is revoked or expired. Revoked keys are kept, so existing data still
+// decrypts. Caches of this instance are emptied; other processes pick up the new keys after their
+// CheckInterval.
+func (i *Instance) RotateKeys(ctx context.Context, partitionId string, scope RotateScope) (err error) {
+	if partitionId != "" {
+		scope.IntermediateKey = true
+	} else if !scope.IntermediateKey {
+		scope.SystemKey = true
+	}
+	if scope.IntermediateKey && partitionId == "" {
+		return ValidationError{{Field: "IntermediateKey", Message: "requires a partition"}}
+	}
+
+	i.keysLock.Lock()
+	defer i.keysLock.Unlock()
+
+	if err := i.rotateKeys(ctx, partitionId, scope); err != nil {
+		return err
+	}
+
+	return i.resetSessionFactory()
+}
+
+// rotateKeys stores the new keys of RotateKeys, holding lock for reading so encrypt and decrypt
+// continue meanwhile.
+func (i *Instance) rotateKeys(ctx context.Context, partitionId string, scope RotateScope) (err error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	if err := i.checkOpen(); err != nil {
+		return err
+	}
+
+	ctx, span := i.tracer.Start(ctx, "asherah.RotateKeys", trace.WithAttributes(
+		attribute.String("asherah.partition", partitionId),
+		attribute.Bool("asherah.system_key", scope.SystemKey),
+		attribute.Bool("asherah.intermediate_key", scope.IntermediateKey)))
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := i.newContext(ctx, 0)
+	defer cancel()
+
+	var sk *appencryption.EnvelopeKeyRecord
+	if scope.SystemKey {
+		if sk, err = i.rotateSystemKey(ctx); err != nil {
+			return timeoutError(ctx, err)
+		}
+	}
+
+	if scope.IntermediateKey {
+		if err = i.rotateIntermediateKey(ctx, i.intermediateKeyID(partitionId), sk); err != nil {
+			return timeoutError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// rotateSystemKey stores a new system key and revokes the one it replaces.
+func (i *Instance) rotateSystemKey(ctx context.Context) (*appencryption.EnvelopeKeyRecord, error) {
+	id := i.systemKeyID()
+	latest, err := i.loadLatestKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sk, err := i.storeSystemKey(ctx, latest)
+	if err != nil {
+		return nil, err
+	}
+
+	if latest != nil {
+		if err := i.revokeKey(ctx, id, latest.Created); err != nil {
+			return nil, err
+		}
+	}
+
+	log.DebugLogf("Rotated system key %s to created %d", id, sk.Created)
+
+	return sk, nil
+}
+
+// storeSystemKey generates a system key, encrypts it with the KMS and stores it after latest.
+func (i *Instance) storeSystemKey(ctx context.Context, latest *appencryption.EnvelopeKeyRecord) (*appencryption.EnvelopeKeyRecord, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+
+	encrypted, err := i.kms.EncryptKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to encrypt system key: %w", ErrKMSFailed, err)
+	}
+
+	sk := &appencryption.EnvelopeKeyRecord{
+		ID:           i.systemKeyID(),
+		Created:      i.nextCreated(latest),
+		EncryptedKey: encrypted,
+	}
+
+	return sk, i.storeKey(ctx, sk)
+}
+
+// rotateIntermediateKey stores a new intermediate key as id, encrypted with sk, and revokes the one
+// it replaces. If sk is nil the latest valid system key is used.
+func (i *Instance) rotateIntermediateKey(ctx context.Context, id string, sk *appencryption.EnvelopeKeyRecord) error {
+	if sk == nil {
+		latest, err := i.loadLatestKey(ctx, i.systemKeyID())
+		if err != nil {
+			return err
+		}
+
+		sk = latest
+		if sk == nil || sk.Revoked || keyExpired(sk.Created, i.options.ExpireAfter) {
+			if sk, err = i.storeSystemKey(ctx, latest); err != nil {
+				return err
+			}
+		}
+	}
+
+	skBytes, err := i.kms.DecryptKey(ctx, sk.EncryptedKey)
+	if err != nil {
+		return fmt.Errorf("%w: failed to decrypt system key: %w", ErrKMSFailed, err)
+	}
+	defer clear(skBytes)
+
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	defer clear(key)
+
+	encrypted, err := i.sessionFactory.Crypto.Encrypt(key, skBytes)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt intermediate key: %w", err)
+	}
+
+	latest, err := i.loadLatestKey(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	ik := &appencryption.EnvelopeKeyRecord{
+		ID:            id,
+		Created:       i.nextCreated(latest),
+		EncryptedKey:  encrypted,
+		ParentKeyMeta: &appencryption.KeyMeta{ID: sk.ID, Created: sk.Created},
+	}
+	if err := i.storeKey(ctx, ik); err != nil {
+		return err
+	}
+
+	if latest != nil {
+		if err := i.revokeKey(ctx, id, latest.Created); err != nil {
+			return err
+		}
+	}
+
+	log.DebugLogf("Rotated intermediate key %s to created %d", id, ik.Created)
+
+	return nil
+}
+
+func (i *Instance) loadLatestKey(ctx context.Context, id string) (*appencryption.EnvelopeKeyRecord, error) {
+	ekr, err := i.metastore.LoadLatest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load key %s: %w", ErrMetastoreFailed, id, err)
+	}
+
+	return ekr, nil
+}
+
+func (i *Instance) storeKey(ctx context.Context, ekr *appencryption.EnvelopeKeyRecord) error {
+	stored, err := i.metastore.Store(ctx, ekr.ID, ekr.Created, ekr)
+	if err != nil {
+		return fmt.Errorf("%w: failed to store key %s created %d: %w", ErrMetastoreFailed, ekr.ID, ekr.Created, err)
+	}
+	if !stored {
+		return fmt.Errorf("%w: key %s created %d already exists", ErrMetastoreFailed, ekr.ID, ekr.Created)
+	}
+
+	return nil
+}
+
+// nextCreated returns the created timestamp for a key replacing latest. Asherah truncates created to
+// the policy's CreateDatePrecision, so a key created earlier in the same interval would otherwise
+// collide with its replacement.
+func (i *Instance) nextCreated(latest *appencryption.EnvelopeKeyRecord) int64 {
+	created := time.Now().Truncate(i.sessionFactory.Config.Policy.CreateDatePrecision).Unix()
+	if latest != nil && latest.Created >= created {
+		created = latest.Created + 1
+	}
+
+	return created
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, appencryption.AES256KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,190 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+func testEncrypt(t *testing.T, handle int64, partitionId string) *appencryption.DataRowRecord {
+	drr, err := EncryptWithInstance(context.Background(), handle, partitionId, []byte("data"), 0)
+	if err != nil {
+		t.Fatalf("EncryptWithInstance returned %v", err)
+	}
+	return drr
+}
+
+func testLoadKey(t *testing.T, instance *Instance, id string, created int64) *appencryption.EnvelopeKeyRecord {
+	ekr, err := instance.metastore.Load(context.Background(), id, created)
+	if err != nil || ekr == nil {
+		t.Fatalf("Load returned %v, %v for %s created %d", ekr, err, id, created)
+	}
+	return ekr
+}
+
+func TestRotateIntermediateKey(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	before := testEncrypt(t, handle, "partition")
+
+	if err := RotateKeys(context.Background(), handle, "partition", RotateScope{}); err != nil {
+		t.Fatalf("RotateKeys returned %v", err)
+	}
+
+	after := testEncrypt(t, handle, "partition")
+	if after.Key.ParentKeyMeta.Created <= before.Key.ParentKeyMeta.Created {
+		t.Errorf("Expected a newer intermediate key got %+v after %+v", after.Key.ParentKeyMeta, before.Key.ParentKeyMeta)
+	}
+
+	if old := testLoadKey(t, instance, before.Key.ParentKeyMeta.ID, before.Key.ParentKeyMeta.Created); !old.Revoked {
+		t.Error("Expected the replaced intermediate key to be revoked")
+	}
+
+	ik := testLoadKey(t, instance, after.Key.ParentKeyMeta.ID, after.Key.ParentKeyMeta.Created)
+	if sk := testLoadKey(t, instance, ik.ParentKeyMeta.ID, ik.ParentKeyMeta.Created); sk.Revoked {
+		t.Error("Expected the system key to be kept")
+	}
+
+	data, err := DecryptWithInstance(context.Background(), handle, "partition", before, 0)
+	if err != nil || string(data) != "data" {
+		t.Errorf("Expected to decrypt data written before rotation got %q, %v", data, err)
+	}
+}
+
+func TestRotateSystemKey(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	before := testEncrypt(t, handle, "partition")
+	oldIK := testLoadKey(t, instance, before.Key.ParentKeyMeta.ID, before.Key.ParentKeyMeta.Created)
+
+	if err := RotateKeys(context.Background(), handle, "", RotateScope{}); err != nil {
+		t.Fatalf("RotateKeys returned %v", err)
+	}
+
+	if oldSK := testLoadKey(t, instance, oldIK.ParentKeyMeta.ID, oldIK.ParentKeyMeta.Created); !oldSK.Revoked {
+		t.Error("Expected the replaced system key to be revoked")
+	}
+
+	after := testEncrypt(t, handle, "other")
+	ik := testLoadKey(t, instance, after.Key.ParentKeyMeta.ID, after.Key.ParentKeyMeta.Created)
+	if ik.ParentKeyMeta.Created <= oldIK.ParentKeyMeta.Created {
+		t.Errorf("Expected a new intermediate key under the new system key got %+v", ik.ParentKeyMeta)
+	}
+
+	data, err := DecryptWithInstance(context.Background(), handle, "partition", before, 0)
+	if err != nil || string(data) != "data" {
+		t.Errorf("Expected to decrypt data written before rotation got %q, %v", data, err)
+	}
+}
+
+func TestRotateSystemKeyForPartition(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	before := testEncrypt(t, handle, "partition")
+	oldIK := testLoadKey(t, instance, before.Key.ParentKeyMeta.ID, before.Key.ParentKeyMeta.Created)
+
+	if err := RotateKeys(context.Background(), handle, "partition", RotateScope{SystemKey: true}); err != nil {
+		t.Fatalf("RotateKeys returned %v", err)
+	}
+
+	after := testEncrypt(t, handle, "partition")
+	ik := testLoadKey(t, instance, after.Key.ParentKeyMeta.ID, after.Key.ParentKeyMeta.Created)
+	if after.Key.ParentKeyMeta.Created <= before.Key.ParentKeyMeta.Created || ik.ParentKeyMeta.Created <= oldIK.ParentKeyMeta.Created {
+		t.Errorf("Expected a new intermediate key under a new system key got %+v under %+v", after.Key.ParentKeyMeta, ik.ParentKeyMeta)
+	}
+}
+
+func TestRotateBothKeysTwiceInOneMinute(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+
+	for n := 0; n < 2; n++ {
+		if err := RotateKeys(context.Background(), handle, "partition", RotateScope{SystemKey: true, IntermediateKey: true}); err != nil {
+			t.Fatalf("RotateKeys returned %v", err)
+		}
+	}
+
+	ik, err := instance.metastore.LoadLatest(context.Background(), instance.intermediateKeyID("partition"))
+	if err != nil || ik == nil {
+		t.Fatalf("LoadLatest returned %v, %v", ik, err)
+	}
+	sk, err := instance.metastore.LoadLatest(context.Background(), instance.systemKeyID())
+	if err != nil || sk == nil {
+		t.Fatalf("LoadLatest returned %v, %v", sk, err)
+	}
+
+	if ik.Revoked || sk.Revoked || *ik.ParentKeyMeta != (appencryption.KeyMeta{ID: sk.ID, Created: sk.Created}) {
+		t.Errorf("Expected the latest intermediate key under the latest system key got %+v under %+v", ik, sk)
+	}
+
+	drr := testEncrypt(t, handle, "partition")
+	if drr.Key.ParentKeyMeta.Created != ik.Created {
+		t.Errorf("Expected the rotated intermediate key to be used got %+v", drr.Key.ParentKeyMeta)
+	}
+}
+
+func TestRotateIntermediateKeyRequiresPartition(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+
+	err := RotateKeys(context.Background(), handle, "", RotateScope{IntermediateKey: true})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig got %v", err)
+	}
+}
+
+func TestRotateKeysUninitialized(t *testing.T) {
+	if err := RotateKeys(context.Background(), DefaultInstance, "partition", RotateScope{}); err != ErrAsherahNotInitialized {
+		t.Errorf("Expected ErrAsherahNotInitialized got %v", err)
+	}
+}
+
+// gatedKMS closes entered on the first DecryptKey and waits for release on every DecryptKey.
+type gatedKMS struct {
+	appencryption.KeyManagementService
+	once    *sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (k gatedKMS) DecryptKey(ctx context.Context, key []byte) ([]byte, error) {
+	k.once.Do(func() { close(k.entered) })
+	<-k.release
+	return k.KeyManagementService.DecryptKey(ctx, key)
+}
+
+func TestRotateKeysDoesNotBlockEncrypt(t *testing.T) {
+	handle := newReconfigurableInstance(t)
+	instance, _ := getInstance(handle)
+	testEncrypt(t, handle, "partition")
+
+	gated := gatedKMS{instance.kms, new(sync.Once), make(chan struct{}), make(chan struct{})}
+	instance.kms = gated
+
+	rotated := make(chan error)
+	go func() { rotated <- RotateKeys(context.Background(), handle, "partition", RotateScope{}) }()
+	<-gated.entered
+
+	encrypted := make(chan error)
+	go func() {
+		_, err := EncryptWithInstance(context.Background(), handle, "partition", []byte("data"), 0)
+		encrypted <- err
+	}()
+
+	select {
+	case err := <-encrypted:
+		if err != nil {
+			t.Errorf("EncryptWithInstance returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected encrypt to proceed while keys rotate")
+	}
+
+	close(gated.release)
+	if err := <-rotated; err != nil {
+		t.Errorf("RotateKeys returned %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package asherah
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// Frame types of the chunked stream envelope. See STREAMING.md for the format.
+const (
+	StreamFrameHeader byte = 1
+	StreamFrameChunk  byte = 2
+	StreamFrameFinal  byte = 3
+)
+
+// StreamFrameOverhead is the number of bytes a frame adds to its payload.
+const StreamFrameOverhead = 5
+
+// StreamChunkOverhead is the number of bytes a chunk frame adds to the plaintext it carries.
+const StreamChunkOverhead = StreamFrameOverhead + 16
+
+const streamKeySize = 32
+
+var ErrStreamNotFound = errors.New("asherah stream not found")
+var ErrStreamMalformedFrame = errors.New("asherah stream frame is malformed")
+var ErrStreamTruncated = errors.New("asherah stream ended before its final chunk")
+var ErrStreamRetryMismatch = errors.New("asherah stream chunk retry does not match the chunk that failed")
+
+var (
+	streamsLock  sync.Mutex
+	streams      = map[int64]*stream{}
+	lastStreamID int64
+)
+
+type stream struct {
+	sync.Mutex
+	aead     cipher.AEAD
+	decrypt  bool
+	index    uint64
+	finished bool
+
+	// pending is the encrypted frame whose output could not be written, and pendingDigest identifies
+	// the chunk it was sealed from. A retry gets the same frame so no nonce seals two plaintexts.
+	pending       []byte
+	pendingDigest [sha256.Size]byte
+}
+
+func newStreamCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func registerStream(s *stream) int64 {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	lastStreamID++
+	streams[lastStreamID] = s
+
+	return lastStreamID
+}
+
+func getStream(handle int64, decrypt bool) (*stream, error) {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	s, ok := streams[handle]
+	if !ok || s.decrypt != decrypt {
+		return nil, ErrStreamNotFound
+	}
+
+	return s, nil
+}
+
+func releaseStream(handle int64) {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	delete(streams, handle)
+}
+
+// nonce binds a chunk to its position and to whether it ends the stream, so reordered,
+// dropped or truncated chunks fail authentication.
+func (s *stream) nonce(final bool) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, s.index)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+
+	return nonce
+}
+
+// chunkDigest identifies a chunk passed to EncryptStreamChunk without keeping its plaintext.
+func chunkDigest(data []byte, final bool) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(data)
+	if final {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+	return digest
+}
+
+func frame(frameType byte, payload []byte) []byte {
+	out := make([]byte, StreamFrameOverhead, StreamFrameOverhead+len(payload))
+	out[0] = frameType
+	binary.BigEndian.PutUint32(out[1:], uint32(len(payload)))
+
+	return append(out, payload...)
+}
+
+func parseFrame(data []byte) (byte, []byte, error) {
+	if len(data) < StreamFrameOverhead {
+		return 0, nil, ErrStreamMalformedFrame
+	}
+
+	length := binary.BigEndian.Uint32(data[1:])
+	if uint64(len(data)-StreamFrameOverhead) != uint64(length) {
+		return 0, nil, ErrStreamMalformedFrame
+	}
+
+	return data[0], data[StreamFrameOverhead:], nil
+}
+
+// BeginEncryptStream generates a stream key, wraps it in a DataRowRecord for partitionId and returns the
+// stream handle along with the header frame that must precede the chunks.
+func BeginEncryptStream(handle int64, partitionId string) (int64, []byte, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to begin encrypt stream: instance %v: %v", handle, err)
+		return 0, nil, err
+	}
+
+	key := make([]byte, streamKeySize)
+	defer clear(key)
+	if _, err := rand.Read(key); err != nil {
+		return 0, nil, err
+	}
+
+	aead, err := newStreamCipher(key)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	drr, err := instance.Encrypt(context.Background(), partitionId, key, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	header, err := json.Marshal(drr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return registerStream(&stream{aead: aead}), frame(StreamFrameHeader, header), nil
+}
+
+// BeginDecryptStream unwraps the stream key from a header frame produced by BeginEncryptStream.
+func BeginDecryptStream(handle int64, partitionId string, header []byte) (int64, error) {
+	instance, err := getInstance(handle)
+	if err != nil {
+		log.ErrorLogf("Failed to begin decrypt stream: instance %v: %v", handle, err)
+		return 0, err
+	}
+
+	frameType, payload, err := parseFrame(header)
+	if err != nil {
+		return 0, err
+	}
+	if frameType != StreamFrameHeader {
+		return 0, ErrStreamMalformedFrame
+	}
+
+	var drr appencryption.DataRowRecord
+	if err := json.Unmarshal(payload, &drr); err != nil {
+		return 0, err
+	}
+
+	key, err := instance.Decrypt(context.Background(), partitionId, &drr, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer clear(key)
+
+	if len(key) != streamKeySize {
+		return 0, ErrStreamMalformedFrame
+	}
+
+	aead, err := newStreamCipher(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return registerStream(&stream{aead: aead, decrypt: true}), nil
+}
+
+// EncryptStreamChunk encrypts data as the next chunk frame and passes it to write. The stream only
+// advances, and the final chunk only releases the stream handle, once write succeeds, so a chunk whose
+// output could not be written can be retried. A retry writes the frame already encrypted and fails with
+// ErrStreamRetryMismatch unless data and final are the same as in the failed call.
+func EncryptStreamChunk(handle int64, data []byte, final bool, write func([]byte) error) error {
+	s, err := getStream(handle, false)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.finished {
+		return ErrStreamNotFound
+	}
+
+	digest := chunkDigest(data, final)
+	out := s.pending
+	if out == nil {
+		frameType := StreamFrameChunk
+		if final {
+			frameType = StreamFrameFinal
+		}
+		out = frame(frameType, s.aead.Seal(nil, s.nonce(final), data, nil))
+	} else if digest != s.pendingDigest {
+		return ErrStreamRetryMismatch
+	}
+
+	if err := write(out); err != nil {
+		s.pending, s.pendingDigest = out, digest
+		return err
+	}
+
+	s.pending = nil
+	s.index++
+	if final {
+		s.finished = true
+		releaseStream(handle)
+	}
+
+	return nil
+}
+
+// DecryptStreamChunk authenticates and decrypts the next chunk frame and passes the plaintext to write.
+// The stream only advances once write succeeds, so a chunk whose output could not be written can be retried.
+func DecryptStreamChunk(handle int64, data []byte, write func([]byte) error) error {
+	s, err := getStream(handle, true)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	frameType, payload, err := parseFrame(data)
+	if err != nil {
+		return err
+	}
+
+	if s.finished || (frameType != StreamFrameChunk && frameType != StreamFrameFinal) {
+		return ErrStreamMalformedFrame
+	}
+
+	final := frameType == StreamFrameFinal
+	plaintext, err := s.aead.Open(nil, s.nonce(final), payload, nil)
+	if err != nil {
+		return err
+	}
+	defer clear(plaintext)
+
+	if err := write(plaintext); err != nil {
+		return err
+	}
+
+	s.index++
+	s.finished = final
+
+	return nil
+}
+
+// FinishDecryptStream releases a decrypt stream handle, failing if the final chunk was never seen.
+func FinishDecryptStream(handle int64) error {
+	s, err := getStream(handle, true)
+	if err != nil {
+		return err
+	}
+
+	releaseStream(handle)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.finished {
+		return ErrStreamTruncated
+	}
+
+	return nil
+}
+
+// AbortStream releases a stream handle of either direction without completing it.
+func AbortStream(handle int64) error {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	if _, ok := streams[handle]; !ok {
+		return ErrStreamNotFound
+	}
+
+	delete(streams, handle)
+	return nil
+}
@@ -0,0 +1,151 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// TracerName is the instrumentation scope of the spans created by asherah-cobhan.
+const TracerName = "github.com/godaddy/asherah-cobhan"
+
+var ErrTracingFailed = errors.New("failed to start tracing")
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+var noopTracer = noop.NewTracerProvider().Tracer(TracerName)
+
+// ContextWithTraceparent returns a context carrying the remote span described by a W3C traceparent
+// value, so that spans started from it join the caller's trace.
+func ContextWithTraceparent(ctx context.Context, traceparent string) (context.Context, error) {
+	if traceparent == "" {
+		return ctx, nil
+	}
+
+	remote := propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+	if !trace.SpanContextFromContext(remote).IsValid() {
+		return ctx, fmt.Errorf("%w: '%s'", ErrInvalidTraceparent, traceparent)
+	}
+
+	return remote, nil
+}
+
+// newTracerProvider exports spans over OTLP/HTTP to options.TracingEndpoint, which is either a
+// host:port (plain HTTP, default /v1/traces path) or a full collector URL.
+func newTracerProvider(options *Options) (*sdktrace.TracerProvider, error) {
+	var exporterOptions []otlptracehttp.Option
+	if strings.Contains(options.TracingEndpoint, "://") {
+		u, err := url.Parse(options.TracingEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid tracing endpoint '%s': %w", ErrTracingFailed, options.TracingEndpoint, err)
+		}
+		exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(options.TracingEndpoint))
+		if u.Path == "" || u.Path == "/" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithURLPath("/v1/traces"))
+		}
+	} else {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithEndpoint(options.TracingEndpoint), otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTracingFailed, err)
+	}
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName("asherah-cobhan"),
+		attribute.String("asherah.service", options.ServiceName),
+		attribute.String("asherah.product", options.ProductID),
+	)
+
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
+
+// shutdownTracerProvider flushes pending spans, waiting up to five seconds for the collector.
+func shutdownTracerProvider(provider *sdktrace.TracerProvider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return provider.Shutdown(ctx)
+}
+
+// spanError marks span as failed with err, if any.
+func spanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// endSpan records err, if any, on span before ending it.
+func endSpan(span trace.Span, err error) {
+	spanError(span, err)
+	span.End()
+}
+
+// tracedMetastore wraps every metastore call in a span.
+type tracedMetastore struct {
+	appencryption.Metastore
+	tracer trace.Tracer
+}
+
+func (m tracedMetastore) Load(ctx context.Context, id string, created int64) (*appencryption.EnvelopeKeyRecord, error) {
+	ctx, span := m.tracer.Start(ctx, "metastore.Load", trace.WithAttributes(attribute.String("asherah.key_id", id), attribute.Int64("asherah.key_created", created)))
+	ekr, err := m.Metastore.Load(ctx, id, created)
+	endSpan(span, err)
+	return ekr, err
+}
+
+func (m tracedMetastore) LoadLatest(ctx context.Context, id string) (*appencryption.EnvelopeKeyRecord, error) {
+	ctx, span := m.tracer.Start(ctx, "metastore.LoadLatest", trace.WithAttributes(attribute.String("asherah.key_id", id)))
+	ekr, err := m.Metastore.LoadLatest(ctx, id)
+	endSpan(span, err)
+	return ekr, err
+}
+
+func (m tracedMetastore) Store(ctx context.Context, id string, created int64, envelope *appencryption.EnvelopeKeyRecord) (bool, error) {
+	ctx, span := m.tracer.Start(ctx, "metastore.Store", trace.WithAttributes(attribute.String("asherah.key_id", id), attribute.Int64("asherah.key_created", created)))
+	stored, err := m.Metastore.Store(ctx, id, created, envelope)
+	span.SetAttributes(attribute.Bool("asherah.stored", stored))
+	endSpan(span, err)
+	return stored, err
+}
+
+// GetRegionSuffix forwards to the wrapped metastore so region-suffixed key IDs are kept.
+func (m tracedMetastore) GetRegionSuffix() string {
+	return regionSuffix(m.Metastore)
+}
+
+// tracedKMS wraps every KMS call in a span.
+type tracedKMS struct {
+	appencryption.KeyManagementService
+	tracer trace.Tracer
+}
+
+func (k tracedKMS) EncryptKey(ctx context.Context, key []byte) ([]byte, error) {
+	ctx, span := k.tracer.Start(ctx, "kms.EncryptKey")
+	encrypted, err := k.KeyManagementService.EncryptKey(ctx, key)
+	endSpan(span, err)
+	return encrypted, err
+}
+
+func (k tracedKMS) DecryptKey(ctx context.Context, key []byte) ([]byte, error) {
+	ctx, span := k.tracer.Start(ctx, "kms.DecryptKey")
+	decrypted, err := k.KeyManagementService.DecryptKey(ctx, key)
+	endSpan(span, err)
+	return decrypted, err
+}
@@ -0,0 +1,90 @@
+package asherah
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/crypto/aead"
+	"github.com/godaddy/asherah/go/appencryption/pkg/kms"
+	"github.com/godaddy/asherah/go/appencryption/pkg/persistence"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestContextWithTraceparent(t *testing.T) {
+	ctx, err := ContextWithTraceparent(context.Background(), testTraceparent)
+	if err != nil {
+		t.Fatalf("ContextWithTraceparent returned %v", err)
+	}
+	if ctx == context.Background() {
+		t.Error("Expected a context carrying the remote span")
+	}
+
+	if _, err := ContextWithTraceparent(context.Background(), "not-a-traceparent"); !errors.Is(err, ErrInvalidTraceparent) {
+		t.Errorf("Expected ErrInvalidTraceparent got %v", err)
+	}
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4318", "http://localhost:4318", "https://collector.example.com/custom/traces"} {
+		provider, err := newTracerProvider(&Options{TracingEndpoint: endpoint})
+		if err != nil {
+			t.Errorf("newTracerProvider(%v) returned %v", endpoint, err)
+			continue
+		}
+		shutdownTracerProvider(provider)
+	}
+}
+
+func TestInstanceEncryptSpansJoinTraceparent(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer(TracerName)
+
+	crypto := aead.NewAES256GCM()
+	m, err := kms.NewStatic("thisIsAStaticMasterKeyForTesting", crypto)
+	if err != nil {
+		t.Fatalf("kms.NewStatic returned %v", err)
+	}
+
+	instance := &Instance{
+		sessionFactory: appencryption.NewSessionFactory(
+			&appencryption.Config{Service: "TestService", Product: "TestProduct", Policy: appencryption.NewCryptoPolicy()},
+			tracedMetastore{persistence.NewMemoryMetastore(), tracer},
+			tracedKMS{m, tracer},
+			crypto,
+		),
+		options: &Options{},
+		tracer:  tracer,
+	}
+	defer instance.sessionFactory.Close()
+
+	ctx, err := ContextWithTraceparent(context.Background(), testTraceparent)
+	if err != nil {
+		t.Fatalf("ContextWithTraceparent returned %v", err)
+	}
+
+	if _, err := instance.Encrypt(ctx, "Partition", []byte("InputData"), 0); err != nil {
+		t.Fatalf("Encrypt returned %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, span := range exporter.GetSpans() {
+		names[span.Name] = true
+		if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Span %v is not part of the caller's trace: %v", span.Name, span.SpanContext.TraceID())
+		}
+	}
+
+	for _, expected := range []string{"asherah.Encrypt", "asherah.GetSession", "metastore.LoadLatest", "metastore.Store", "kms.EncryptKey"} {
+		if !names[expected] {
+			t.Errorf("Expected span %v, got %v", expected, names)
+		}
+	}
+}
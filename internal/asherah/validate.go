@@ -0,0 +1,204 @@
+package asherah
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// hiddenChoices are accepted in addition to the choice tags, but not advertised.
+var hiddenChoices = map[string][]string{
+	"Metastore": {"test-debug-memory"},
+	"KMS":       {"test-debug-static"},
+}
+
+// caseInsensitiveChoices are the fields whose choice values are matched ignoring case, as the log
+// package parses them.
+var caseInsensitiveChoices = []string{"LogFormat", "LogLevel"}
+
+// choiceErrors are the errors an invalid value of these fields is also reported as, so callers can
+// tell them apart from other validation problems.
+var choiceErrors = map[string]error{
+	"Metastore":              ErrUnknownMetastore,
+	"ReplicaReadConsistency": ErrReplicaReadConsistency,
+}
+
+// FieldError describes one problem with an Options field. Field is empty for problems with the
+// configuration as a whole.
+type FieldError struct {
+	Field   string `json:"Field"`
+	Message string `json:"Message"`
+	cause   error
+}
+
+// ValidationError lists every problem found by Validate. It wraps ErrInvalidConfig, along with
+// ErrUnknownMetastore or ErrReplicaReadConsistency when those fields have invalid values.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	problems := make([]string, len(e))
+	for n, fieldError := range e {
+		if fieldError.Field == "" {
+			problems[n] = fieldError.Message
+		} else {
+			problems[n] = fieldError.Field + ": " + fieldError.Message
+		}
+	}
+
+	return fmt.Sprintf("%v: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+}
+
+func (e ValidationError) Unwrap() []error {
+	errs := []error{ErrInvalidConfig}
+	for _, fieldError := range e {
+		if fieldError.cause != nil {
+			errs = append(errs, fieldError.cause)
+		}
+	}
+
+	return errs
+}
+
+// Validate checks required fields, choice values and field combinations without connecting to
+// anything. It returns a ValidationError listing every problem, or nil.
+func (opts *Options) Validate() error {
+	var errs ValidationError
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	value := reflect.ValueOf(opts).Elem()
+	for n := 0; n < value.NumField(); n++ {
+		field := value.Type().Field(n)
+		fieldValue := value.Field(n)
+
+		if field.Tag.Get("required") != "" && fieldValue.IsZero() {
+			errs = append(errs, FieldError{Field: field.Name, Message: "is required", cause: choiceErrors[field.Name]})
+			continue
+		}
+
+		choices := tagChoices(field.Tag)
+		if len(choices) == 0 || fieldValue.Kind() != reflect.String || fieldValue.String() == "" {
+			continue
+		}
+
+		if !isChoice(field.Name, choices, fieldValue.String()) {
+			errs = append(errs, FieldError{
+				Field:   field.Name,
+				Message: fmt.Sprintf("unknown value '%s' (valid options: %s)", fieldValue.String(), strings.Join(choices, ", ")),
+				cause:   choiceErrors[field.Name],
+			})
+		}
+	}
+
+	for name, number := range map[string]int64{
+		"ExpireAfter":          int64(opts.ExpireAfter),
+		"CheckInterval":        int64(opts.CheckInterval),
+		"SessionCacheDuration": int64(opts.SessionCacheDuration),
+		"OperationTimeout":     int64(opts.OperationTimeout),
+		"SessionCacheMaxSize":  int64(opts.SessionCacheMaxSize),
+	} {
+		if number < 0 {
+			add(name, "must not be negative")
+		}
+	}
+
+	errs = append(errs, metastoreFieldErrors(opts, "")...)
+
+	if opts.KMS == "" || opts.KMS == "aws" {
+		if len(opts.RegionMap) == 0 {
+			add("RegionMap", "is required when KMS is aws")
+		}
+		if opts.PreferredRegion == "" {
+			add("PreferredRegion", "is required when KMS is aws")
+		} else if len(opts.RegionMap) > 0 {
+			if _, ok := opts.RegionMap[opts.PreferredRegion]; !ok {
+				add("PreferredRegion", "region '%s' is not in RegionMap", opts.PreferredRegion)
+			}
+		}
+	}
+
+	if opts.MetricsListenAddress != "" {
+		if _, _, err := net.SplitHostPort(opts.MetricsListenAddress); err != nil {
+			add("MetricsListenAddress", "%v", err)
+		}
+	}
+
+	if strings.Contains(opts.TracingEndpoint, "://") {
+		if u, err := url.Parse(opts.TracingEndpoint); err != nil {
+			add("TracingEndpoint", "%v", err)
+		} else if u.Host == "" {
+			add("TracingEndpoint", "URL has no host")
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(errs, func(a, b FieldError) int {
+		return strings.Compare(a.Field, b.Field)
+	})
+
+	return errs
+}
+
+func isChoice(field string, choices []string, value string) bool {
+	if slices.Contains(caseInsensitiveChoices, field) {
+		return slices.ContainsFunc(choices, func(choice string) bool { return strings.EqualFold(choice, value) })
+	}
+
+	return slices.Contains(choices, value) || slices.Contains(hiddenChoices[field], value)
+}
+
+// metastoreFieldErrors checks the fields of opts the metastore depends on beyond their choice tags,
+// naming each field with prefix.
+func metastoreFieldErrors(opts *Options, prefix string) ValidationError {
+	var errs ValidationError
+	if opts.Metastore == "rdbms" {
+		if opts.ConnectionString == "" {
+			errs = append(errs, FieldError{Field: prefix + "ConnectionString", Message: "is required when Metastore is rdbms"})
+		}
+		if dbType := sqlMetastoreDBType(opts); !slices.Contains(sql.Drivers(), dbType) {
+			errs = append(errs, FieldError{Field: prefix + "SQLMetastoreDBType", Message: fmt.Sprintf("database driver '%s' is not built into this library", dbType)})
+		}
+	}
+
+	return errs
+}
+
+// Choices returns the documented values of the Options field named field, or nil if the field
+// does not restrict its values.
+func Choices(field string) []string {
+	structField, ok := reflect.TypeOf(Options{}).FieldByName(field)
+	if !ok {
+		return nil
+	}
+
+	return tagChoices(structField.Tag)
+}
+
+// tagChoices returns the values of every choice:"..." in tag.
+func tagChoices(tag reflect.StructTag) []string {
+	var choices []string
+	for rest := string(tag); ; {
+		index := strings.Index(rest, `choice:"`)
+		if index < 0 {
+			return choices
+		}
+		rest = rest[index+len(`choice:"`):]
+		end := strings.IndexByte(rest, '"')
+		if end < 0 {
+			return choices
+		}
+		choices = append(choices, rest[:end])
+		rest = rest[end+1:]
+	}
+}
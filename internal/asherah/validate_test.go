@@ -0,0 +1,81 @@
+package asherah
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func invalidFields(t *testing.T, opts *Options) map[string]bool {
+	err := opts.Validate()
+	if err == nil {
+		return map[string]bool{}
+	}
+
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected ErrInvalidConfig got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, fieldError := range err.(ValidationError) {
+		fields[fieldError.Field] = true
+	}
+	return fields
+}
+
+func TestValidateValidConfigs(t *testing.T) {
+	for _, opts := range []*Options{
+		{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static"},
+		{ServiceName: "s", ProductID: "p", Metastore: "test-debug-memory", KMS: "test-debug-static"},
+		{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static", LogLevel: "DEBUG", LogFormat: "Json"},
+		{ServiceName: "s", ProductID: "p", Metastore: "rdbms", ConnectionString: "user@tcp(localhost:3306)/db", SQLMetastoreDBType: "postgres", KMS: "static"},
+		{ServiceName: "s", ProductID: "p", Metastore: "dynamodb", KMS: "aws", RegionMap: RegionMap{"us-west-2": "arn"}, PreferredRegion: "us-west-2"},
+	} {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid got %v", opts, err)
+		}
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	opts := &Options{
+		Metastore:              "rdbms",
+		ReplicaReadConsistency: "sometimes",
+		SQLMetastoreDBType:     "oracle",
+		KMS:                    "aws",
+		PreferredRegion:        "us-east-1",
+		OperationTimeout:       -time.Second,
+		LogLevel:               "trace",
+		MetricsListenAddress:   "9090",
+	}
+
+	fields := invalidFields(t, opts)
+	for _, expected := range []string{
+		"ServiceName", "ProductID", "ConnectionString", "ReplicaReadConsistency", "SQLMetastoreDBType",
+		"RegionMap", "OperationTimeout", "LogLevel", "MetricsListenAddress",
+	} {
+		if !fields[expected] {
+			t.Errorf("Expected an error for %v got %v", expected, opts.Validate())
+		}
+	}
+}
+
+func TestValidatePreferredRegionMustBeInRegionMap(t *testing.T) {
+	opts := &Options{ServiceName: "s", ProductID: "p", Metastore: "memory", RegionMap: RegionMap{"us-west-2": "arn"}, PreferredRegion: "us-east-1"}
+
+	if fields := invalidFields(t, opts); len(fields) != 1 || !fields["PreferredRegion"] {
+		t.Errorf("Expected only a PreferredRegion error got %v", opts.Validate())
+	}
+}
+
+func TestValidateWrapsChoiceErrors(t *testing.T) {
+	err := (&Options{ServiceName: "s", ProductID: "p", Metastore: "unknown", KMS: "static"}).Validate()
+	if !errors.Is(err, ErrInvalidConfig) || !errors.Is(err, ErrUnknownMetastore) || errors.Is(err, ErrReplicaReadConsistency) {
+		t.Errorf("Expected ErrInvalidConfig and ErrUnknownMetastore got %v", err)
+	}
+
+	err = (&Options{ServiceName: "s", ProductID: "p", Metastore: "memory", KMS: "static", ReplicaReadConsistency: "sometimes"}).Validate()
+	if !errors.Is(err, ErrReplicaReadConsistency) || errors.Is(err, ErrUnknownMetastore) {
+		t.Errorf("Expected ErrReplicaReadConsistency got %v", err)
+	}
+}
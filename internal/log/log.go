@@ -1,36 +1,222 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-var DebugLog func(interface{}) = nil
-var DebugLogf func(format string, args ...interface{}) = nil
-var ErrorLog func(interface{}) = stderrDebugLog
-var ErrorLogf func(format string, args ...interface{}) = stderrDebugLogf
+// Level is the severity of a message, also passed to a Callback. The values are part of the FFI contract.
+type Level int32
+
+const (
+	LevelError Level = 1
+	LevelWarn  Level = 2
+	LevelInfo  Level = 3
+	LevelDebug Level = 4
+)
+
+var levelNames = map[Level]string{
+	LevelError: "error",
+	LevelWarn:  "warn",
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel converts a LogLevel option (error, warn, info or debug) to a Level.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level '%s' (valid options: error, warn, info, debug)", name)
+}
+
+// Output formats accepted by SetFormat.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Components passed to a Callback.
+const (
+	ComponentCobhan  = "asherah-cobhan"
+	ComponentAsherah = "asherah"
+)
+
+// Fields are structured values attached to a message, such as op, partition, duration_ms and error_code.
+type Fields map[string]interface{}
+
+// Callback receives every log message instead of stderr once set with SetCallback.
+type Callback func(level Level, timestamp time.Time, component string, message string)
+
+var callback atomic.Pointer[Callback]
+var threshold atomic.Int32
+var jsonFormat atomic.Bool
+
+func init() {
+	threshold.Store(int32(LevelError))
+}
+
+var ErrorLog func(interface{}) = errorLog
+var ErrorLogf func(format string, args ...interface{}) = errorLogf
 
 func EnableVerboseLog(flag bool) {
 	if flag {
-		DebugLog = stderrDebugLog
-		DebugLogf = stderrDebugLogf
+		SetLevel(LevelDebug)
 		DebugLog("asherah-cobhan: Enabled debug log")
 	} else {
-		DebugLog = nullDebugLog
-		DebugLogf = nullDebugLogf
+		SetLevel(LevelError)
+	}
+}
+
+// SetLevel discards messages less severe than level. It is safe to call while other goroutines log.
+func SetLevel(level Level) {
+	threshold.Store(int32(level))
+}
+
+// ParseFormat converts a LogFormat option (text or json, empty meaning text) to FormatText or FormatJSON.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown log format '%s' (valid options: text, json)", format)
+}
+
+// SetFormat selects text (the default) or json output, one object per line.
+func SetFormat(format string) error {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	jsonFormat.Store(format == FormatJSON)
+	return nil
+}
+
+// Enabled reports whether messages at level are written.
+func Enabled(level Level) bool {
+	return level <= Level(threshold.Load())
+}
+
+// SetCallback routes log output to fn, or back to stderr if fn is nil.
+func SetCallback(fn Callback) {
+	if fn == nil {
+		callback.Store(nil)
+		return
+	}
+	callback.Store(&fn)
+}
+
+// Logf writes a message for component at level.
+func Logf(level Level, component string, format string, args ...interface{}) {
+	if Enabled(level) {
+		write(level, component, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+// LogFields writes message with structured fields for component at level.
+func LogFields(level Level, component string, message string, fields Fields) {
+	if Enabled(level) {
+		write(level, component, message, fields)
+	}
+}
+
+// WriteFields writes message with structured fields for component at level, even if SetLevel
+// discards level. Use it for output the caller asked for explicitly.
+func WriteFields(level Level, component string, message string, fields Fields) {
+	write(level, component, message, fields)
+}
+
+func write(level Level, component string, message string, fields Fields) {
+	timestamp := time.Now()
+	if jsonFormat.Load() {
+		message = formatJSON(level, timestamp, component, message, fields)
+	} else {
+		message = formatText(message, fields)
+	}
+
+	if fn := callback.Load(); fn != nil {
+		(*fn)(level, timestamp, component, message)
+		return
+	}
+
+	if jsonFormat.Load() {
+		fmt.Fprintln(os.Stderr, message)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %s\n", component, message)
+}
+
+func formatText(message string, fields Fields) string {
+	if len(fields) == 0 {
+		return message
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(message)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%v", key, fields[key])
+	}
+	return b.String()
+}
+
+func formatJSON(level Level, timestamp time.Time, component string, message string, fields Fields) string {
+	entry := make(map[string]interface{}, len(fields)+4)
+	for key, value := range fields {
+		entry[key] = value
 	}
+	entry["time"] = timestamp.Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["component"] = component
+	entry["msg"] = message
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf(`{"level":"error","component":%q,"msg":"failed to encode log entry: %v"}`, ComponentCobhan, err)
+	}
+	return string(line)
 }
 
-func stderrDebugLog(output interface{}) {
-	fmt.Fprintf(os.Stderr, "asherah-cobhan: %#v\n", output)
+func errorLog(output interface{}) {
+	write(LevelError, ComponentCobhan, fmt.Sprint(output), nil)
 }
 
-func stderrDebugLogf(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "asherah-cobhan: "+format+"\n", args...)
+func errorLogf(format string, args ...interface{}) {
+	write(LevelError, ComponentCobhan, fmt.Sprintf(format, args...), nil)
 }
 
-func nullDebugLog(output interface{}) {
+// DebugLog writes output at debug level when debug output is enabled.
+func DebugLog(output interface{}) {
+	if Enabled(LevelDebug) {
+		write(LevelDebug, ComponentCobhan, fmt.Sprint(output), nil)
+	}
 }
 
-func nullDebugLogf(format string, args ...interface{}) {
+// DebugLogf writes a formatted message at debug level when debug output is enabled.
+func DebugLogf(format string, args ...interface{}) {
+	if Enabled(LevelDebug) {
+		write(LevelDebug, ComponentCobhan, fmt.Sprintf(format, args...), nil)
+	}
 }
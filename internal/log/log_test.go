@@ -0,0 +1,188 @@
+package log
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type capturedMessage struct {
+	level     Level
+	component string
+	message   string
+}
+
+func captureLog(t *testing.T) *[]capturedMessage {
+	var captured []capturedMessage
+	SetCallback(func(level Level, timestamp time.Time, component string, message string) {
+		if timestamp.IsZero() {
+			t.Errorf("Callback received zero timestamp")
+		}
+		captured = append(captured, capturedMessage{level, component, message})
+	})
+	t.Cleanup(func() {
+		SetCallback(nil)
+		EnableVerboseLog(false)
+	})
+	return &captured
+}
+
+func TestCallbackReceivesErrorLog(t *testing.T) {
+	captured := captureLog(t)
+
+	ErrorLogf("failed: %v", 42)
+
+	expected := capturedMessage{LevelError, ComponentCobhan, "failed: 42"}
+	if len(*captured) != 1 || (*captured)[0] != expected {
+		t.Errorf("Expected %+v got %+v", expected, *captured)
+	}
+}
+
+func TestCallbackReceivesDebugLogOnlyWhenVerbose(t *testing.T) {
+	captured := captureLog(t)
+
+	EnableVerboseLog(false)
+	Logf(LevelDebug, ComponentAsherah, "hidden")
+	if len(*captured) != 0 {
+		t.Errorf("Expected no debug messages got %+v", *captured)
+	}
+
+	EnableVerboseLog(true)
+	Logf(LevelDebug, ComponentAsherah, "shown %s", "here")
+
+	last := (*captured)[len(*captured)-1]
+	expected := capturedMessage{LevelDebug, ComponentAsherah, "shown here"}
+	if last != expected {
+		t.Errorf("Expected %+v got %+v", expected, last)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"error", "warn", "INFO", "debug"} {
+		level, err := ParseLevel(name)
+		if err != nil {
+			t.Errorf("ParseLevel(%v) returned %v", name, err)
+			continue
+		}
+		if !strings.EqualFold(level.String(), name) {
+			t.Errorf("ParseLevel(%v) returned %v", name, level)
+		}
+	}
+
+	if _, err := ParseLevel("trace"); err == nil {
+		t.Error("Expected ParseLevel to reject trace")
+	}
+}
+
+func TestSetLevelFiltersLessSevereMessages(t *testing.T) {
+	captured := captureLog(t)
+
+	SetLevel(LevelWarn)
+	Logf(LevelInfo, ComponentCobhan, "hidden")
+	Logf(LevelWarn, ComponentCobhan, "shown")
+
+	expected := capturedMessage{LevelWarn, ComponentCobhan, "shown"}
+	if len(*captured) != 1 || (*captured)[0] != expected {
+		t.Errorf("Expected %+v got %+v", expected, *captured)
+	}
+}
+
+func TestWriteFieldsIgnoresLevel(t *testing.T) {
+	captured := captureLog(t)
+
+	SetLevel(LevelError)
+	WriteFields(LevelInfo, ComponentCobhan, "progress", Fields{"scanned": 3})
+
+	expected := capturedMessage{LevelInfo, ComponentCobhan, "progress scanned=3"}
+	if len(*captured) != 1 || (*captured)[0] != expected {
+		t.Errorf("Expected %+v got %+v", expected, *captured)
+	}
+}
+
+func TestSetFormatRejectsUnknownFormat(t *testing.T) {
+	if err := SetFormat("xml"); err == nil {
+		t.Error("Expected SetFormat to reject xml")
+	}
+}
+
+func TestTextFormatAppendsFields(t *testing.T) {
+	captured := captureLog(t)
+
+	SetLevel(LevelInfo)
+	LogFields(LevelInfo, ComponentCobhan, "encrypt completed", Fields{"op": "encrypt", "error_code": 0})
+
+	expected := capturedMessage{LevelInfo, ComponentCobhan, "encrypt completed error_code=0 op=encrypt"}
+	if len(*captured) != 1 || (*captured)[0] != expected {
+		t.Errorf("Expected %+v got %+v", expected, *captured)
+	}
+}
+
+func TestJsonFormatWritesOneObjectPerMessage(t *testing.T) {
+	captured := captureLog(t)
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetFormat(FormatText) })
+
+	EnableVerboseLog(true)
+	LogFields(LevelInfo, ComponentCobhan, "decrypt failed", Fields{
+		"op":          "decrypt",
+		"partition":   "partition1",
+		"duration_ms": 1.5,
+		"error_code":  -104,
+	})
+	Logf(LevelDebug, ComponentAsherah, "loading key %s", "_IK_partition1")
+
+	if len(*captured) < 2 {
+		t.Fatalf("Expected at least 2 messages got %+v", *captured)
+	}
+
+	var entry map[string]interface{}
+	last := (*captured)[len(*captured)-2]
+	if err := json.Unmarshal([]byte(last.message), &entry); err != nil {
+		t.Fatalf("Message is not JSON: %v: %v", last.message, err)
+	}
+	for key, value := range map[string]interface{}{
+		"level":       "info",
+		"component":   ComponentCobhan,
+		"msg":         "decrypt failed",
+		"op":          "decrypt",
+		"partition":   "partition1",
+		"duration_ms": 1.5,
+		"error_code":  float64(-104),
+	} {
+		if entry[key] != value {
+			t.Errorf("Expected %v to be %v got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Error("Expected time field")
+	}
+
+	last = (*captured)[len(*captured)-1]
+	entry = nil
+	if err := json.Unmarshal([]byte(last.message), &entry); err != nil {
+		t.Fatalf("Forwarded message is not JSON: %v: %v", last.message, err)
+	}
+	if entry["component"] != ComponentAsherah || entry["msg"] != "loading key _IK_partition1" {
+		t.Errorf("Unexpected forwarded message %v", entry)
+	}
+}
+
+func TestSetLevelWhileLogging(t *testing.T) {
+	captureLog(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; n < 100; n++ {
+			DebugLogf("message %v", n)
+		}
+	}()
+
+	for n := 0; n < 100; n++ {
+		SetLevel(LevelError + Level(n%4))
+	}
+	<-done
+}
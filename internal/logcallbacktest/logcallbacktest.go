@@ -0,0 +1,105 @@
+// Package logcallbacktest provides a C log callback for tests of SetLogCallback, which cannot use
+// cgo in _test.go files. The callback records every call it receives.
+package logcallbacktest
+
+/*
+#include <pthread.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+#define MAX_CALLS 64
+
+typedef struct {
+	int32_t level;
+	int64_t timestamp_ms;
+	char *component;
+	char *message;
+} recorded_call;
+
+static pthread_mutex_t calls_lock = PTHREAD_MUTEX_INITIALIZER;
+static recorded_call calls[MAX_CALLS];
+static int call_count = 0;
+
+static void record_log_callback(int32_t level, int64_t timestamp_ms, const char *component, const char *message) {
+	pthread_mutex_lock(&calls_lock);
+	if (call_count < MAX_CALLS) {
+		calls[call_count].level = level;
+		calls[call_count].timestamp_ms = timestamp_ms;
+		calls[call_count].component = strdup(component);
+		calls[call_count].message = strdup(message);
+		call_count++;
+	}
+	pthread_mutex_unlock(&calls_lock);
+}
+
+static void *record_log_callback_ptr(void) {
+	return (void *)record_log_callback;
+}
+
+static int copy_calls(recorded_call *out, int max) {
+	pthread_mutex_lock(&calls_lock);
+	int n = call_count < max ? call_count : max;
+	for (int i = 0; i < n; i++) {
+		out[i].level = calls[i].level;
+		out[i].timestamp_ms = calls[i].timestamp_ms;
+		out[i].component = strdup(calls[i].component);
+		out[i].message = strdup(calls[i].message);
+	}
+	pthread_mutex_unlock(&calls_lock);
+	return n;
+}
+
+static void reset_calls(void) {
+	pthread_mutex_lock(&calls_lock);
+	for (int i = 0; i < call_count; i++) {
+		free(calls[i].component);
+		free(calls[i].message);
+	}
+	call_count = 0;
+	pthread_mutex_unlock(&calls_lock);
+}
+*/
+import "C"
+import (
+	"time"
+	"unsafe"
+)
+
+// Call is one invocation of the callback.
+type Call struct {
+	Level     int32
+	Timestamp time.Time
+	Component string
+	Message   string
+}
+
+// Callback returns a pointer to the recording C function, to pass to SetLogCallback.
+func Callback() unsafe.Pointer {
+	return C.record_log_callback_ptr()
+}
+
+// Calls returns the calls recorded since the last Reset, up to 64.
+func Calls() []Call {
+	var recorded [C.MAX_CALLS]C.recorded_call
+	n := int(C.copy_calls(&recorded[0], C.MAX_CALLS))
+
+	calls := make([]Call, n)
+	for i := range calls {
+		calls[i] = Call{
+			Level:     int32(recorded[i].level),
+			Timestamp: time.UnixMilli(int64(recorded[i].timestamp_ms)),
+			Component: C.GoString(recorded[i].component),
+			Message:   C.GoString(recorded[i].message),
+		}
+		C.free(unsafe.Pointer(recorded[i].component))
+		C.free(unsafe.Pointer(recorded[i].message))
+	}
+
+	return calls
+}
+
+// Reset discards the recorded calls.
+func Reset() {
+	C.reset_calls()
+}
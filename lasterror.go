@@ -0,0 +1,203 @@
+package main
+
+/*
+#include <pthread.h>
+
+static unsigned long long asherah_current_thread() {
+	return (unsigned long long)pthread_self();
+}
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+// ErrorDetail describes the most recent failing call on a thread and is written by GetLastErrorJson.
+type ErrorDetail struct {
+	Code     int32    `json:"Code"`
+	Category string   `json:"Category"`
+	Message  string   `json:"Message"`
+	Causes   []string `json:"Causes,omitempty"`
+	Time     int64    `json:"Time,omitempty"`
+}
+
+// maxLastErrors bounds lastErrors; records of threads that have exited are otherwise never removed.
+// Once it is reached, the least recently recorded failure is evicted.
+const maxLastErrors = 1024
+
+// lastError is a recorded ErrorDetail and its position in the order failures were recorded.
+type lastError struct {
+	detail ErrorDetail
+	seq    uint64
+}
+
+// lastErrors holds the most recent failure of each calling thread, like errno. cgo runs an exported
+// function on the thread that called it, so the thread identifies the caller.
+var (
+	lastErrorLock sync.Mutex
+	lastErrors    = map[uint64]lastError{}
+	lastErrorSeq  uint64
+)
+
+func currentThread() uint64 {
+	return uint64(C.asherah_current_thread())
+}
+
+// recordLastError stores detail as the last error of thread, evicting the least recently recorded
+// failure of another thread if lastErrors is full.
+func recordLastError(thread uint64, detail ErrorDetail) {
+	lastErrorLock.Lock()
+	defer lastErrorLock.Unlock()
+
+	if _, ok := lastErrors[thread]; !ok && len(lastErrors) >= maxLastErrors {
+		oldest, oldestSeq := uint64(0), uint64(math.MaxUint64)
+		for t, e := range lastErrors {
+			if e.seq < oldestSeq {
+				oldest, oldestSeq = t, e.seq
+			}
+		}
+		delete(lastErrors, oldest)
+	}
+
+	lastErrorSeq++
+	lastErrors[thread] = lastError{detail: detail, seq: lastErrorSeq}
+}
+
+func errorCategory(code int32) string {
+	switch code {
+	case cobhan.ERR_NONE:
+		return "none"
+	case ERR_NOT_INITIALIZED, ERR_ALREADY_INITIALIZED:
+		return "initialization"
+	case ERR_BAD_CONFIG, ERR_UNKNOWN_METASTORE, ERR_REPLICA_READ_CONSISTENCY:
+		return "config"
+	case ERR_METASTORE_FAILED:
+		return "metastore"
+	case ERR_KMS_FAILED:
+		return "kms"
+	case ERR_METRICS_FAILED:
+		return "metrics"
+	case ERR_KEY_ROTATION_FAILED, ERR_KEY_NOT_FOUND:
+		return "keys"
+	case ERR_GET_SESSION_FAILED:
+		return "session"
+	case ERR_ENCRYPT_FAILED:
+		return "encrypt"
+	case ERR_DECRYPT_FAILED:
+		return "decrypt"
+	case ERR_TIMEOUT:
+		return "timeout"
+	case ERR_INVALID_INSTANCE, ERR_INVALID_STREAM, ERR_STREAM_TRUNCATED:
+		return "handle"
+	case ERR_PANIC:
+		return "panic"
+	}
+
+	if code < 0 && code > ERR_NOT_INITIALIZED {
+		return "buffer"
+	}
+
+	return "unknown"
+}
+
+// errorCauses flattens the chain of wrapped errors, outermost first.
+func errorCauses(err error) []string {
+	var causes []string
+	for err != nil {
+		causes = append(causes, err.Error())
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				causes = append(causes, errorCauses(inner)...)
+			}
+			err = nil
+		default:
+			err = nil
+		}
+	}
+
+	return causes
+}
+
+// reportError logs a failure and records it for GetLastErrorJson on the calling thread, returning code so call sites can
+// `return reportError(...)`. The cause chain is taken from the first error among args.
+func reportError(code int32, format string, args ...interface{}) int32 {
+	log.ErrorLogf(format, args...)
+
+	detail := ErrorDetail{
+		Code:     code,
+		Category: errorCategory(code),
+		Message:  fmt.Sprintf(format, args...),
+		Time:     time.Now().Unix(),
+	}
+
+	if code > ERR_NOT_INITIALIZED && code < 0 {
+		detail.Causes = []string{cobhan.CobhanErrorToString(code)}
+	}
+
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			detail.Causes = errorCauses(err)
+			break
+		}
+	}
+
+	recordLastError(currentThread(), detail)
+
+	return code
+}
+
+/*
+  GetLastErrorJson writes the code, category, message and wrapped cause chain of the most
+  recent failing call made on the calling thread as JSON. Failures on other threads do not
+  replace it.
+*/
+//export GetLastErrorJson
+func GetLastErrorJson(outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.ErrorLogf("GetLastErrorJson: Panic: %v", r)
+			result = ERR_PANIC
+		}
+	}()
+
+	thread := currentThread()
+
+	lastErrorLock.Lock()
+	last, ok := lastErrors[thread]
+	lastErrorLock.Unlock()
+
+	detail := last.detail
+	if !ok {
+		detail = ErrorDetail{Category: "none"}
+	}
+
+	result = cobhan.JsonToBuffer(&detail, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		log.ErrorLogf("GetLastErrorJson failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+		return result
+	}
+
+	return cobhan.ERR_NONE
+}
+
+// ClearLastError resets the record GetLastErrorJson returns on the calling thread.
+//
+//export ClearLastError
+func ClearLastError() {
+	thread := currentThread()
+
+	lastErrorLock.Lock()
+	delete(lastErrors, thread)
+	lastErrorLock.Unlock()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/cobhan-go"
+)
+
+// lockThreadForTesting keeps the test on one OS thread, as a C caller would be, so the last error
+// it reads is the one its own calls recorded.
+func lockThreadForTesting(t *testing.T) {
+	runtime.LockOSThread()
+	t.Cleanup(runtime.UnlockOSThread)
+}
+
+func testGetLastError(t *testing.T) ErrorDetail {
+	buf := cobhan.AllocateBuffer(4096)
+	result := GetLastErrorJson(cobhan.Ptr(&buf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("GetLastErrorJson returned %v", result)
+	}
+
+	var detail ErrorDetail
+	result = cobhan.BufferToJsonStruct(cobhan.Ptr(&buf), &detail)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	return detail
+}
+
+func TestGetLastErrorJsonAfterClear(t *testing.T) {
+	lockThreadForTesting(t)
+
+	ClearLastError()
+
+	detail := testGetLastError(t)
+	if detail.Code != cobhan.ERR_NONE || detail.Category != "none" {
+		t.Errorf("Expected no last error got %+v", detail)
+	}
+}
+
+func TestGetLastErrorJsonSetupCauseChain(t *testing.T) {
+	lockThreadForTesting(t)
+
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "rdbms"
+	config.ConnectionString = "not a data source name"
+	config.Verbose = Verbose
+
+	testSetupJsonResult(t, config)
+
+	detail := testGetLastError(t)
+	if detail.Code != ERR_METASTORE_FAILED || detail.Category != "metastore" {
+		t.Errorf("Expected ERR_METASTORE_FAILED metastore error got %+v", detail)
+	}
+
+	if len(detail.Causes) < 3 || detail.Causes[1] != asherah.ErrMetastoreFailed.Error() {
+		t.Errorf("Expected cause chain containing %q got %v", asherah.ErrMetastoreFailed, detail.Causes)
+	}
+}
+
+func TestGetLastErrorJsonDecryptFailure(t *testing.T) {
+	lockThreadForTesting(t)
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	drrBuf := testAllocateStringBuffer(t, `{"Key":{"Created":1,"Key":"AAAA","ParentKeyMeta":{"KeyId":"x","Created":1}},"Data":"AAAA"}`)
+	outputBuf := cobhan.AllocateBuffer(256)
+
+	result := DecryptFromJson(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&drrBuf), cobhan.Ptr(&outputBuf))
+	if result != ERR_DECRYPT_FAILED {
+		t.Fatalf("Expected DecryptFromJson to return ERR_DECRYPT_FAILED got %v", result)
+	}
+
+	detail := testGetLastError(t)
+	if detail.Code != ERR_DECRYPT_FAILED || detail.Category != "decrypt" {
+		t.Errorf("Expected ERR_DECRYPT_FAILED decrypt error got %+v", detail)
+	}
+
+	if !strings.HasPrefix(detail.Message, "DecryptFromJson") || len(detail.Causes) == 0 {
+		t.Errorf("Expected message and causes for DecryptFromJson got %+v", detail)
+	}
+}
+
+func TestGetLastErrorJsonPerThread(t *testing.T) {
+	lockThreadForTesting(t)
+
+	ClearLastError()
+
+	other := make(chan ErrorDetail)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		DecryptStreamFinish(-1)
+
+		var detail ErrorDetail
+		buf := cobhan.AllocateBuffer(4096)
+		GetLastErrorJson(cobhan.Ptr(&buf))
+		cobhan.BufferToJsonStruct(cobhan.Ptr(&buf), &detail)
+		other <- detail
+	}()
+
+	if detail := <-other; detail.Code != ERR_INVALID_STREAM {
+		t.Errorf("Expected ERR_INVALID_STREAM on the failing thread got %+v", detail)
+	}
+
+	if detail := testGetLastError(t); detail.Code != cobhan.ERR_NONE {
+		t.Errorf("Expected no last error on this thread got %+v", detail)
+	}
+}
+
+func TestGetLastErrorJsonEvictsOldestThread(t *testing.T) {
+	lockThreadForTesting(t)
+
+	lastErrorLock.Lock()
+	previous := lastErrors
+	lastErrors = map[uint64]lastError{}
+	lastErrorLock.Unlock()
+	t.Cleanup(func() {
+		lastErrorLock.Lock()
+		lastErrors = previous
+		lastErrorLock.Unlock()
+	})
+
+	// Thread ids are pthread_t values, which are never this small.
+	for thread := uint64(1); thread < maxLastErrors; thread++ {
+		recordLastError(thread, ErrorDetail{Code: ERR_KMS_FAILED})
+	}
+	DecryptStreamFinish(-1)
+	recordLastError(maxLastErrors, ErrorDetail{Code: ERR_KMS_FAILED})
+
+	if detail := testGetLastError(t); detail.Code != ERR_INVALID_STREAM {
+		t.Errorf("Expected this thread's ERR_INVALID_STREAM to survive eviction got %+v", detail)
+	}
+
+	lastErrorLock.Lock()
+	_, oldest := lastErrors[1]
+	count := len(lastErrors)
+	lastErrorLock.Unlock()
+	if oldest || count != maxLastErrors {
+		t.Errorf("Expected only the oldest record to be evicted got %v records, oldest kept %v", count, oldest)
+	}
+}
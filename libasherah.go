@@ -4,11 +4,13 @@ import (
 	"C"
 )
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"sync/atomic"
+	"time"
 
 	"github.com/godaddy/cobhan-go"
 
@@ -45,8 +47,7 @@ type Env map[string]string
 func SetEnv(envJson unsafe.Pointer) (result int32) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.ErrorLogf("SetEnv: Panic: %v", r)
-			result = ERR_PANIC
+			result = reportError(ERR_PANIC, "SetEnv: Panic: %v", r)
 		}
 	}()
 
@@ -55,14 +56,12 @@ func SetEnv(envJson unsafe.Pointer) (result int32) {
 
 	result = cobhan.BufferToJsonStruct(envJson, &env)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Failed to deserialize environment JSON string %v", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, "Failed to deserialize environment JSON string %v", cobhan.CobhanErrorToString(result))
 	}
 
 	for k, v := range env {
 		if err := os.Setenv(k, v); err != nil {
-			log.ErrorLogf("Failed to set environment variable %v: %v", k, err)
-			return ERR_BAD_CONFIG
+			return reportError(ERR_BAD_CONFIG, "Failed to set environment variable %v: %v", k, err)
 		}
 	}
 
@@ -73,29 +72,28 @@ func SetEnv(envJson unsafe.Pointer) (result int32) {
 func SetupJson(configJson unsafe.Pointer) (result int32) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.ErrorLogf("SetupJson: Panic: %v", r)
-			panic(r)
+			result = reportError(ERR_PANIC, "SetupJson: Panic: %v", r)
 		}
 	}()
 
-	cobhan.AllowTempFileBuffers(false)
-	options := &asherah.Options{}
-	result = cobhan.BufferToJsonStruct(configJson, options)
+	var options *asherah.Options
+	options, result = optionsFromJson(configJson)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Failed to deserialize configuration string %v", cobhan.CobhanErrorToString(result))
-		configString, stringResult := cobhan.BufferToString(configJson)
-		if stringResult != cobhan.ERR_NONE {
-			log.ErrorLogf("Could not convert configJson to string: %v", cobhan.CobhanErrorToString(stringResult))
-			return result
-		}
-		log.ErrorLogf("Could not deserialize: %v", configString)
 		return result
 	}
 
-	log.EnableVerboseLog(options.Verbose)
-
 	log.DebugLog("Successfully deserialized config JSON")
 
+	return setup("SetupJson", options)
+}
+
+// setup applies the library-wide settings in options and initializes the default instance.
+func setup(caller string, options *asherah.Options) int32 {
+	result := configureLog(caller, options)
+	if result != cobhan.ERR_NONE {
+		return result
+	}
+
 	EstimatedIntermediateKeyOverhead = len(options.ProductID) + len(options.ServiceName)
 	cobhan.CopyBuffers(options.DisableZeroCopy)
 	nullDataCheck.Store(options.NullDataCheck)
@@ -103,13 +101,10 @@ func SetupJson(configJson unsafe.Pointer) (result int32) {
 	err := asherah.Setup(options)
 	if err == asherah.ErrAsherahAlreadyInitialized {
 		log.ErrorLog("Setup failed: asherah is already initialized")
-		log.ErrorLogf("Setup: asherah.Setup returned %v", err)
-		return ERR_ALREADY_INITIALIZED
+		return reportError(ERR_ALREADY_INITIALIZED, "Setup: asherah.Setup returned %v", err)
 	}
 	if err != nil {
-		log.ErrorLog("Setup failed due to bad config?")
-		log.ErrorLogf("Setup: asherah.Setup returned %v", err)
-		return ERR_BAD_CONFIG
+		return reportError(setupErrorResult(err), "Setup: asherah.Setup returned %v", err)
 	}
 
 	log.DebugLog("Successfully configured asherah")
@@ -117,6 +112,103 @@ func SetupJson(configJson unsafe.Pointer) (result int32) {
 	return cobhan.ERR_NONE
 }
 
+/*
+  CreateInstance configures an additional asherah instance with its own service, product,
+  metastore and KMS, and writes its handle to outputHandlePtr as an int64. Process-wide
+  settings (Verbose, DisableZeroCopy, NullDataCheck) are only taken from SetupJson.
+*/
+//export CreateInstance
+func CreateInstance(configJson unsafe.Pointer, outputHandlePtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "CreateInstance: Panic: %v", r)
+		}
+	}()
+
+	var options *asherah.Options
+	options, result = optionsFromJson(configJson)
+	if result != cobhan.ERR_NONE {
+		return result
+	}
+
+	handle, err := asherah.CreateInstance(options)
+	if err != nil {
+		return reportError(setupErrorResult(err), "CreateInstance: asherah.CreateInstance returned %v", err)
+	}
+
+	result = cobhan.Int64ToBuffer(handle, outputHandlePtr)
+	if result != cobhan.ERR_NONE {
+		asherah.DestroyInstance(handle)
+		return reportError(result, "CreateInstance failed: Int64ToBuffer returned %v for outputHandlePtr", cobhan.CobhanErrorToString(result))
+	}
+
+	log.DebugLogf("Successfully created asherah instance %v", handle)
+
+	return cobhan.ERR_NONE
+}
+
+//export DestroyInstance
+func DestroyInstance(handle int64) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DestroyInstance: Panic: %v", r)
+		}
+	}()
+
+	if err := asherah.DestroyInstance(handle); err != nil {
+		return reportError(ERR_INVALID_INSTANCE, "DestroyInstance: asherah.DestroyInstance returned %v", err)
+	}
+
+	return cobhan.ERR_NONE
+}
+
+// setupErrorResult maps a setup failure to its result code. An invalid Metastore or
+// ReplicaReadConsistency value keeps its dedicated code even though it is reported as a
+// ValidationError.
+func setupErrorResult(err error) int32 {
+	switch {
+	case errors.Is(err, asherah.ErrUnknownMetastore):
+		return ERR_UNKNOWN_METASTORE
+	case errors.Is(err, asherah.ErrReplicaReadConsistency):
+		return ERR_REPLICA_READ_CONSISTENCY
+	case errors.Is(err, asherah.ErrInvalidConfig):
+		return ERR_BAD_CONFIG
+	case errors.Is(err, asherah.ErrMetastoreFailed):
+		return ERR_METASTORE_FAILED
+	case errors.Is(err, asherah.ErrKMSFailed):
+		return ERR_KMS_FAILED
+	case errors.Is(err, asherah.ErrMetricsListenFailed):
+		return ERR_METRICS_FAILED
+	default:
+		return ERR_BAD_CONFIG
+	}
+}
+
+func optionsFromJson(configJson unsafe.Pointer) (*asherah.Options, int32) {
+	return mergeOptionsJson(configJson, &asherah.Options{})
+}
+
+// mergeOptionsJson overwrites the fields of options that are present in configJson.
+func mergeOptionsJson(configJson unsafe.Pointer, options *asherah.Options) (*asherah.Options, int32) {
+	cobhan.AllowTempFileBuffers(false)
+	config, result := cobhan.BufferToBytes(configJson)
+	if result != cobhan.ERR_NONE {
+		reportError(result, "Failed to deserialize configuration string %v", cobhan.CobhanErrorToString(result))
+		return nil, result
+	}
+
+	if err := json.Unmarshal(config, options); err != nil {
+		if errors.Is(err, asherah.ErrInvalidConfig) {
+			return nil, reportError(ERR_BAD_CONFIG, "Failed to deserialize configuration string: %v", err)
+		}
+		reportError(cobhan.ERR_JSON_DECODE_FAILED, "Failed to deserialize configuration string: %v", err)
+		log.ErrorLogf("Could not deserialize: %v", string(config))
+		return nil, cobhan.ERR_JSON_DECODE_FAILED
+	}
+
+	return options, cobhan.ERR_NONE
+}
+
 //export EstimateBuffer
 func EstimateBuffer(dataLen int32, partitionLen int32) int32 {
 	estimatedDataLen := ((int(dataLen) + EstimatedEncryptionOverhead + 2) / 3) * 4
@@ -133,30 +225,46 @@ func Decrypt(partitionIdPtr unsafe.Pointer, encryptedDataPtr unsafe.Pointer, enc
 	created int64, parentKeyIdPtr unsafe.Pointer, parentKeyCreated int64, outputDecryptedDataPtr unsafe.Pointer) (result int32) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.ErrorLogf("Decrypt: Panic: %v", r)
-			result = ERR_PANIC
+			result = reportError(ERR_PANIC, "Decrypt: Panic: %v", r)
 		}
 	}()
 
+	return decrypt("Decrypt", asherah.DefaultInstance, partitionIdPtr, encryptedDataPtr, encryptedKeyPtr,
+		created, parentKeyIdPtr, parentKeyCreated, outputDecryptedDataPtr)
+}
+
+//export DecryptWithInstance
+func DecryptWithInstance(handle int64, partitionIdPtr unsafe.Pointer, encryptedDataPtr unsafe.Pointer, encryptedKeyPtr unsafe.Pointer,
+	created int64, parentKeyIdPtr unsafe.Pointer, parentKeyCreated int64, outputDecryptedDataPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return decrypt("DecryptWithInstance", handle, partitionIdPtr, encryptedDataPtr, encryptedKeyPtr,
+		created, parentKeyIdPtr, parentKeyCreated, outputDecryptedDataPtr)
+}
+
+func decrypt(caller string, handle int64, partitionIdPtr unsafe.Pointer, encryptedDataPtr unsafe.Pointer, encryptedKeyPtr unsafe.Pointer,
+	created int64, parentKeyIdPtr unsafe.Pointer, parentKeyCreated int64, outputDecryptedDataPtr unsafe.Pointer) (result int32) {
+
 	var encryptedData []byte
 	encryptedData, result = cobhan.BufferToBytes(encryptedDataPtr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Decrypt failed: Failed to convert encryptedDataPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: Failed to convert encryptedDataPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
 	}
 
 	var encryptedKey []byte
 	encryptedKey, result = cobhan.BufferToBytes(encryptedKeyPtr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Decrypt failed: Failed to convert encryptedKeyPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: Failed to convert encryptedKeyPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
 	}
 
 	var parentKeyId string
 	parentKeyId, result = cobhan.BufferToString(parentKeyIdPtr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Decrypt failed: Failed to convert parentKeyIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: Failed to convert parentKeyIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
 	}
 
 	drr := appencryption.DataRowRecord{
@@ -173,11 +281,10 @@ func Decrypt(partitionIdPtr unsafe.Pointer, encryptedDataPtr unsafe.Pointer, enc
 
 	var data []byte
 	var err error
-	data, result, err = decryptData(partitionIdPtr, &drr)
+	data, result, err = decryptData(context.Background(), handle, partitionIdPtr, &drr, 0)
 	if result != cobhan.ERR_NONE {
 		log.ErrorLogf("Failed to decrypt data %v", cobhan.CobhanErrorToString(result))
-		log.ErrorLogf("Decrypt: decryptData returned %v", err)
-		return result
+		return reportError(result, caller+": decryptData returned %v", err)
 	}
 
 	return cobhan.BytesToBuffer(data, outputDecryptedDataPtr)
@@ -189,59 +296,74 @@ func Encrypt(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, outputEncryp
 	outputParentKeyCreatedPtr unsafe.Pointer) (result int32) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.ErrorLogf("Encrypt: Panic: %v", r)
-			result = ERR_PANIC
+			result = reportError(ERR_PANIC, "Encrypt: Panic: %v", r)
 		}
 	}()
 
+	return encrypt("Encrypt", asherah.DefaultInstance, partitionIdPtr, dataPtr, outputEncryptedDataPtr,
+		outputEncryptedKeyPtr, outputCreatedPtr, outputParentKeyIdPtr, outputParentKeyCreatedPtr)
+}
+
+//export EncryptWithInstance
+func EncryptWithInstance(handle int64, partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, outputEncryptedDataPtr unsafe.Pointer,
+	outputEncryptedKeyPtr unsafe.Pointer, outputCreatedPtr unsafe.Pointer, outputParentKeyIdPtr unsafe.Pointer,
+	outputParentKeyCreatedPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return encrypt("EncryptWithInstance", handle, partitionIdPtr, dataPtr, outputEncryptedDataPtr,
+		outputEncryptedKeyPtr, outputCreatedPtr, outputParentKeyIdPtr, outputParentKeyCreatedPtr)
+}
+
+func encrypt(caller string, handle int64, partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, outputEncryptedDataPtr unsafe.Pointer,
+	outputEncryptedKeyPtr unsafe.Pointer, outputCreatedPtr unsafe.Pointer, outputParentKeyIdPtr unsafe.Pointer,
+	outputParentKeyCreatedPtr unsafe.Pointer) (result int32) {
+
 	inputAlreadyNull := false
 	if nullDataCheck.Load() && cobhan.IsBufferAllNulls(dataPtr) {
-		log.ErrorLogf("Encrypt: input data buffer is all null before encryption (len=%d)", cobhan.BufferLength(dataPtr))
+		log.ErrorLogf(caller+": input data buffer is all null before encryption (len=%d)", cobhan.BufferLength(dataPtr))
 		inputAlreadyNull = true
 	}
 
 	var drr *appencryption.DataRowRecord
 	var err error
-	drr, result, err = encryptData(partitionIdPtr, dataPtr)
+	drr, result, err = encryptData(context.Background(), handle, partitionIdPtr, dataPtr, 0)
 	if result != cobhan.ERR_NONE {
 		log.ErrorLogf("Failed to encrypt data %v", cobhan.CobhanErrorToString(result))
-		log.ErrorLogf("Encrypt failed: encryptData returned %v", err)
-		return result
+		return reportError(result, caller+" failed: encryptData returned %v", err)
 	}
 
 	if !inputAlreadyNull && nullDataCheck.Load() && cobhan.IsBufferAllNulls(dataPtr) {
-		log.ErrorLogf("Encrypt: input data buffer was nulled during encryption (len=%d)", cobhan.BufferLength(dataPtr))
+		log.ErrorLogf(caller+": input data buffer was nulled during encryption (len=%d)", cobhan.BufferLength(dataPtr))
 	}
 
 	result = cobhan.BytesToBuffer(drr.Data, outputEncryptedDataPtr)
 	if result != cobhan.ERR_NONE {
 		log.ErrorLogf("Encrypted data length: %v", len(drr.Data))
-		log.ErrorLogf("Encrypt failed: BytesToBuffer returned %v for outputEncryptedDataPtr", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: BytesToBuffer returned %v for outputEncryptedDataPtr", cobhan.CobhanErrorToString(result))
 	}
 
 	result = cobhan.BytesToBuffer(drr.Key.EncryptedKey, outputEncryptedKeyPtr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Encrypt failed: BytesToBuffer returned %v for outputEncryptedKeyPtr", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: BytesToBuffer returned %v for outputEncryptedKeyPtr", cobhan.CobhanErrorToString(result))
 	}
 
 	result = cobhan.Int64ToBuffer(drr.Key.Created, outputCreatedPtr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Encrypt failed: Int64ToBuffer returned %v for outputCreatedPtr", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: Int64ToBuffer returned %v for outputCreatedPtr", cobhan.CobhanErrorToString(result))
 	}
 
 	result = cobhan.StringToBuffer(drr.Key.ParentKeyMeta.ID, outputParentKeyIdPtr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Encrypt failed: BytesToBuffer returned %v for outputParentKeyIdPtr", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: BytesToBuffer returned %v for outputParentKeyIdPtr", cobhan.CobhanErrorToString(result))
 	}
 
 	result = cobhan.Int64ToBuffer(drr.Key.ParentKeyMeta.Created, outputParentKeyCreatedPtr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("Encrypt failed: BytesToBuffer returned %v for outputParentKeyCreatedPtr", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: BytesToBuffer returned %v for outputParentKeyCreatedPtr", cobhan.CobhanErrorToString(result))
 	}
 
 	return cobhan.ERR_NONE
@@ -251,28 +373,57 @@ func Encrypt(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, outputEncryp
 func EncryptToJson(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, jsonPtr unsafe.Pointer) (result int32) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.ErrorLogf("EncryptToJson: Panic: %v", r)
-			result = ERR_PANIC
+			result = reportError(ERR_PANIC, "EncryptToJson: Panic: %v", r)
+		}
+	}()
+
+	return encryptToJson(context.Background(), "EncryptToJson", asherah.DefaultInstance, partitionIdPtr, dataPtr, jsonPtr, 0)
+}
+
+//export EncryptToJsonWithInstance
+func EncryptToJsonWithInstance(handle int64, partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, jsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptToJsonWithInstance: Panic: %v", r)
 		}
 	}()
 
+	return encryptToJson(context.Background(), "EncryptToJsonWithInstance", handle, partitionIdPtr, dataPtr, jsonPtr, 0)
+}
+
+/*
+  EncryptToJsonWithTimeout is EncryptToJson with a per-call deadline in milliseconds that overrides
+  OperationTimeout. It returns ERR_TIMEOUT if metastore or KMS calls do not complete in time.
+*/
+//export EncryptToJsonWithTimeout
+func EncryptToJsonWithTimeout(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, jsonPtr unsafe.Pointer, timeoutMs int64) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptToJsonWithTimeout: Panic: %v", r)
+		}
+	}()
+
+	return encryptToJson(context.Background(), "EncryptToJsonWithTimeout", asherah.DefaultInstance, partitionIdPtr, dataPtr, jsonPtr, time.Duration(timeoutMs)*time.Millisecond)
+}
+
+func encryptToJson(ctx context.Context, caller string, handle int64, partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, jsonPtr unsafe.Pointer, timeout time.Duration) (result int32) {
+
 	inputAlreadyNull := false
 	if nullDataCheck.Load() && cobhan.IsBufferAllNulls(dataPtr) {
-		log.ErrorLogf("EncryptToJson: input data buffer is all null before encryption (len=%d)", cobhan.BufferLength(dataPtr))
+		log.ErrorLogf(caller+": input data buffer is all null before encryption (len=%d)", cobhan.BufferLength(dataPtr))
 		inputAlreadyNull = true
 	}
 
 	var drr *appencryption.DataRowRecord
 	var err error
-	drr, result, err = encryptData(partitionIdPtr, dataPtr)
+	drr, result, err = encryptData(ctx, handle, partitionIdPtr, dataPtr, timeout)
 	if result != cobhan.ERR_NONE {
 		log.ErrorLogf("Failed to encrypt data %v", cobhan.CobhanErrorToString(result))
-		log.ErrorLogf("EncryptToJson failed: encryptData returned %v", err)
-		return result
+		return reportError(result, caller+" failed: encryptData returned %v", err)
 	}
 
 	if !inputAlreadyNull && nullDataCheck.Load() && cobhan.IsBufferAllNulls(dataPtr) {
-		log.ErrorLogf("EncryptToJson: input data buffer was nulled during encryption (len=%d)", cobhan.BufferLength(dataPtr))
+		log.ErrorLogf(caller+": input data buffer was nulled during encryption (len=%d)", cobhan.BufferLength(dataPtr))
 	}
 
 	result = cobhan.JsonToBuffer(drr, jsonPtr)
@@ -280,12 +431,10 @@ func EncryptToJson(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, jsonPt
 		if result == cobhan.ERR_BUFFER_TOO_SMALL {
 			outputBytes, err := json.Marshal(drr)
 			if err == nil {
-				log.ErrorLogf("EncryptToJson failed: JsonToBuffer: Output buffer needed %v bytes", len(outputBytes))
-				return result
+				return reportError(result, caller+" failed: JsonToBuffer: Output buffer needed %v bytes", len(outputBytes))
 			}
 		}
-		log.ErrorLogf("EncryptToJson failed: JsonToBuffer returned %v for jsonPtr", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: JsonToBuffer returned %v for jsonPtr", cobhan.CobhanErrorToString(result))
 	}
 
 	return cobhan.ERR_NONE
@@ -295,41 +444,68 @@ func EncryptToJson(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, jsonPt
 func DecryptFromJson(partitionIdPtr unsafe.Pointer, jsonPtr unsafe.Pointer, dataPtr unsafe.Pointer) (result int32) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.ErrorLogf("DecryptFromJson: Panic: %v", r)
-			result = ERR_PANIC
+			result = reportError(ERR_PANIC, "DecryptFromJson: Panic: %v", r)
+		}
+	}()
+
+	return decryptFromJson(context.Background(), "DecryptFromJson", asherah.DefaultInstance, partitionIdPtr, jsonPtr, dataPtr, 0)
+}
+
+//export DecryptFromJsonWithInstance
+func DecryptFromJsonWithInstance(handle int64, partitionIdPtr unsafe.Pointer, jsonPtr unsafe.Pointer, dataPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptFromJsonWithInstance: Panic: %v", r)
 		}
 	}()
 
+	return decryptFromJson(context.Background(), "DecryptFromJsonWithInstance", handle, partitionIdPtr, jsonPtr, dataPtr, 0)
+}
+
+/*
+  DecryptFromJsonWithTimeout is DecryptFromJson with a per-call deadline in milliseconds that overrides
+  OperationTimeout. It returns ERR_TIMEOUT if metastore or KMS calls do not complete in time.
+*/
+//export DecryptFromJsonWithTimeout
+func DecryptFromJsonWithTimeout(partitionIdPtr unsafe.Pointer, jsonPtr unsafe.Pointer, dataPtr unsafe.Pointer, timeoutMs int64) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptFromJsonWithTimeout: Panic: %v", r)
+		}
+	}()
+
+	return decryptFromJson(context.Background(), "DecryptFromJsonWithTimeout", asherah.DefaultInstance, partitionIdPtr, jsonPtr, dataPtr, time.Duration(timeoutMs)*time.Millisecond)
+}
+
+func decryptFromJson(ctx context.Context, caller string, handle int64, partitionIdPtr unsafe.Pointer, jsonPtr unsafe.Pointer, dataPtr unsafe.Pointer, timeout time.Duration) (result int32) {
+
 	var drr appencryption.DataRowRecord
 	result = cobhan.BufferToJsonStruct(jsonPtr, &drr)
 	if result != cobhan.ERR_NONE {
-		log.ErrorLogf("DecryptFromJson failed: Failed to convert cobhan buffer to JSON structs %v", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: Failed to convert cobhan buffer to JSON structs %v", cobhan.CobhanErrorToString(result))
 	}
 
 	var data []byte
 	var err error
-	data, result, err = decryptData(partitionIdPtr, &drr)
+	data, result, err = decryptData(ctx, handle, partitionIdPtr, &drr, timeout)
 	if result != cobhan.ERR_NONE {
 		log.ErrorLogf("Failed to decrypt data %v", cobhan.CobhanErrorToString(result))
-		log.ErrorLogf("DecryptFromJson failed: decryptData returned %v", err)
-		return result
+		return reportError(result, caller+" failed: decryptData returned %v", err)
 	}
 
 	result = cobhan.BytesToBuffer(data, dataPtr)
 	if result != cobhan.ERR_NONE {
 		if result == cobhan.ERR_BUFFER_TOO_SMALL {
-			log.ErrorLogf("DecryptFromJson: BytesToBuffer: Output buffer needed %v bytes", len(data))
-			return result
+			return reportError(result, caller+": BytesToBuffer: Output buffer needed %v bytes", len(data))
 		}
-		log.ErrorLogf("DecryptFromJson failed: BytesToBuffer returned %v for dataPtr", cobhan.CobhanErrorToString(result))
-		return result
+		return reportError(result, caller+" failed: BytesToBuffer returned %v for dataPtr", cobhan.CobhanErrorToString(result))
 	}
 
 	return cobhan.ERR_NONE
 }
 
-func encryptData(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer) (*appencryption.DataRowRecord, int32, error) {
+func encryptData(ctx context.Context, handle int64, partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, timeout time.Duration) (drr *appencryption.DataRowRecord, result int32, err error) {
+	start := time.Now()
 	partitionId, result := cobhan.BufferToString(partitionIdPtr)
 	if result != cobhan.ERR_NONE {
 		errorMessage := fmt.Sprintf("encryptData failed: Failed to convert cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
@@ -342,19 +518,27 @@ func encryptData(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer) (*appenc
 		return nil, result, errors.New(errorMessage)
 	}
 
-	drr, err := asherah.Encrypt(partitionId, data)
+	defer func() { logOperation("encrypt", partitionId, start, result) }()
 
+	drr, err = asherah.EncryptWithInstance(ctx, handle, partitionId, data, timeout)
 	if err != nil {
 		if err == asherah.ErrAsherahNotInitialized {
 			return nil, ERR_NOT_INITIALIZED, err
 		}
+		if err == asherah.ErrInstanceNotFound {
+			return nil, ERR_INVALID_INSTANCE, err
+		}
+		if errors.Is(err, asherah.ErrAsherahTimeout) {
+			return nil, ERR_TIMEOUT, err
+		}
 		return nil, ERR_ENCRYPT_FAILED, err
 	}
 
 	return drr, cobhan.ERR_NONE, nil
 }
 
-func decryptData(partitionIdPtr unsafe.Pointer, drr *appencryption.DataRowRecord) ([]byte, int32, error) {
+func decryptData(ctx context.Context, handle int64, partitionIdPtr unsafe.Pointer, drr *appencryption.DataRowRecord, timeout time.Duration) (data []byte, result int32, err error) {
+	start := time.Now()
 	partitionId, result := cobhan.BufferToString(partitionIdPtr)
 	if result != cobhan.ERR_NONE {
 		errorMessage := fmt.Sprintf("decryptData failed: Failed to convert cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
@@ -362,13 +546,76 @@ func decryptData(partitionIdPtr unsafe.Pointer, drr *appencryption.DataRowRecord
 		return nil, result, errors.New(errorMessage)
 	}
 
-	data, err := asherah.Decrypt(partitionId, drr)
+	defer func() { logOperation("decrypt", partitionId, start, result) }()
+
+	data, err = asherah.DecryptWithInstance(ctx, handle, partitionId, drr, timeout)
 	if err != nil {
 		if err == asherah.ErrAsherahNotInitialized {
 			return nil, ERR_NOT_INITIALIZED, err
 		}
+		if err == asherah.ErrInstanceNotFound {
+			return nil, ERR_INVALID_INSTANCE, err
+		}
+		if errors.Is(err, asherah.ErrAsherahTimeout) {
+			return nil, ERR_TIMEOUT, err
+		}
 		return nil, ERR_DECRYPT_FAILED, err
 	}
 
 	return data, cobhan.ERR_NONE, nil
 }
+
+// logLevel checks the LogFormat option and returns the level selected by the LogLevel and Verbose
+// options, so callers can reject bad log options before changing anything. Verbose takes precedence
+// over LogLevel.
+func logLevel(options *asherah.Options) (log.Level, error) {
+	if _, err := log.ParseFormat(options.LogFormat); err != nil {
+		return 0, err
+	}
+
+	if options.Verbose {
+		return log.LevelDebug, nil
+	}
+	if options.LogLevel == "" {
+		return log.LevelError, nil
+	}
+
+	return log.ParseLevel(options.LogLevel)
+}
+
+// configureLog applies the LogFormat, LogLevel and Verbose options.
+func configureLog(caller string, options *asherah.Options) int32 {
+	level, err := logLevel(options)
+	if err != nil {
+		return reportError(ERR_BAD_CONFIG, caller+" failed: %v", err)
+	}
+
+	// logLevel has already checked the format.
+	_ = log.SetFormat(options.LogFormat)
+	if options.Verbose {
+		log.EnableVerboseLog(true)
+	} else {
+		log.SetLevel(level)
+	}
+
+	return cobhan.ERR_NONE
+}
+
+// logOperation writes the outcome of an encrypt or decrypt at info level, or warn level if it failed.
+func logOperation(op string, partitionId string, start time.Time, result int32) {
+	level, message := log.LevelInfo, op+" completed"
+	if result != cobhan.ERR_NONE {
+		level, message = log.LevelWarn, op+" failed"
+	}
+	asherah.RecordResult(op, result)
+	if !log.Enabled(level) {
+		return
+	}
+
+	log.LogFields(level, log.ComponentCobhan, message, log.Fields{
+		"op":          op,
+		"partition":   partitionId,
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+		"error_code":  result,
+	})
+}
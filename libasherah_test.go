@@ -45,6 +45,16 @@ func testAllocateStringBuffer(t *testing.T, str string) []byte {
 	return buf
 }
 
+// testAllocateEmptyBuffer returns a buffer holding an empty value. cobhan.AllocateStringBuffer("") and
+// cobhan.AllocateBuffer(0) both produce buffers that checkptr rejects under -race.
+func testAllocateEmptyBuffer(t *testing.T) []byte {
+	buf := cobhan.AllocateBuffer(1)
+	if result := cobhan.StringToBufferSafe("", &buf); result != cobhan.ERR_NONE {
+		t.Errorf("StringToBufferSafe returned %v", result)
+	}
+	return buf
+}
+
 func testAllocateBytesBuffer(t *testing.T, bytes []byte) []byte {
 	buf, result := cobhan.AllocateBytesBuffer(bytes)
 	if result != cobhan.ERR_NONE {
@@ -85,6 +95,19 @@ func TestSetupJsonAlternateConfiguration(t *testing.T) {
 	Shutdown()
 }
 
+func TestSetupJsonNanosecondDurations(t *testing.T) {
+	str := `{"KMS":"static","ServiceName":"TestService","ProductID":"TestProduct","Metastore":"memory",` +
+		`"EnableSessionCaching":true,"SessionCacheDuration":7200000000000,"ExpireAfter":7776000000000000,"CheckInterval":3600000000000}`
+
+	buf := testAllocateStringBuffer(t, str)
+
+	result := SetupJson(cobhan.Ptr(&buf))
+	if result != cobhan.ERR_NONE {
+		t.Errorf("SetupJson returned %v", result)
+	}
+	Shutdown()
+}
+
 func TestSetupJsonRdbmWithMysqlDefaultDbType(t *testing.T) {
 	config := &asherah.Options{}
 
@@ -941,3 +964,206 @@ func cycleEncryptToJsonAndDecryptFromJson(input string, partition string, t *tes
 		return
 	}
 }
+
+func createInstanceForTesting(t *testing.T, serviceName string) int64 {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = serviceName
+	config.ProductID = "TestProduct"
+	config.Metastore = "memory"
+	config.EnableSessionCaching = true
+	config.Verbose = Verbose
+
+	buf := testAllocateJsonBuffer(t, config)
+	handleBuf := cobhan.AllocateBuffer(8)
+
+	result := CreateInstance(cobhan.Ptr(&buf), cobhan.Ptr(&handleBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("CreateInstance returned %v", result)
+	}
+
+	handle, result := cobhan.BufferToInt64Safe(&handleBuf)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToInt64Safe returned %v", result)
+	}
+
+	return handle
+}
+
+func TestCreateInstanceEncryptDecryptCycle(t *testing.T) {
+	first := createInstanceForTesting(t, "FirstService")
+	defer DestroyInstance(first)
+	second := createInstanceForTesting(t, "SecondService")
+	defer DestroyInstance(second)
+
+	if first == second {
+		t.Fatalf("CreateInstance returned the same handle twice: %v", first)
+	}
+
+	input := "InputData"
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	inputBuf := testAllocateStringBuffer(t, input)
+	encryptedDataBuf := cobhan.AllocateBuffer(EstimateBufferInt(len(input), len("Partition")) + len("SecondService"))
+
+	result := EncryptToJsonWithInstance(first, cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&inputBuf), cobhan.Ptr(&encryptedDataBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptToJsonWithInstance returned %v", result)
+	}
+
+	encryptedData, result := cobhan.BufferToString(cobhan.Ptr(&encryptedDataBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToString returned %v", result)
+	}
+
+	encryptedDataInputBuf := testAllocateStringBuffer(t, encryptedData)
+	decryptedDataBuf := cobhan.AllocateBuffer(len(encryptedData))
+
+	result = DecryptFromJsonWithInstance(second, cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&encryptedDataInputBuf), cobhan.Ptr(&decryptedDataBuf))
+	if result != ERR_DECRYPT_FAILED {
+		t.Errorf("Expected DecryptFromJsonWithInstance on another instance to return ERR_DECRYPT_FAILED got %v", result)
+	}
+
+	result = DecryptFromJsonWithInstance(first, cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&encryptedDataInputBuf), cobhan.Ptr(&decryptedDataBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptFromJsonWithInstance returned %v", result)
+	}
+
+	decryptedData, result := cobhan.BufferToString(cobhan.Ptr(&decryptedDataBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToString returned %v", result)
+	}
+
+	if decryptedData != input {
+		t.Errorf("decryptedData %v does not match inputData data %v", decryptedData, input)
+	}
+}
+
+func TestCreateInstanceAlongsideDefaultInstance(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	handle := createInstanceForTesting(t, "OtherService")
+	defer DestroyInstance(handle)
+
+	cycleEncryptToJsonAndDecryptFromJson("InputString", "Partition", t)
+}
+
+func TestEncryptWithDestroyedInstance(t *testing.T) {
+	handle := createInstanceForTesting(t, "TestService")
+
+	result := DestroyInstance(handle)
+	if result != cobhan.ERR_NONE {
+		t.Errorf("DestroyInstance returned %v", result)
+	}
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	inputBuf := testAllocateStringBuffer(t, "InputData")
+	encryptedDataBuf := cobhan.AllocateBuffer(256)
+
+	result = EncryptToJsonWithInstance(handle, cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&inputBuf), cobhan.Ptr(&encryptedDataBuf))
+	if result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected EncryptToJsonWithInstance to return ERR_INVALID_INSTANCE got %v", result)
+	}
+
+	result = DestroyInstance(handle)
+	if result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected DestroyInstance to return ERR_INVALID_INSTANCE got %v", result)
+	}
+}
+
+func testSetupJsonResult(t *testing.T, config *asherah.Options) int32 {
+	buf := testAllocateJsonBuffer(t, config)
+	result := SetupJson(cobhan.Ptr(&buf))
+	if result == cobhan.ERR_NONE {
+		Shutdown()
+	}
+	return result
+}
+
+func TestSetupJsonUnknownMetastoreCanRetry(t *testing.T) {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "unknown"
+	config.Verbose = Verbose
+
+	result := testSetupJsonResult(t, config)
+	if result != ERR_UNKNOWN_METASTORE {
+		t.Errorf("Expected SetupJson to return ERR_UNKNOWN_METASTORE got %v", result)
+	}
+
+	config.Metastore = "memory"
+	result = testSetupJsonResult(t, config)
+	if result != cobhan.ERR_NONE {
+		t.Errorf("Expected SetupJson to succeed after a failed setup got %v", result)
+	}
+}
+
+func TestSetupJsonBadReplicaReadConsistency(t *testing.T) {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "rdbms"
+	config.ConnectionString = "user@tcp(localhost:3306)/db"
+	config.ReplicaReadConsistency = "sometimes"
+	config.Verbose = Verbose
+
+	result := testSetupJsonResult(t, config)
+	if result != ERR_REPLICA_READ_CONSISTENCY {
+		t.Errorf("Expected SetupJson to return ERR_REPLICA_READ_CONSISTENCY got %v", result)
+	}
+}
+
+func TestSetupJsonBadLogLevel(t *testing.T) {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "memory"
+	config.LogLevel = "trace"
+
+	result := testSetupJsonResult(t, config)
+	if result != ERR_BAD_CONFIG {
+		t.Errorf("Expected SetupJson to return ERR_BAD_CONFIG got %v", result)
+	}
+}
+
+func TestSetupJsonMetastoreFailure(t *testing.T) {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "rdbms"
+	config.ConnectionString = "not a data source name"
+	config.Verbose = Verbose
+
+	result := testSetupJsonResult(t, config)
+	if result != ERR_METASTORE_FAILED {
+		t.Errorf("Expected SetupJson to return ERR_METASTORE_FAILED got %v", result)
+	}
+}
+
+func TestSetupJsonHumanReadableDurations(t *testing.T) {
+	buf := testAllocateStringBuffer(t, `{"KMS":"static","ServiceName":"TestService","ProductID":"TestProduct","Metastore":"memory","ExpireAfter":"90d","CheckInterval":"1h","SessionCacheDurationSeconds":7200}`)
+	if result := SetupJson(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupJson returned %v", result)
+	}
+	Shutdown()
+}
+
+func TestSetupJsonAmbiguousDuration(t *testing.T) {
+	for _, expireAfter := range []string{`"90"`, `90`} {
+		buf := testAllocateStringBuffer(t, `{"KMS":"static","ServiceName":"TestService","ProductID":"TestProduct","Metastore":"memory","ExpireAfter":`+expireAfter+`}`)
+		if result := SetupJson(cobhan.Ptr(&buf)); result != ERR_BAD_CONFIG {
+			Shutdown()
+			t.Errorf("Expected SetupJson to return ERR_BAD_CONFIG for ExpireAfter %v got %v", expireAfter, result)
+		}
+	}
+}
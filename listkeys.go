@@ -0,0 +1,81 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"context"
+	"encoding/json"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+/*
+  ListKeys writes a page of the system and intermediate keys of the configured service and
+  product stored in the metastore as {"Keys": [...], "NextPageToken": string}. Each key reports
+  its KeyId, Created, Revoked, Type ("system" or "intermediate"), Partition, Service, Product,
+  RegionSuffix and ParentKeyMeta. filterJson is
+  {"Type": string, "Partition": string, "Limit": number, "PageToken": string}; every field is
+  optional and an empty buffer lists every key. Limit defaults to 100 and may be at most 1000.
+  Pass NextPageToken as PageToken to read the next page until it is empty; a page may hold
+  fewer than Limit keys even when more follow. An invalid filter returns ERR_BAD_CONFIG and a
+  metastore failure ERR_METASTORE_FAILED. If outputJson is too small the last error reports the
+  size needed.
+*/
+//export ListKeys
+func ListKeys(filterJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ListKeys: Panic: %v", r)
+		}
+	}()
+
+	return listKeys("ListKeys", asherah.DefaultInstance, filterJsonPtr, outputJsonPtr)
+}
+
+//export ListKeysWithInstance
+func ListKeysWithInstance(handle int64, filterJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ListKeysWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return listKeys("ListKeysWithInstance", handle, filterJsonPtr, outputJsonPtr)
+}
+
+func listKeys(caller string, handle int64, filterJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) int32 {
+	filterJson, result := cobhan.BufferToString(filterJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert filterJsonPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var filter asherah.KeyFilter
+	if filterJson != "" {
+		result = cobhan.BufferToJsonStruct(filterJsonPtr, &filter)
+		if result != cobhan.ERR_NONE {
+			return reportError(result, caller+" failed: Failed to convert filterJsonPtr cobhan buffer to JSON %v", cobhan.CobhanErrorToString(result))
+		}
+	}
+
+	page, err := asherah.ListKeys(context.Background(), handle, filter)
+	if err != nil {
+		return reportError(keyErrorResult(err, ERR_METASTORE_FAILED), caller+" failed: ListKeys returned %v", err)
+	}
+
+	result = cobhan.JsonToBuffer(page, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		if result == cobhan.ERR_BUFFER_TOO_SMALL {
+			outputBytes, err := json.Marshal(page)
+			if err == nil {
+				return reportError(result, caller+" failed: JsonToBuffer: Output buffer needed %v bytes", len(outputBytes))
+			}
+		}
+		return reportError(result, caller+" failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
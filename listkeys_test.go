@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestListKeys(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partition := testAllocateStringBuffer(t, "Partition")
+	testEncryptToJson(t, partition, "InputString")
+
+	filter := testAllocateEmptyBuffer(t)
+	output := cobhan.AllocateBuffer(4096)
+	if result := ListKeys(cobhan.Ptr(&filter), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+		t.Fatalf("ListKeys returned %v", result)
+	}
+
+	var page asherah.KeyPage
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &page); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+	if len(page.Keys) != 2 || page.Keys[0].Partition != "Partition" || page.Keys[1].ID != "_SK_TestService_TestProduct" {
+		t.Errorf("Unexpected keys %+v", page)
+	}
+
+	filter = testAllocateStringBuffer(t, `{"Type":"system"}`)
+	if result := ListKeys(cobhan.Ptr(&filter), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+		t.Fatalf("ListKeys returned %v", result)
+	}
+	page = asherah.KeyPage{}
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &page); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+	if len(page.Keys) != 1 || page.Keys[0].Type != "system" {
+		t.Errorf("Expected the system key got %+v", page)
+	}
+}
+
+func TestListKeysErrors(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	output := cobhan.AllocateBuffer(4096)
+	for filter, expected := range map[string]int32{
+		`{"Type":"data"}`: ERR_BAD_CONFIG,
+		`{"Limit":`:       cobhan.ERR_JSON_DECODE_FAILED,
+	} {
+		buf := testAllocateStringBuffer(t, filter)
+		if result := ListKeys(cobhan.Ptr(&buf), cobhan.Ptr(&output)); result != expected {
+			t.Errorf("%v: expected %v got %v", filter, expected, result)
+		}
+	}
+}
+
+func TestListKeysNotInitialized(t *testing.T) {
+	filter := testAllocateEmptyBuffer(t)
+	output := cobhan.AllocateBuffer(4096)
+	if result := ListKeys(cobhan.Ptr(&filter), cobhan.Ptr(&output)); result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+	}
+	if result := ListKeysWithInstance(-1, cobhan.Ptr(&filter), cobhan.Ptr(&output)); result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected ERR_INVALID_INSTANCE got %v", result)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+typedef void (*asherah_log_callback)(int32_t level, int64_t timestamp_ms, const char *component, const char *message);
+
+static void call_asherah_log_callback(void *fn, int32_t level, int64_t timestamp_ms, const char *component, const char *message) {
+	((asherah_log_callback)fn)(level, timestamp_ms, component, message);
+}
+*/
+import "C"
+import (
+	"time"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+/*
+  SetLogCallback routes all log messages, including those forwarded from the Asherah
+  library, to a host function with the C signature
+
+    void callback(int32_t level, int64_t timestamp_ms, const char *component, const char *message)
+
+  where level is 1 (error), 2 (warn), 3 (info) or 4 (debug). The strings are only valid for
+  the duration of the call, and the callback may be invoked concurrently from multiple
+  threads. Passing NULL restores logging to stderr.
+*/
+//export SetLogCallback
+func SetLogCallback(fnPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "SetLogCallback: Panic: %v", r)
+		}
+	}()
+
+	if fnPtr == nil {
+		log.SetCallback(nil)
+		return cobhan.ERR_NONE
+	}
+
+	log.SetCallback(func(level log.Level, timestamp time.Time, component string, message string) {
+		cComponent := C.CString(component)
+		defer C.free(unsafe.Pointer(cComponent))
+		cMessage := C.CString(message)
+		defer C.free(unsafe.Pointer(cMessage))
+
+		C.call_asherah_log_callback(fnPtr, C.int32_t(level), C.int64_t(timestamp.UnixMilli()), cComponent, cMessage)
+	})
+
+	return cobhan.ERR_NONE
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah-cobhan/internal/logcallbacktest"
+)
+
+func TestSetLogCallbackNull(t *testing.T) {
+	result := SetLogCallback(nil)
+	if result != cobhan.ERR_NONE {
+		t.Errorf("SetLogCallback returned %v", result)
+	}
+}
+
+func captureStderr(t *testing.T, fn func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe returned %v", err)
+	}
+
+	stderr := os.Stderr
+	os.Stderr = writer
+	fn()
+	os.Stderr = stderr
+	writer.Close()
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll returned %v", err)
+	}
+	return string(output)
+}
+
+func TestSetLogCallbackReceivesMessages(t *testing.T) {
+	logcallbacktest.Reset()
+	defer SetLogCallback(nil)
+	defer log.EnableVerboseLog(false)
+
+	start := time.Now().Truncate(time.Millisecond)
+	if result := SetLogCallback(logcallbacktest.Callback()); result != cobhan.ERR_NONE {
+		t.Fatalf("SetLogCallback returned %v", result)
+	}
+
+	output := cobhan.AllocateBuffer(256)
+	stderr := captureStderr(t, func() {
+		partition := testAllocateStringBuffer(t, "Partition")
+		data := testAllocateStringBuffer(t, "InputData")
+		if result := EncryptToJson(cobhan.Ptr(&partition), cobhan.Ptr(&data), cobhan.Ptr(&output)); result != ERR_NOT_INITIALIZED {
+			t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+		}
+
+		log.EnableVerboseLog(true)
+		log.DebugLogf("debug message %v", 42)
+	})
+	if stderr != "" {
+		t.Errorf("Expected no stderr output while a callback is set got %q", stderr)
+	}
+
+	calls := logcallbacktest.Calls()
+	if len(calls) < 2 {
+		t.Fatalf("Expected an error and a debug message got %+v", calls)
+	}
+	for _, call := range calls {
+		if call.Component != log.ComponentCobhan || call.Timestamp.Before(start) || call.Timestamp.After(time.Now()) {
+			t.Errorf("Unexpected component or timestamp in %+v", call)
+		}
+	}
+	if calls[0].Level != int32(log.LevelError) || !strings.Contains(calls[0].Message, "not initialized") {
+		t.Errorf("Expected the EncryptToJson error first got %+v", calls[0])
+	}
+	last := calls[len(calls)-1]
+	if last.Level != int32(log.LevelDebug) || last.Message != "debug message 42" {
+		t.Errorf("Expected the debug message last got %+v", last)
+	}
+
+	logcallbacktest.Reset()
+	if result := SetLogCallback(nil); result != cobhan.ERR_NONE {
+		t.Fatalf("SetLogCallback returned %v", result)
+	}
+	stderr = captureStderr(t, func() {
+		log.ErrorLog("back to stderr")
+	})
+	if stderr != "asherah-cobhan: back to stderr\n" {
+		t.Errorf("Expected the message on stderr got %q", stderr)
+	}
+	if calls := logcallbacktest.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no calls after SetLogCallback(NULL) got %+v", calls)
+	}
+}
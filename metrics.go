@@ -0,0 +1,38 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+/*
+  GetMetricsJson writes a snapshot of the encrypt, decrypt, session lookup, KMS and metastore
+  metrics recorded by asherah-cobhan ("cobhan." prefix), along with the Asherah library's own
+  go-metrics registry ("ael." prefix). With EnableSessionCaching, cobhan.session.cache.hits and
+  cobhan.session.cache.misses count the lookups served from the session cache and the sessions
+  it had to create, and cobhan.session.cache.size is an approximate upper bound on the number
+  of sessions it holds, since evicted sessions are counted until they are garbage collected.
+  Metrics are only recorded once an instance has been configured with EnableMetrics; until then
+  the snapshot reports Enabled false.
+*/
+//export GetMetricsJson
+func GetMetricsJson(outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "GetMetricsJson: Panic: %v", r)
+		}
+	}()
+
+	result = cobhan.JsonToBuffer(asherah.GetMetrics(), outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "GetMetricsJson failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
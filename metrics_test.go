@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestGetMetricsJsonAfterEncrypt(t *testing.T) {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "memory"
+	config.EnableSessionCaching = true
+	config.EnableMetrics = true
+	config.Verbose = Verbose
+
+	buf := testAllocateJsonBuffer(t, config)
+	if result := SetupJson(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupJson returned %v", result)
+	}
+	defer Shutdown()
+
+	partitionId := testAllocateStringBuffer(t, "Partition")
+	input := testAllocateStringBuffer(t, "InputData")
+	output := cobhan.AllocateBuffer(EstimateBufferInt(len("InputData"), len("Partition")) + 256)
+	for n := 0; n < 2; n++ {
+		if result := EncryptToJson(cobhan.Ptr(&partitionId), cobhan.Ptr(&input), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+			t.Fatalf("EncryptToJson returned %v", result)
+		}
+	}
+
+	metricsBuf := cobhan.AllocateBuffer(64 * 1024)
+	if result := GetMetricsJson(cobhan.Ptr(&metricsBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("GetMetricsJson returned %v", result)
+	}
+
+	var snapshot asherah.MetricsSnapshot
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&metricsBuf), &snapshot); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	if !snapshot.Enabled {
+		t.Error("Expected metrics to be enabled")
+	}
+	if snapshot.Metrics["cobhan.encrypt"].Count < 2 {
+		t.Errorf("Expected at least 2 encrypts got %+v", snapshot.Metrics["cobhan.encrypt"])
+	}
+	if snapshot.Metrics["cobhan.session.get"].Count < 2 {
+		t.Errorf("Expected at least 2 session lookups got %+v", snapshot.Metrics["cobhan.session.get"])
+	}
+	if snapshot.Metrics["cobhan.session.cache.hits"].Count < 1 || snapshot.Metrics["cobhan.session.cache.misses"].Count < 1 {
+		t.Errorf("Expected a session cache miss and hit got %+v and %+v", snapshot.Metrics["cobhan.session.cache.misses"], snapshot.Metrics["cobhan.session.cache.hits"])
+	}
+}
+
+func testGetMetrics(t *testing.T) *asherah.MetricsSnapshot {
+	metricsBuf := cobhan.AllocateBuffer(64 * 1024)
+	if result := GetMetricsJson(cobhan.Ptr(&metricsBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("GetMetricsJson returned %v", result)
+	}
+
+	var snapshot asherah.MetricsSnapshot
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&metricsBuf), &snapshot); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+	return &snapshot
+}
+
+func TestGetMetricsJsonAfterBatch(t *testing.T) {
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "memory"
+	config.EnableMetrics = true
+	config.Verbose = Verbose
+
+	buf := testAllocateJsonBuffer(t, config)
+	if result := SetupJson(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("SetupJson returned %v", result)
+	}
+	defer Shutdown()
+
+	encryptOk, decryptOk, decryptFailed := "cobhan.encrypt.result.0", "cobhan.decrypt.result.0", "cobhan.decrypt.result."+strconv.Itoa(ERR_DECRYPT_FAILED)
+	before := testGetMetrics(t)
+
+	inputs := [][]byte{[]byte("First"), []byte("Second")}
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	inputBuf := testAllocateJsonBuffer(t, inputs)
+	encryptedBuf := cobhan.AllocateBuffer(len(inputs) * EstimateBufferInt(16, len("Partition")))
+	if result := EncryptBatchToJson(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&inputBuf), cobhan.Ptr(&encryptedBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptBatchToJson returned %v", result)
+	}
+
+	var encrypted []BatchEncryptResult
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&encryptedBuf), &encrypted); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	drrs := []interface{}{encrypted[0].DataRowRecord, encrypted[1].DataRowRecord,
+		json.RawMessage(`{"Key":{"Created":1,"Key":"AAAA","ParentKeyMeta":{"KeyId":"x","Created":1}},"Data":"AAAA"}`)}
+	drrBuf := testAllocateJsonBuffer(t, drrs)
+	decryptedBuf := cobhan.AllocateBuffer(len(drrBuf))
+	if result := DecryptBatchFromJson(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&drrBuf), cobhan.Ptr(&decryptedBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptBatchFromJson returned %v", result)
+	}
+
+	after := testGetMetrics(t)
+	for name, expected := range map[string]int64{encryptOk: 2, decryptOk: 2, decryptFailed: 1} {
+		if count := after.Metrics[name].Count - before.Metrics[name].Count; count != expected {
+			t.Errorf("Expected %v to count %v batch items got %v", name, expected, count)
+		}
+	}
+}
+
+func TestSetupJsonMetricsListenAddressInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen returned %v", err)
+	}
+	defer listener.Close()
+
+	config := &asherah.Options{}
+
+	config.KMS = "static"
+	config.ServiceName = "TestService"
+	config.ProductID = "TestProduct"
+	config.Metastore = "memory"
+	config.MetricsListenAddress = listener.Addr().String()
+	config.Verbose = Verbose
+
+	result := testSetupJsonResult(t, config)
+	if result != ERR_METRICS_FAILED {
+		t.Errorf("Expected SetupJson to return ERR_METRICS_FAILED got %v", result)
+	}
+}
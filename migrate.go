@@ -0,0 +1,84 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"context"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+// migrateKeysRequest is the migrationJson accepted by MigrateKeys.
+type migrateKeysRequest struct {
+	asherah.Migration
+	Progress bool `json:"Progress,omitempty"`
+}
+
+/*
+  MigrateKeys copies every system and intermediate key from one metastore to another, such as from
+  rdbms to dynamodb, and writes a MigrationReport as JSON. migrationJson is {"Source": config,
+  "Destination": config, "DryRun": bool, "Verify": bool, "BatchSize": number, "Progress": bool}
+  where each config uses the metastore fields of SetupJson. It needs no Setup. Neither side may
+  use the memory metastore, and Destination may not set EnableRegionSuffix because keys keep their
+  IDs. Keys already in the destination are left unchanged, so an interrupted migration can be run
+  again; a key revoked in the source since is revoked in the destination. DryRun reports what
+  would be copied without writing. Verify reads every source key back from the destination and
+  lists any that are missing or different in Mismatches. If Progress is set, an info level message
+  is logged after every batch whatever the log level, so it reaches the log callback or stderr
+  without Setup. Keys that differ in the destination are reported in Conflicts and not
+  overwritten, so check Conflicts and Mismatches even when the result is ERR_NONE. If the
+  migration fails part way, the report of the keys handled so far is still written.
+*/
+//export MigrateKeys
+func MigrateKeys(migrationJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "MigrateKeys: Panic: %v", r)
+		}
+	}()
+
+	var request migrateKeysRequest
+	result = cobhan.BufferToJsonStruct(migrationJsonPtr, &request)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "MigrateKeys failed: Failed to convert migrationJsonPtr cobhan buffer to JSON %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var progress func(asherah.MigrationReport)
+	if request.Progress {
+		progress = logMigrationProgress
+	}
+
+	report, err := asherah.MigrateKeys(context.Background(), &request.Migration, progress)
+	if err != nil {
+		if report != nil {
+			// The keys handled before the failure are already in the destination
+			cobhan.JsonToBuffer(report, outputJsonPtr)
+		}
+		return reportError(setupErrorResult(err), "MigrateKeys failed: MigrateKeys returned %v", err)
+	}
+
+	result = cobhan.JsonToBuffer(report, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "MigrateKeys failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
+
+func logMigrationProgress(progress asherah.MigrationReport) {
+	log.WriteFields(log.LevelInfo, log.ComponentCobhan, "Migrating keys", log.Fields{
+		"dry_run":    progress.DryRun,
+		"scanned":    progress.Scanned,
+		"copied":     progress.Copied,
+		"unchanged":  progress.Unchanged,
+		"revoked":    progress.Revoked,
+		"conflicts":  len(progress.Conflicts),
+		"verified":   progress.Verified,
+		"mismatches": len(progress.Mismatches),
+	})
+}
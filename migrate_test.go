@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestMigrateKeys(t *testing.T) {
+	migration := testAllocateStringBuffer(t, `{"Source":{"Metastore":"test-debug-memory"},"Destination":{"Metastore":"test-debug-memory"},"Verify":true}`)
+	output := cobhan.AllocateBuffer(4096)
+	if result := MigrateKeys(cobhan.Ptr(&migration), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+		t.Fatalf("MigrateKeys returned %v", result)
+	}
+
+	var report asherah.MigrationReport
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &report); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+	if report.Scanned != 0 || report.DryRun || report.Conflicts == nil {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestMigrateKeysLogsProgressWithoutSetup(t *testing.T) {
+	var messages []string
+	log.SetCallback(func(level log.Level, timestamp time.Time, component string, message string) {
+		if level == log.LevelInfo {
+			messages = append(messages, message)
+		}
+	})
+	defer log.SetCallback(nil)
+
+	for _, progress := range []bool{false, true} {
+		messages = nil
+		migration := testAllocateStringBuffer(t, `{"Source":{"Metastore":"test-debug-memory"},"Destination":{"Metastore":"test-debug-memory"},"Verify":true,"Progress":`+strconv.FormatBool(progress)+`}`)
+		output := cobhan.AllocateBuffer(4096)
+		if result := MigrateKeys(cobhan.Ptr(&migration), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+			t.Fatalf("MigrateKeys returned %v", result)
+		}
+
+		if progress && (len(messages) != 2 || messages[0] != "Migrating keys conflicts=0 copied=0 dry_run=false mismatches=0 revoked=0 scanned=0 unchanged=0 verified=0") {
+			t.Errorf("Expected a progress message per pass got %q", messages)
+		}
+		if !progress && len(messages) != 0 {
+			t.Errorf("Expected no progress messages got %q", messages)
+		}
+	}
+}
+
+func TestMigrateKeysWritesPartialReport(t *testing.T) {
+	// The source is a sqlmock connection pool that fails after its first batch of keys
+	_, mock, err := sqlmock.NewWithDSN("migrate-keys-partial-source", sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.NewWithDSN returned %v", err)
+	}
+	mock.ExpectQuery("SELECT id, key_record FROM encryption_key ORDER BY id, created LIMIT ?").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "key_record"}).
+			AddRow("_IK_a_s_p", `{"Created":1700000060,"Key":"aWstYQ==","ParentKeyMeta":{"KeyId":"_SK_s_p","Created":1700000000}}`).
+			AddRow("_IK_b_s_p", `{"Created":1700000060,"Key":"aWstYg==","ParentKeyMeta":{"KeyId":"_SK_s_p","Created":1700000000}}`))
+	mock.ExpectQuery("SELECT id, key_record FROM encryption_key WHERE id > ? OR (id = ? AND created > ?) ORDER BY id, created LIMIT ?").
+		WillReturnError(errors.New("connection lost"))
+
+	migration := testAllocateStringBuffer(t, `{"Source":{"Metastore":"rdbms","SQLMetastoreDBType":"sqlmock","ConnectionString":"migrate-keys-partial-source"},`+
+		`"Destination":{"Metastore":"test-debug-memory"},"BatchSize":2}`)
+	output := cobhan.AllocateBuffer(4096)
+	if result := MigrateKeys(cobhan.Ptr(&migration), cobhan.Ptr(&output)); result != ERR_METASTORE_FAILED {
+		t.Fatalf("Expected MigrateKeys to return ERR_METASTORE_FAILED got %v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	var report asherah.MigrationReport
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &report); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+	if report.Scanned != 2 || report.Copied != 2 {
+		t.Errorf("Expected the first batch in the report got %+v", report)
+	}
+}
+
+func TestMigrateKeysErrors(t *testing.T) {
+	output := cobhan.AllocateBuffer(4096)
+	for migration, expected := range map[string]int32{
+		`{"Source":{"Metastore":"test-debug-memory"}}`:                                                                           ERR_BAD_CONFIG,
+		`{"Source":{"Metastore":"test-debug-memory"},"Destination":{"Metastore":"rdbms"}}`:                                       ERR_BAD_CONFIG,
+		`{"Source":{"Metastore":"test-debug-memory"},"Destination":{"Metastore":"test-debug-memory","EnableRegionSuffix":true}}`: ERR_BAD_CONFIG,
+		`{"Source":{"Metastore":"memory"},"Destination":{"Metastore":"test-debug-memory"}}`:                                      ERR_BAD_CONFIG,
+		`{"Source":`: cobhan.ERR_JSON_DECODE_FAILED,
+	} {
+		buf := testAllocateStringBuffer(t, migration)
+		if result := MigrateKeys(cobhan.Ptr(&buf), cobhan.Ptr(&output)); result != expected {
+			t.Errorf("%v: expected %v got %v", migration, expected, result)
+		}
+	}
+}
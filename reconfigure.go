@@ -0,0 +1,91 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+/*
+  ReconfigureJson changes the configuration of the default instance without Shutdown, keeping its
+  metastore and KMS connections and cached keys. configJson uses the SetupJson format; fields it
+  omits keep their current values. Only Verbose, LogLevel, LogFormat, NullDataCheck,
+  OperationTimeout, CheckInterval and ExpireAfter may change. Changing any other field, such as
+  ServiceName, ProductID, Metastore, DisableZeroCopy or a session cache setting, fails with
+  ERR_BAD_CONFIG and changes nothing. Session cache settings are deliberately not reloadable: the
+  Asherah session cache cannot be resized in place, and replacing it would drop every cached
+  session and key at once, so change them with Shutdown and Setup.
+*/
+//export ReconfigureJson
+func ReconfigureJson(configJson unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ReconfigureJson: Panic: %v", r)
+		}
+	}()
+
+	return reconfigure("ReconfigureJson", asherah.DefaultInstance, configJson)
+}
+
+// ReconfigureJsonWithInstance changes the configuration of the instance identified by handle, as
+// ReconfigureJson does. The library-wide Verbose, LogLevel, LogFormat and NullDataCheck settings
+// are only applied through ReconfigureJson.
+//
+//export ReconfigureJsonWithInstance
+func ReconfigureJsonWithInstance(handle int64, configJson unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ReconfigureJsonWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return reconfigure("ReconfigureJsonWithInstance", handle, configJson)
+}
+
+func reconfigure(caller string, handle int64, configJson unsafe.Pointer) int32 {
+	options, err := asherah.GetOptions(handle)
+	if err != nil {
+		return reportError(instanceErrorResult(err), caller+" failed: GetOptions returned %v", err)
+	}
+
+	options, result := mergeOptionsJson(configJson, options)
+	if result != cobhan.ERR_NONE {
+		return result
+	}
+
+	// Check the library-wide settings first so a failure leaves the instance unchanged, and apply
+	// them only once the instance has been reconfigured.
+	if _, err := logLevel(options); err != nil {
+		return reportError(ERR_BAD_CONFIG, caller+" failed: %v", err)
+	}
+
+	if err := asherah.Reconfigure(handle, options); err != nil {
+		return reportError(instanceErrorResult(err), caller+" failed: Reconfigure returned %v", err)
+	}
+
+	if handle == asherah.DefaultInstance {
+		configureLog(caller, options)
+		nullDataCheck.Store(options.NullDataCheck)
+	}
+
+	log.DebugLogf("Successfully reconfigured asherah instance %v", handle)
+
+	return cobhan.ERR_NONE
+}
+
+func instanceErrorResult(err error) int32 {
+	switch err {
+	case asherah.ErrAsherahNotInitialized:
+		return ERR_NOT_INITIALIZED
+	case asherah.ErrInstanceNotFound:
+		return ERR_INVALID_INSTANCE
+	default:
+		return setupErrorResult(err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestReconfigureJson(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	config := testAllocateStringBuffer(t, `{"NullDataCheck":true,"CheckInterval":"10m","OperationTimeout":"5s"}`)
+	if result := ReconfigureJson(cobhan.Ptr(&config)); result != cobhan.ERR_NONE {
+		t.Fatalf("ReconfigureJson returned %v", result)
+	}
+
+	if !nullDataCheck.Load() {
+		t.Error("Expected NullDataCheck to be applied")
+	}
+
+	options, err := asherah.GetOptions(asherah.DefaultInstance)
+	if err != nil {
+		t.Fatalf("GetOptions returned %v", err)
+	}
+	if options.OperationTimeout != 5*time.Second || options.ServiceName != "TestService" {
+		t.Errorf("Unexpected options %+v", options)
+	}
+
+	if report := testHealthCheck(t); !report.Healthy {
+		t.Errorf("Expected a healthy report got %+v", report)
+	}
+
+	nullDataCheck.Store(false)
+}
+
+func TestReconfigureJsonRejectsIdentityChange(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	config := testAllocateStringBuffer(t, `{"ProductID":"OtherProduct","NullDataCheck":true}`)
+	if result := ReconfigureJson(cobhan.Ptr(&config)); result != ERR_BAD_CONFIG {
+		t.Fatalf("Expected ERR_BAD_CONFIG got %v", result)
+	}
+
+	if nullDataCheck.Load() {
+		t.Error("Expected NullDataCheck to be unchanged")
+	}
+}
+
+func TestReconfigureJsonRejectsRegionMapSubset(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	config := testAllocateStringBuffer(t, `{"RegionMap":{"region1":"arn1"},"NullDataCheck":true}`)
+	if result := ReconfigureJson(cobhan.Ptr(&config)); result != ERR_BAD_CONFIG {
+		t.Fatalf("Expected ERR_BAD_CONFIG got %v", result)
+	}
+
+	if nullDataCheck.Load() {
+		t.Error("Expected NullDataCheck to be unchanged")
+	}
+}
+
+func TestReconfigureJsonRejectsSessionCacheAndZeroCopyChanges(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	for _, config := range []string{`{"SessionCacheMaxSize":5,"NullDataCheck":true}`, `{"DisableZeroCopy":true,"NullDataCheck":true}`} {
+		buf := testAllocateStringBuffer(t, config)
+		if result := ReconfigureJson(cobhan.Ptr(&buf)); result != ERR_BAD_CONFIG {
+			t.Errorf("%v: expected ERR_BAD_CONFIG got %v", config, result)
+		}
+	}
+
+	if nullDataCheck.Load() {
+		t.Error("Expected NullDataCheck to be unchanged")
+	}
+}
+
+func TestReconfigureJsonNotInitialized(t *testing.T) {
+	config := testAllocateStringBuffer(t, `{"Verbose":true}`)
+	if result := ReconfigureJson(cobhan.Ptr(&config)); result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+	}
+}
+
+func TestReconfigureJsonWithInstanceInvalidHandle(t *testing.T) {
+	config := testAllocateStringBuffer(t, `{"Verbose":true}`)
+	if result := ReconfigureJsonWithInstance(987654, cobhan.Ptr(&config)); result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected ERR_INVALID_INSTANCE got %v", result)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+/*
+  Reencrypt decrypts a DataRowRecord and encrypts it again under the current intermediate key of
+  the partition, writing the new DataRowRecord as JSON. The plaintext never leaves the library.
+  Use it to migrate records written under expired, rotated or revoked keys. It returns
+  ERR_GET_SESSION_FAILED if no session can be created for the partition, ERR_DECRYPT_FAILED if
+  drrJson cannot be decrypted and ERR_ENCRYPT_FAILED if it cannot be encrypted again.
+*/
+//export Reencrypt
+func Reencrypt(partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "Reencrypt: Panic: %v", r)
+		}
+	}()
+
+	return reencrypt("Reencrypt", asherah.DefaultInstance, partitionIdPtr, drrJsonPtr, outputJsonPtr)
+}
+
+//export ReencryptWithInstance
+func ReencryptWithInstance(handle int64, partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ReencryptWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return reencrypt("ReencryptWithInstance", handle, partitionIdPtr, drrJsonPtr, outputJsonPtr)
+}
+
+/*
+  ReencryptBatch re-encrypts a JSON array of DataRowRecords for a single partition using one
+  session, and writes a JSON array of BatchEncryptResult in the same order.
+  A failing item does not fail the batch; check the Result of every element.
+*/
+//export ReencryptBatch
+func ReencryptBatch(partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ReencryptBatch: Panic: %v", r)
+		}
+	}()
+
+	return reencryptBatch("ReencryptBatch", asherah.DefaultInstance, partitionIdPtr, drrJsonPtr, outputJsonPtr)
+}
+
+//export ReencryptBatchWithInstance
+func ReencryptBatchWithInstance(handle int64, partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ReencryptBatchWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return reencryptBatch("ReencryptBatchWithInstance", handle, partitionIdPtr, drrJsonPtr, outputJsonPtr)
+}
+
+func reencrypt(caller string, handle int64, partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	start := time.Now()
+	partitionId, result := cobhan.BufferToString(partitionIdPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert partitionIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var drr appencryption.DataRowRecord
+	result = cobhan.BufferToJsonStruct(drrJsonPtr, &drr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert drrJsonPtr cobhan buffer to JSON %v", cobhan.CobhanErrorToString(result))
+	}
+
+	defer func() { logOperation("reencrypt", partitionId, start, result) }()
+
+	reencrypted, err := asherah.ReencryptWithInstance(context.Background(), handle, partitionId, &drr, 0)
+	if err != nil {
+		return reportError(reencryptErrorResult(err), caller+" failed: ReencryptWithInstance returned %v", err)
+	}
+
+	result = cobhan.JsonToBuffer(reencrypted, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		if result == cobhan.ERR_BUFFER_TOO_SMALL {
+			outputBytes, err := json.Marshal(reencrypted)
+			if err == nil {
+				return reportError(result, caller+" failed: JsonToBuffer: Output buffer needed %v bytes", len(outputBytes))
+			}
+		}
+		return reportError(result, caller+" failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
+
+func reencryptBatch(caller string, handle int64, partitionIdPtr unsafe.Pointer, drrJsonPtr unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	var partitionId string
+	partitionId, result = cobhan.BufferToString(partitionIdPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert partitionIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var drrs []appencryption.DataRowRecord
+	result = cobhan.BufferToJsonStruct(drrJsonPtr, &drrs)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert drrJsonPtr cobhan buffer to JSON array %v", cobhan.CobhanErrorToString(result))
+	}
+
+	reencrypted, errs, err := asherah.ReencryptBatchWithInstance(handle, partitionId, drrs)
+	if err != nil {
+		return reportError(batchErrorResult(err), caller+" failed: ReencryptBatchWithInstance returned %v", err)
+	}
+
+	results := make([]BatchEncryptResult, len(reencrypted))
+	for n := range reencrypted {
+		if errs[n] != nil {
+			log.ErrorLogf(caller+": item %v failed: %v", n, errs[n])
+			results[n].Result = reencryptErrorResult(errs[n])
+			continue
+		}
+		results[n].DataRowRecord = reencrypted[n]
+	}
+
+	return batchResultsToBuffer(caller, results, outputJsonPtr)
+}
+
+func reencryptErrorResult(err error) int32 {
+	switch {
+	case err == asherah.ErrAsherahNotInitialized:
+		return ERR_NOT_INITIALIZED
+	case err == asherah.ErrInstanceNotFound:
+		return ERR_INVALID_INSTANCE
+	case errors.Is(err, asherah.ErrAsherahTimeout):
+		return ERR_TIMEOUT
+	case errors.Is(err, asherah.ErrGetSessionFailed):
+		return ERR_GET_SESSION_FAILED
+	case errors.Is(err, asherah.ErrDecryptFailed):
+		return ERR_DECRYPT_FAILED
+	default:
+		return ERR_ENCRYPT_FAILED
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/cobhan-go"
+)
+
+func testEncryptToJson(t *testing.T, partition []byte, input string) []byte {
+	data := testAllocateStringBuffer(t, input)
+	encrypted := cobhan.AllocateBuffer(4096)
+	if result := EncryptToJson(cobhan.Ptr(&partition), cobhan.Ptr(&data), cobhan.Ptr(&encrypted)); result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptToJson returned %v", result)
+	}
+	return encrypted
+}
+
+func TestReencrypt(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partition := testAllocateStringBuffer(t, "Partition")
+	encrypted := testEncryptToJson(t, partition, "InputString")
+
+	reencrypted := cobhan.AllocateBuffer(4096)
+	if result := Reencrypt(cobhan.Ptr(&partition), cobhan.Ptr(&encrypted), cobhan.Ptr(&reencrypted)); result != cobhan.ERR_NONE {
+		t.Fatalf("Reencrypt returned %v", result)
+	}
+
+	decrypted := cobhan.AllocateBuffer(256)
+	if result := DecryptFromJson(cobhan.Ptr(&partition), cobhan.Ptr(&reencrypted), cobhan.Ptr(&decrypted)); result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptFromJson returned %v", result)
+	}
+	if output, _ := cobhan.BufferToString(cobhan.Ptr(&decrypted)); output != "InputString" {
+		t.Errorf("Expected InputString got %v", output)
+	}
+
+	other := testAllocateStringBuffer(t, "OtherPartition")
+	if result := Reencrypt(cobhan.Ptr(&other), cobhan.Ptr(&encrypted), cobhan.Ptr(&reencrypted)); result != ERR_DECRYPT_FAILED {
+		t.Errorf("Expected ERR_DECRYPT_FAILED got %v", result)
+	}
+
+	empty := testAllocateEmptyBuffer(t)
+	if result := Reencrypt(cobhan.Ptr(&empty), cobhan.Ptr(&encrypted), cobhan.Ptr(&reencrypted)); result != ERR_GET_SESSION_FAILED {
+		t.Errorf("Expected ERR_GET_SESSION_FAILED got %v", result)
+	}
+
+	small := cobhan.AllocateBuffer(8)
+	if result := Reencrypt(cobhan.Ptr(&partition), cobhan.Ptr(&encrypted), cobhan.Ptr(&small)); result != cobhan.ERR_BUFFER_TOO_SMALL {
+		t.Errorf("Expected ERR_BUFFER_TOO_SMALL got %v", result)
+	}
+}
+
+func TestReencryptBatch(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partition := testAllocateStringBuffer(t, "Partition")
+	var drrs []appencryption.DataRowRecord
+	for _, input := range []string{"First", "Second"} {
+		encrypted := testEncryptToJson(t, partition, input)
+		var drr appencryption.DataRowRecord
+		if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&encrypted), &drr); result != cobhan.ERR_NONE {
+			t.Fatalf("BufferToJsonStruct returned %v", result)
+		}
+		drrs = append(drrs, drr)
+	}
+	drrs = append(drrs, appencryption.DataRowRecord{Key: &appencryption.EnvelopeKeyRecord{Created: 1, EncryptedKey: []byte("corrupt")}})
+
+	drrBuf := testAllocateJsonBuffer(t, drrs)
+	output := cobhan.AllocateBuffer(8192)
+	if result := ReencryptBatch(cobhan.Ptr(&partition), cobhan.Ptr(&drrBuf), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+		t.Fatalf("ReencryptBatch returned %v", result)
+	}
+
+	var results []BatchEncryptResult
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &results); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	if len(results) != 3 || results[0].DataRowRecord == nil || results[1].DataRowRecord == nil {
+		t.Fatalf("Expected two re-encrypted records got %+v", results)
+	}
+	if results[2].Result != ERR_DECRYPT_FAILED {
+		t.Errorf("Expected ERR_DECRYPT_FAILED for the corrupt record got %v", results[2].Result)
+	}
+}
+
+func TestReencryptNotInitialized(t *testing.T) {
+	partition := testAllocateStringBuffer(t, "Partition")
+	drr := testAllocateStringBuffer(t, `{"Key":{"Created":1,"Key":"AAAA","ParentKeyMeta":{"KeyId":"x","Created":1}},"Data":"AAAA"}`)
+	output := cobhan.AllocateBuffer(4096)
+
+	if result := Reencrypt(cobhan.Ptr(&partition), cobhan.Ptr(&drr), cobhan.Ptr(&output)); result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+	}
+	if result := ReencryptBatchWithInstance(-1, cobhan.Ptr(&partition), cobhan.Ptr(&drr), cobhan.Ptr(&output)); result != cobhan.ERR_JSON_DECODE_FAILED {
+		t.Errorf("Expected ERR_JSON_DECODE_FAILED for a non-array got %v", result)
+	}
+}
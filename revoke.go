@@ -0,0 +1,63 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"context"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+/*
+  RevokeKey marks a system or intermediate key revoked in the configured metastore.
+  keyMetaJson identifies the key as {"KeyId": string, "Created": number}, the form of the
+  ParentKeyMeta in the JSON returned by EncryptToJson. If the key is the latest for its ID a
+  replacement is stored, so the next write uses a fresh key. Revoking a system key forces a new
+  intermediate key for every partition of the service on its next write. Revoked keys are kept,
+  so existing data still decrypts. It returns ERR_KEY_NOT_FOUND if the key is not stored and
+  ERR_BAD_CONFIG if it does not belong to the configured service and product. Other processes
+  sharing the metastore stop using the key within their CheckInterval.
+*/
+//export RevokeKey
+func RevokeKey(keyMetaJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "RevokeKey: Panic: %v", r)
+		}
+	}()
+
+	return revokeKey("RevokeKey", asherah.DefaultInstance, keyMetaJsonPtr)
+}
+
+//export RevokeKeyWithInstance
+func RevokeKeyWithInstance(handle int64, keyMetaJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "RevokeKeyWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return revokeKey("RevokeKeyWithInstance", handle, keyMetaJsonPtr)
+}
+
+func revokeKey(caller string, handle int64, keyMetaJsonPtr unsafe.Pointer) int32 {
+	var meta appencryption.KeyMeta
+	result := cobhan.BufferToJsonStruct(keyMetaJsonPtr, &meta)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert keyMetaJsonPtr cobhan buffer to JSON %v", cobhan.CobhanErrorToString(result))
+	}
+
+	if err := asherah.RevokeKey(context.Background(), handle, meta); err != nil {
+		return reportError(keyErrorResult(err, ERR_METASTORE_FAILED), caller+" failed: RevokeKey returned %v", err)
+	}
+
+	log.DebugLogf("Successfully revoked key %v created %v", meta.ID, meta.Created)
+
+	return cobhan.ERR_NONE
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestRevokeKey(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	input := testAllocateStringBuffer(t, "InputString")
+	partition := testAllocateStringBuffer(t, "Partition")
+	encrypted := cobhan.AllocateBuffer(4096)
+	if result := EncryptToJson(cobhan.Ptr(&partition), cobhan.Ptr(&input), cobhan.Ptr(&encrypted)); result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptToJson returned %v", result)
+	}
+
+	var drr appencryption.DataRowRecord
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&encrypted), &drr); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	meta := testAllocateJsonBuffer(t, drr.Key.ParentKeyMeta)
+	if result := RevokeKey(cobhan.Ptr(&meta)); result != cobhan.ERR_NONE {
+		t.Fatalf("RevokeKey returned %v", result)
+	}
+
+	decrypted := cobhan.AllocateBuffer(256)
+	if result := DecryptFromJson(cobhan.Ptr(&partition), cobhan.Ptr(&encrypted), cobhan.Ptr(&decrypted)); result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptFromJson returned %v", result)
+	}
+	if output, _ := cobhan.BufferToString(cobhan.Ptr(&decrypted)); output != "InputString" {
+		t.Errorf("Expected InputString got %v", output)
+	}
+}
+
+func TestRevokeKeyErrors(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	for meta, expected := range map[string]int32{
+		`{"KeyId":"_IK_Partition_TestService_TestProduct","Created":1}`: ERR_KEY_NOT_FOUND,
+		`{"KeyId":"_SK_OtherService_TestProduct","Created":1}`:          ERR_BAD_CONFIG,
+		`{"KeyId":`: cobhan.ERR_JSON_DECODE_FAILED,
+	} {
+		buf := testAllocateStringBuffer(t, meta)
+		if result := RevokeKey(cobhan.Ptr(&buf)); result != expected {
+			t.Errorf("%v: expected %v got %v", meta, expected, result)
+		}
+	}
+}
+
+func TestRevokeKeyNotInitialized(t *testing.T) {
+	meta := testAllocateStringBuffer(t, `{"KeyId":"_SK_TestService_TestProduct","Created":1}`)
+	if result := RevokeKey(cobhan.Ptr(&meta)); result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+	}
+	if result := RevokeKeyWithInstance(-1, cobhan.Ptr(&meta)); result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected ERR_INVALID_INSTANCE got %v", result)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+/*
+  RotateKeys forces new keys for the next write instead of waiting for ExpireAfter, for example
+  after a suspected key exposure. scopeJson is {"SystemKey": bool, "IntermediateKey": bool} and
+  may be empty. With a partitionId the partition's intermediate key is always rotated, and the
+  system key too if SystemKey is set. With an empty partitionId the system key is rotated, and
+  every partition of the service gets a new intermediate key on its next write; setting
+  IntermediateKey then fails with ERR_BAD_CONFIG. Replaced keys are revoked, not deleted, so
+  existing data still decrypts. Other processes sharing the metastore pick up the new keys
+  within their CheckInterval.
+*/
+//export RotateKeys
+func RotateKeys(partitionIdPtr unsafe.Pointer, scopeJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "RotateKeys: Panic: %v", r)
+		}
+	}()
+
+	return rotateKeys("RotateKeys", asherah.DefaultInstance, partitionIdPtr, scopeJsonPtr)
+}
+
+//export RotateKeysWithInstance
+func RotateKeysWithInstance(handle int64, partitionIdPtr unsafe.Pointer, scopeJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "RotateKeysWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return rotateKeys("RotateKeysWithInstance", handle, partitionIdPtr, scopeJsonPtr)
+}
+
+func rotateKeys(caller string, handle int64, partitionIdPtr unsafe.Pointer, scopeJsonPtr unsafe.Pointer) int32 {
+	partitionId, result := cobhan.BufferToString(partitionIdPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert partitionIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	scopeJson, result := cobhan.BufferToBytes(scopeJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert scopeJsonPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var scope asherah.RotateScope
+	if len(scopeJson) > 0 {
+		if err := json.Unmarshal(scopeJson, &scope); err != nil {
+			return reportError(cobhan.ERR_JSON_DECODE_FAILED, caller+" failed: Failed to deserialize scope: %v", err)
+		}
+	}
+
+	if err := asherah.RotateKeys(context.Background(), handle, partitionId, scope); err != nil {
+		return reportError(keyErrorResult(err, ERR_KEY_ROTATION_FAILED), caller+" failed: RotateKeys returned %v", err)
+	}
+
+	log.DebugLogf("Successfully rotated keys of asherah instance %v", handle)
+
+	return cobhan.ERR_NONE
+}
+
+// keyErrorResult maps a key management failure to its result code, returning defaultResult for
+// failures without a more specific code.
+func keyErrorResult(err error, defaultResult int32) int32 {
+	switch {
+	case errors.Is(err, asherah.ErrAsherahTimeout):
+		return ERR_TIMEOUT
+	case errors.Is(err, asherah.ErrInvalidConfig):
+		return ERR_BAD_CONFIG
+	case errors.Is(err, asherah.ErrKeyNotFound):
+		return ERR_KEY_NOT_FOUND
+	case errors.Is(err, asherah.ErrMetastoreFailed):
+		return ERR_METASTORE_FAILED
+	case errors.Is(err, asherah.ErrKMSFailed):
+		return ERR_KMS_FAILED
+	case err == asherah.ErrAsherahNotInitialized, err == asherah.ErrInstanceNotFound:
+		return instanceErrorResult(err)
+	default:
+		return defaultResult
+	}
+}
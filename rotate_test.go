@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestRotateKeys(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	input := testAllocateStringBuffer(t, "InputString")
+	partition := testAllocateStringBuffer(t, "Partition")
+	encrypted := cobhan.AllocateBuffer(4096)
+	if result := EncryptToJson(cobhan.Ptr(&partition), cobhan.Ptr(&input), cobhan.Ptr(&encrypted)); result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptToJson returned %v", result)
+	}
+
+	for _, scopeJson := range []string{"", `{"IntermediateKey":true}`, `{"SystemKey":true,"IntermediateKey":true}`} {
+		scope := testAllocateEmptyBuffer(t)
+		if scopeJson != "" {
+			scope = testAllocateStringBuffer(t, scopeJson)
+		}
+		if result := RotateKeys(cobhan.Ptr(&partition), cobhan.Ptr(&scope)); result != cobhan.ERR_NONE {
+			t.Errorf("RotateKeys(%q) returned %v", scopeJson, result)
+		}
+	}
+
+	decrypted := cobhan.AllocateBuffer(256)
+	if result := DecryptFromJson(cobhan.Ptr(&partition), cobhan.Ptr(&encrypted), cobhan.Ptr(&decrypted)); result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptFromJson returned %v", result)
+	}
+	if output, _ := cobhan.BufferToString(cobhan.Ptr(&decrypted)); output != "InputString" {
+		t.Errorf("Expected InputString got %v", output)
+	}
+}
+
+func TestRotateKeysBadScope(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	empty := testAllocateEmptyBuffer(t)
+	scope := testAllocateStringBuffer(t, `{"IntermediateKey":true}`)
+	if result := RotateKeys(cobhan.Ptr(&empty), cobhan.Ptr(&scope)); result != ERR_BAD_CONFIG {
+		t.Errorf("Expected ERR_BAD_CONFIG got %v", result)
+	}
+
+	partition := testAllocateStringBuffer(t, "Partition")
+	scope = testAllocateStringBuffer(t, `{"SystemKey":"yes"}`)
+	if result := RotateKeys(cobhan.Ptr(&partition), cobhan.Ptr(&scope)); result != cobhan.ERR_JSON_DECODE_FAILED {
+		t.Errorf("Expected ERR_JSON_DECODE_FAILED got %v", result)
+	}
+}
+
+func TestRotateKeysNotInitialized(t *testing.T) {
+	partition := testAllocateStringBuffer(t, "Partition")
+	scope := testAllocateEmptyBuffer(t)
+	if result := RotateKeys(cobhan.Ptr(&partition), cobhan.Ptr(&scope)); result != ERR_NOT_INITIALIZED {
+		t.Errorf("Expected ERR_NOT_INITIALIZED got %v", result)
+	}
+	if result := RotateKeysWithInstance(-1, cobhan.Ptr(&partition), cobhan.Ptr(&scope)); result != ERR_INVALID_INSTANCE {
+		t.Errorf("Expected ERR_INVALID_INSTANCE got %v", result)
+	}
+}
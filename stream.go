@@ -0,0 +1,265 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+// errStreamOutput reports that a stream chunk could not be written to the caller's output buffer; the
+// cobhan result is kept by the export, which leaves the stream where it was so the chunk can be retried.
+var errStreamOutput = errors.New("stream output buffer write failed")
+
+// EstimateStreamHeaderBuffer returns the buffer size needed for the header written by EncryptStreamBegin.
+//
+//export EstimateStreamHeaderBuffer
+func EstimateStreamHeaderBuffer(partitionLen int32) int32 {
+	return EstimateBuffer(32, partitionLen) + asherah.StreamFrameOverhead
+}
+
+// EstimateStreamChunkBuffer returns the buffer size needed for the chunk produced from dataLen bytes of plaintext.
+//
+//export EstimateStreamChunkBuffer
+func EstimateStreamChunkBuffer(dataLen int32) int32 {
+	return int32(cobhan.BUFFER_HEADER_SIZE + asherah.StreamChunkOverhead + int(dataLen))
+}
+
+/*
+  EncryptStreamBegin starts a chunked encryption for a partition. The header written to
+  outputHeaderPtr must be stored ahead of the chunks returned by EncryptStreamUpdate and
+  EncryptStreamFinish. See STREAMING.md for the envelope format.
+*/
+//export EncryptStreamBegin
+func EncryptStreamBegin(partitionIdPtr unsafe.Pointer, outputHeaderPtr unsafe.Pointer, outputStreamHandlePtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptStreamBegin: Panic: %v", r)
+		}
+	}()
+
+	return encryptStreamBegin("EncryptStreamBegin", asherah.DefaultInstance, partitionIdPtr, outputHeaderPtr, outputStreamHandlePtr)
+}
+
+//export EncryptStreamBeginWithInstance
+func EncryptStreamBeginWithInstance(handle int64, partitionIdPtr unsafe.Pointer, outputHeaderPtr unsafe.Pointer, outputStreamHandlePtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptStreamBeginWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return encryptStreamBegin("EncryptStreamBeginWithInstance", handle, partitionIdPtr, outputHeaderPtr, outputStreamHandlePtr)
+}
+
+//export EncryptStreamUpdate
+func EncryptStreamUpdate(streamHandle int64, dataPtr unsafe.Pointer, outputChunkPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptStreamUpdate: Panic: %v", r)
+		}
+	}()
+
+	return encryptStreamChunk("EncryptStreamUpdate", streamHandle, dataPtr, outputChunkPtr, false)
+}
+
+// EncryptStreamFinish encrypts the last (possibly empty) chunk and releases the stream handle.
+//
+//export EncryptStreamFinish
+func EncryptStreamFinish(streamHandle int64, dataPtr unsafe.Pointer, outputChunkPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptStreamFinish: Panic: %v", r)
+		}
+	}()
+
+	return encryptStreamChunk("EncryptStreamFinish", streamHandle, dataPtr, outputChunkPtr, true)
+}
+
+//export DecryptStreamBegin
+func DecryptStreamBegin(partitionIdPtr unsafe.Pointer, headerPtr unsafe.Pointer, outputStreamHandlePtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptStreamBegin: Panic: %v", r)
+		}
+	}()
+
+	return decryptStreamBegin("DecryptStreamBegin", asherah.DefaultInstance, partitionIdPtr, headerPtr, outputStreamHandlePtr)
+}
+
+//export DecryptStreamBeginWithInstance
+func DecryptStreamBeginWithInstance(handle int64, partitionIdPtr unsafe.Pointer, headerPtr unsafe.Pointer, outputStreamHandlePtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptStreamBeginWithInstance: Panic: %v", r)
+		}
+	}()
+
+	return decryptStreamBegin("DecryptStreamBeginWithInstance", handle, partitionIdPtr, headerPtr, outputStreamHandlePtr)
+}
+
+//export DecryptStreamUpdate
+func DecryptStreamUpdate(streamHandle int64, chunkPtr unsafe.Pointer, outputDataPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptStreamUpdate: Panic: %v", r)
+		}
+	}()
+
+	var chunk []byte
+	chunk, result = cobhan.BufferToBytes(chunkPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "DecryptStreamUpdate failed: Failed to convert chunkPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
+	}
+
+	err := asherah.DecryptStreamChunk(streamHandle, chunk, func(data []byte) error {
+		result = cobhan.BytesToBuffer(data, outputDataPtr)
+		if result != cobhan.ERR_NONE {
+			return errStreamOutput
+		}
+		return nil
+	})
+	if err == errStreamOutput {
+		return reportError(result, "DecryptStreamUpdate failed: BytesToBuffer returned %v for outputDataPtr", cobhan.CobhanErrorToString(result))
+	}
+	if err != nil {
+		return reportError(streamErrorResult(err, ERR_DECRYPT_FAILED), "DecryptStreamUpdate failed: DecryptStreamChunk returned %v", err)
+	}
+
+	return cobhan.ERR_NONE
+}
+
+// DecryptStreamFinish releases the stream handle and returns ERR_STREAM_TRUNCATED if the final chunk was never decrypted.
+//
+//export DecryptStreamFinish
+func DecryptStreamFinish(streamHandle int64) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptStreamFinish: Panic: %v", r)
+		}
+	}()
+
+	if err := asherah.FinishDecryptStream(streamHandle); err != nil {
+		return reportError(streamErrorResult(err, ERR_DECRYPT_FAILED), "DecryptStreamFinish failed: FinishDecryptStream returned %v", err)
+	}
+
+	return cobhan.ERR_NONE
+}
+
+// AbortStream releases an encrypt or decrypt stream handle that will not be completed.
+//
+//export AbortStream
+func AbortStream(streamHandle int64) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "AbortStream: Panic: %v", r)
+		}
+	}()
+
+	if err := asherah.AbortStream(streamHandle); err != nil {
+		return reportError(ERR_INVALID_STREAM, "AbortStream failed: AbortStream returned %v", err)
+	}
+
+	return cobhan.ERR_NONE
+}
+
+func encryptStreamBegin(caller string, handle int64, partitionIdPtr unsafe.Pointer, outputHeaderPtr unsafe.Pointer, outputStreamHandlePtr unsafe.Pointer) (result int32) {
+	var partitionId string
+	partitionId, result = cobhan.BufferToString(partitionIdPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert partitionIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	streamHandle, header, err := asherah.BeginEncryptStream(handle, partitionId)
+	if err != nil {
+		return reportError(streamErrorResult(err, ERR_ENCRYPT_FAILED), caller+" failed: BeginEncryptStream returned %v", err)
+	}
+
+	result = cobhan.BytesToBuffer(header, outputHeaderPtr)
+	if result != cobhan.ERR_NONE {
+		asherah.AbortStream(streamHandle)
+		return reportError(result, caller+" failed: BytesToBuffer returned %v for outputHeaderPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	result = cobhan.Int64ToBuffer(streamHandle, outputStreamHandlePtr)
+	if result != cobhan.ERR_NONE {
+		asherah.AbortStream(streamHandle)
+		return reportError(result, caller+" failed: Int64ToBuffer returned %v for outputStreamHandlePtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
+
+func encryptStreamChunk(caller string, streamHandle int64, dataPtr unsafe.Pointer, outputChunkPtr unsafe.Pointer, final bool) (result int32) {
+	var data []byte
+	data, result = cobhan.BufferToBytes(dataPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert dataPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
+	}
+
+	err := asherah.EncryptStreamChunk(streamHandle, data, final, func(chunk []byte) error {
+		result = cobhan.BytesToBuffer(chunk, outputChunkPtr)
+		if result != cobhan.ERR_NONE {
+			return errStreamOutput
+		}
+		return nil
+	})
+	if err == errStreamOutput {
+		return reportError(result, caller+" failed: BytesToBuffer returned %v for outputChunkPtr", cobhan.CobhanErrorToString(result))
+	}
+	if err != nil {
+		return reportError(streamErrorResult(err, ERR_ENCRYPT_FAILED), caller+" failed: EncryptStreamChunk returned %v", err)
+	}
+
+	return cobhan.ERR_NONE
+}
+
+func decryptStreamBegin(caller string, handle int64, partitionIdPtr unsafe.Pointer, headerPtr unsafe.Pointer, outputStreamHandlePtr unsafe.Pointer) (result int32) {
+	var partitionId string
+	partitionId, result = cobhan.BufferToString(partitionIdPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert partitionIdPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	var header []byte
+	header, result = cobhan.BufferToBytes(headerPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, caller+" failed: Failed to convert headerPtr cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
+	}
+
+	streamHandle, err := asherah.BeginDecryptStream(handle, partitionId, header)
+	if err != nil {
+		return reportError(streamErrorResult(err, ERR_DECRYPT_FAILED), caller+" failed: BeginDecryptStream returned %v", err)
+	}
+
+	result = cobhan.Int64ToBuffer(streamHandle, outputStreamHandlePtr)
+	if result != cobhan.ERR_NONE {
+		asherah.AbortStream(streamHandle)
+		return reportError(result, caller+" failed: Int64ToBuffer returned %v for outputStreamHandlePtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
+
+func streamErrorResult(err error, defaultResult int32) int32 {
+	switch err {
+	case asherah.ErrAsherahNotInitialized:
+		return ERR_NOT_INITIALIZED
+	case asherah.ErrInstanceNotFound:
+		return ERR_INVALID_INSTANCE
+	case asherah.ErrStreamNotFound:
+		return ERR_INVALID_STREAM
+	case asherah.ErrStreamTruncated:
+		return ERR_STREAM_TRUNCATED
+	default:
+		if errors.Is(err, asherah.ErrAsherahTimeout) {
+			return ERR_TIMEOUT
+		}
+		return defaultResult
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+)
+
+func encryptStreamForTesting(t *testing.T, partitionIdBuf []byte, chunks []string) [][]byte {
+	headerBuf := cobhan.AllocateBuffer(int(EstimateStreamHeaderBuffer(int32(len(partitionIdBuf)))))
+	handleBuf := cobhan.AllocateBuffer(8)
+
+	result := EncryptStreamBegin(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&headerBuf), cobhan.Ptr(&handleBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptStreamBegin returned %v", result)
+	}
+
+	streamHandle, result := cobhan.BufferToInt64Safe(&handleBuf)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToInt64Safe returned %v", result)
+	}
+
+	header, result := cobhan.BufferToBytes(cobhan.Ptr(&headerBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToBytes returned %v", result)
+	}
+	frames := [][]byte{header}
+
+	for n, chunk := range chunks {
+		dataBuf := testAllocateEmptyBuffer(t)
+		if chunk != "" {
+			dataBuf = testAllocateStringBuffer(t, chunk)
+		}
+		chunkBuf := cobhan.AllocateBuffer(int(EstimateStreamChunkBuffer(int32(len(chunk)))))
+
+		if n == len(chunks)-1 {
+			result = EncryptStreamFinish(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&chunkBuf))
+		} else {
+			result = EncryptStreamUpdate(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&chunkBuf))
+		}
+		if result != cobhan.ERR_NONE {
+			t.Fatalf("Encrypting chunk %v returned %v", n, result)
+		}
+
+		frame, result := cobhan.BufferToBytes(cobhan.Ptr(&chunkBuf))
+		if result != cobhan.ERR_NONE {
+			t.Fatalf("BufferToBytes returned %v", result)
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames
+}
+
+func decryptStreamForTesting(t *testing.T, partitionIdBuf []byte, frames [][]byte) (string, int32) {
+	headerBuf := testAllocateBytesBuffer(t, frames[0])
+	handleBuf := cobhan.AllocateBuffer(8)
+
+	result := DecryptStreamBegin(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&headerBuf), cobhan.Ptr(&handleBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptStreamBegin returned %v", result)
+	}
+
+	streamHandle, result := cobhan.BufferToInt64Safe(&handleBuf)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToInt64Safe returned %v", result)
+	}
+
+	var output bytes.Buffer
+	for _, frame := range frames[1:] {
+		chunkBuf := testAllocateBytesBuffer(t, frame)
+		dataBuf := cobhan.AllocateBuffer(len(frame))
+
+		result = DecryptStreamUpdate(streamHandle, cobhan.Ptr(&chunkBuf), cobhan.Ptr(&dataBuf))
+		if result != cobhan.ERR_NONE {
+			AbortStream(streamHandle)
+			return output.String(), result
+		}
+
+		data, result := cobhan.BufferToBytes(cobhan.Ptr(&dataBuf))
+		if result != cobhan.ERR_NONE {
+			t.Fatalf("BufferToBytes returned %v", result)
+		}
+		output.Write(data)
+	}
+
+	return output.String(), DecryptStreamFinish(streamHandle)
+}
+
+func TestEncryptStreamDecryptStreamCycle(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	chunks := []string{"First chunk ", "second chunk ", "", "last chunk"}
+
+	frames := encryptStreamForTesting(t, partitionIdBuf, chunks)
+
+	output, result := decryptStreamForTesting(t, partitionIdBuf, frames)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("Decrypting stream returned %v", result)
+	}
+
+	if output != "First chunk second chunk last chunk" {
+		t.Errorf("Decrypted stream %q does not match input", output)
+	}
+}
+
+func TestDecryptStreamReorderedChunks(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	frames := encryptStreamForTesting(t, partitionIdBuf, []string{"one", "two", "three"})
+	frames[1], frames[2] = frames[2], frames[1]
+
+	_, result := decryptStreamForTesting(t, partitionIdBuf, frames)
+	if result != ERR_DECRYPT_FAILED {
+		t.Errorf("Expected reordered stream to return ERR_DECRYPT_FAILED got %v", result)
+	}
+}
+
+func TestDecryptStreamTruncated(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	frames := encryptStreamForTesting(t, partitionIdBuf, []string{"one", "two", "three"})
+
+	_, result := decryptStreamForTesting(t, partitionIdBuf, frames[:len(frames)-1])
+	if result != ERR_STREAM_TRUNCATED {
+		t.Errorf("Expected truncated stream to return ERR_STREAM_TRUNCATED got %v", result)
+	}
+}
+
+func TestEncryptStreamUpdateAfterFinish(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	headerBuf := cobhan.AllocateBuffer(512)
+	handleBuf := cobhan.AllocateBuffer(8)
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+
+	result := EncryptStreamBegin(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&headerBuf), cobhan.Ptr(&handleBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptStreamBegin returned %v", result)
+	}
+
+	streamHandle, _ := cobhan.BufferToInt64Safe(&handleBuf)
+	dataBuf := testAllocateStringBuffer(t, "data")
+	chunkBuf := cobhan.AllocateBuffer(64)
+
+	result = EncryptStreamFinish(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&chunkBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptStreamFinish returned %v", result)
+	}
+
+	result = EncryptStreamUpdate(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&chunkBuf))
+	if result != ERR_INVALID_STREAM {
+		t.Errorf("Expected EncryptStreamUpdate after finish to return ERR_INVALID_STREAM got %v", result)
+	}
+}
+
+func TestEncryptStreamRetryAfterBufferTooSmall(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	headerBuf := cobhan.AllocateBuffer(int(EstimateStreamHeaderBuffer(int32(len(partitionIdBuf)))))
+	handleBuf := cobhan.AllocateBuffer(8)
+
+	result := EncryptStreamBegin(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&headerBuf), cobhan.Ptr(&handleBuf))
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptStreamBegin returned %v", result)
+	}
+
+	streamHandle, _ := cobhan.BufferToInt64Safe(&handleBuf)
+	header, _ := cobhan.BufferToBytes(cobhan.Ptr(&headerBuf))
+	frames := [][]byte{header}
+
+	for n, chunk := range []string{"first chunk", "last chunk"} {
+		dataBuf := testAllocateStringBuffer(t, chunk)
+		encrypt := EncryptStreamUpdate
+		if n == 1 {
+			encrypt = EncryptStreamFinish
+		}
+
+		small := cobhan.AllocateBuffer(4)
+		if result := encrypt(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&small)); result != cobhan.ERR_BUFFER_TOO_SMALL {
+			t.Fatalf("Expected ERR_BUFFER_TOO_SMALL for chunk %v got %v", n, result)
+		}
+
+		chunkBuf := cobhan.AllocateBuffer(int(EstimateStreamChunkBuffer(int32(len(chunk)))))
+		if result := encrypt(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&chunkBuf)); result != cobhan.ERR_NONE {
+			t.Fatalf("Retrying chunk %v returned %v", n, result)
+		}
+
+		frame, _ := cobhan.BufferToBytes(cobhan.Ptr(&chunkBuf))
+		frames = append(frames, frame)
+	}
+
+	output, result := decryptStreamForTesting(t, partitionIdBuf, frames)
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("Decrypting stream returned %v", result)
+	}
+	if output != "first chunklast chunk" {
+		t.Errorf("Decrypted stream %q does not match input", output)
+	}
+}
+
+func TestDecryptStreamRetryAfterBufferTooSmall(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	frames := encryptStreamForTesting(t, partitionIdBuf, []string{"first chunk", "last chunk"})
+
+	headerBuf := testAllocateBytesBuffer(t, frames[0])
+	handleBuf := cobhan.AllocateBuffer(8)
+	if result := DecryptStreamBegin(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&headerBuf), cobhan.Ptr(&handleBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("DecryptStreamBegin returned %v", result)
+	}
+	streamHandle, _ := cobhan.BufferToInt64Safe(&handleBuf)
+
+	var output bytes.Buffer
+	for n, frame := range frames[1:] {
+		chunkBuf := testAllocateBytesBuffer(t, frame)
+
+		small := cobhan.AllocateBuffer(4)
+		if result := DecryptStreamUpdate(streamHandle, cobhan.Ptr(&chunkBuf), cobhan.Ptr(&small)); result != cobhan.ERR_BUFFER_TOO_SMALL {
+			t.Fatalf("Expected ERR_BUFFER_TOO_SMALL for chunk %v got %v", n, result)
+		}
+
+		dataBuf := cobhan.AllocateBuffer(len(frame))
+		if result := DecryptStreamUpdate(streamHandle, cobhan.Ptr(&chunkBuf), cobhan.Ptr(&dataBuf)); result != cobhan.ERR_NONE {
+			t.Fatalf("Retrying chunk %v returned %v", n, result)
+		}
+
+		data, _ := cobhan.BufferToBytes(cobhan.Ptr(&dataBuf))
+		output.Write(data)
+	}
+
+	if result := DecryptStreamFinish(streamHandle); result != cobhan.ERR_NONE {
+		t.Errorf("DecryptStreamFinish returned %v", result)
+	}
+	if output.String() != "first chunklast chunk" {
+		t.Errorf("Decrypted stream %q does not match input", output.String())
+	}
+}
+
+func TestEncryptStreamRetryRejectsDifferentData(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	partitionIdBuf := testAllocateStringBuffer(t, "Partition")
+	headerBuf := cobhan.AllocateBuffer(int(EstimateStreamHeaderBuffer(int32(len(partitionIdBuf)))))
+	handleBuf := cobhan.AllocateBuffer(8)
+
+	if result := EncryptStreamBegin(cobhan.Ptr(&partitionIdBuf), cobhan.Ptr(&headerBuf), cobhan.Ptr(&handleBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptStreamBegin returned %v", result)
+	}
+
+	streamHandle, _ := cobhan.BufferToInt64Safe(&handleBuf)
+	header, _ := cobhan.BufferToBytes(cobhan.Ptr(&headerBuf))
+
+	dataBuf := testAllocateStringBuffer(t, "original chunk")
+	small := cobhan.AllocateBuffer(4)
+	if result := EncryptStreamUpdate(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&small)); result != cobhan.ERR_BUFFER_TOO_SMALL {
+		t.Fatalf("Expected ERR_BUFFER_TOO_SMALL got %v", result)
+	}
+
+	chunkBuf := cobhan.AllocateBuffer(int(EstimateStreamChunkBuffer(64)))
+	otherBuf := testAllocateStringBuffer(t, "different data")
+	if result := EncryptStreamUpdate(streamHandle, cobhan.Ptr(&otherBuf), cobhan.Ptr(&chunkBuf)); result != ERR_ENCRYPT_FAILED {
+		t.Fatalf("Expected a retry with different data to return ERR_ENCRYPT_FAILED got %v", result)
+	}
+	if result := EncryptStreamFinish(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&chunkBuf)); result != ERR_ENCRYPT_FAILED {
+		t.Fatalf("Expected an update retried as a finish to return ERR_ENCRYPT_FAILED got %v", result)
+	}
+
+	if result := EncryptStreamUpdate(streamHandle, cobhan.Ptr(&dataBuf), cobhan.Ptr(&chunkBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("Retrying with the original data returned %v", result)
+	}
+	frame, _ := cobhan.BufferToBytes(cobhan.Ptr(&chunkBuf))
+	frame = bytes.Clone(frame)
+
+	lastBuf := testAllocateStringBuffer(t, "last")
+	if result := EncryptStreamFinish(streamHandle, cobhan.Ptr(&lastBuf), cobhan.Ptr(&chunkBuf)); result != cobhan.ERR_NONE {
+		t.Fatalf("EncryptStreamFinish returned %v", result)
+	}
+	last, _ := cobhan.BufferToBytes(cobhan.Ptr(&chunkBuf))
+
+	output, result := decryptStreamForTesting(t, partitionIdBuf, [][]byte{header, frame, last})
+	if result != cobhan.ERR_NONE {
+		t.Fatalf("Decrypting stream returned %v", result)
+	}
+	if output != "original chunklast" {
+		t.Errorf("Decrypted stream %q does not match input", output)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"context"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+	"github.com/godaddy/asherah-cobhan/internal/log"
+)
+
+/*
+  EncryptToJsonWithTraceparent is EncryptToJson with a W3C traceparent header value (for example
+  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01") so the spans exported to the
+  TracingEndpoint collector join the caller's trace. An empty or invalid traceparent starts a
+  new trace; it never fails the call.
+*/
+//export EncryptToJsonWithTraceparent
+func EncryptToJsonWithTraceparent(partitionIdPtr unsafe.Pointer, dataPtr unsafe.Pointer, jsonPtr unsafe.Pointer, traceparentPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "EncryptToJsonWithTraceparent: Panic: %v", r)
+		}
+	}()
+
+	ctx, result := traceContext("EncryptToJsonWithTraceparent", traceparentPtr)
+	if result != cobhan.ERR_NONE {
+		return result
+	}
+
+	return encryptToJson(ctx, "EncryptToJsonWithTraceparent", asherah.DefaultInstance, partitionIdPtr, dataPtr, jsonPtr, 0)
+}
+
+// DecryptFromJsonWithTraceparent is DecryptFromJson with a W3C traceparent; see EncryptToJsonWithTraceparent.
+//
+//export DecryptFromJsonWithTraceparent
+func DecryptFromJsonWithTraceparent(partitionIdPtr unsafe.Pointer, jsonPtr unsafe.Pointer, dataPtr unsafe.Pointer, traceparentPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "DecryptFromJsonWithTraceparent: Panic: %v", r)
+		}
+	}()
+
+	ctx, result := traceContext("DecryptFromJsonWithTraceparent", traceparentPtr)
+	if result != cobhan.ERR_NONE {
+		return result
+	}
+
+	return decryptFromJson(ctx, "DecryptFromJsonWithTraceparent", asherah.DefaultInstance, partitionIdPtr, jsonPtr, dataPtr, 0)
+}
+
+func traceContext(caller string, traceparentPtr unsafe.Pointer) (context.Context, int32) {
+	traceparent, result := cobhan.BufferToString(traceparentPtr)
+	if result != cobhan.ERR_NONE {
+		return nil, reportError(result, caller+" failed: Failed to convert traceparentPtr cobhan buffer to string %v", cobhan.CobhanErrorToString(result))
+	}
+
+	ctx, err := asherah.ContextWithTraceparent(context.Background(), traceparent)
+	if err != nil {
+		log.Logf(log.LevelWarn, log.ComponentCobhan, caller+": ignoring traceparent: %v", err)
+	}
+
+	return ctx, cobhan.ERR_NONE
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestEncryptDecryptJsonWithTraceparent(t *testing.T) {
+	setupAsherahForTesting(t)
+	defer Shutdown()
+
+	for _, traceparent := range []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "garbage"} {
+		partitionId := testAllocateStringBuffer(t, "Partition")
+		input := testAllocateStringBuffer(t, "InputData")
+		traceparentBuf := testAllocateEmptyBuffer(t)
+		if traceparent != "" {
+			traceparentBuf = testAllocateStringBuffer(t, traceparent)
+		}
+		encrypted := cobhan.AllocateBuffer(EstimateBufferInt(len("InputData"), len("Partition")) + 256)
+
+		result := EncryptToJsonWithTraceparent(cobhan.Ptr(&partitionId), cobhan.Ptr(&input), cobhan.Ptr(&encrypted), cobhan.Ptr(&traceparentBuf))
+		if result != cobhan.ERR_NONE {
+			t.Fatalf("EncryptToJsonWithTraceparent(%q) returned %v", traceparent, result)
+		}
+
+		decrypted := cobhan.AllocateBuffer(256)
+		result = DecryptFromJsonWithTraceparent(cobhan.Ptr(&partitionId), cobhan.Ptr(&encrypted), cobhan.Ptr(&decrypted), cobhan.Ptr(&traceparentBuf))
+		if result != cobhan.ERR_NONE {
+			t.Fatalf("DecryptFromJsonWithTraceparent(%q) returned %v", traceparent, result)
+		}
+
+		output, result := cobhan.BufferToString(cobhan.Ptr(&decrypted))
+		if result != cobhan.ERR_NONE || output != "InputData" {
+			t.Errorf("Expected InputData got %q (%v)", output, result)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"encoding/json"
+	"errors"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+// ValidationResult is written by ValidateConfigJson.
+type ValidationResult struct {
+	Valid  bool                 `json:"Valid"`
+	Errors []asherah.FieldError `json:"Errors"`
+}
+
+/*
+  ValidateConfigJson checks a SetupJson configuration without initializing anything and writes
+  a ValidationResult listing every field-level problem. SetupJson and CreateInstance apply the
+  same checks and return ERR_BAD_CONFIG for a configuration reported as invalid here. The
+  result is ERR_NONE whenever the report is written, including for malformed JSON.
+*/
+//export ValidateConfigJson
+func ValidateConfigJson(configJson unsafe.Pointer, outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "ValidateConfigJson: Panic: %v", r)
+		}
+	}()
+
+	var config []byte
+	config, result = cobhan.BufferToBytes(configJson)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "ValidateConfigJson failed: Failed to convert configJson cobhan buffer to bytes %v", cobhan.CobhanErrorToString(result))
+	}
+
+	validation := validateConfig(config)
+
+	result = cobhan.JsonToBuffer(&validation, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "ValidateConfigJson failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
+
+func validateConfig(config []byte) ValidationResult {
+	validation := ValidationResult{Valid: true, Errors: []asherah.FieldError{}}
+
+	options := &asherah.Options{}
+	if err := json.Unmarshal(config, options); err != nil {
+		validation.Valid = false
+		var typeError *json.UnmarshalTypeError
+		var validationError asherah.ValidationError
+		if errors.As(err, &validationError) {
+			validation.Errors = append(validation.Errors, validationError...)
+		} else if errors.As(err, &typeError) {
+			validation.Errors = append(validation.Errors, asherah.FieldError{Field: typeError.Field, Message: "expected " + typeError.Type.String() + ", got JSON " + typeError.Value})
+		} else {
+			validation.Errors = append(validation.Errors, asherah.FieldError{Message: err.Error()})
+		}
+		return validation
+	}
+
+	var validationError asherah.ValidationError
+	if err := options.Validate(); errors.As(err, &validationError) {
+		validation.Valid = false
+		validation.Errors = append(validation.Errors, validationError...)
+	}
+
+	return validation
+}
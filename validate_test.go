@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+)
+
+func testValidateConfigJson(t *testing.T, config string) ValidationResult {
+	input := testAllocateStringBuffer(t, config)
+	output := cobhan.AllocateBuffer(4096)
+	if result := ValidateConfigJson(cobhan.Ptr(&input), cobhan.Ptr(&output)); result != cobhan.ERR_NONE {
+		t.Fatalf("ValidateConfigJson returned %v", result)
+	}
+
+	var validation ValidationResult
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&output), &validation); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	return validation
+}
+
+func TestValidateConfigJsonValid(t *testing.T) {
+	validation := testValidateConfigJson(t, `{"ServiceName":"s","ProductID":"p","Metastore":"memory","KMS":"static"}`)
+	if !validation.Valid || len(validation.Errors) != 0 {
+		t.Errorf("Expected a valid config got %+v", validation)
+	}
+}
+
+func TestValidateConfigJsonFieldErrors(t *testing.T) {
+	validation := testValidateConfigJson(t, `{"ServiceName":"s","ProductID":"p","Metastore":"rdbms","KMS":"static"}`)
+	if validation.Valid || len(validation.Errors) != 1 || validation.Errors[0].Field != "ConnectionString" {
+		t.Errorf("Expected a ConnectionString error got %+v", validation)
+	}
+}
+
+func TestValidateConfigJsonTypeError(t *testing.T) {
+	validation := testValidateConfigJson(t, `{"ServiceName":"s","SessionCacheMaxSize":"lots"}`)
+	if validation.Valid || len(validation.Errors) != 1 || validation.Errors[0].Field != "SessionCacheMaxSize" {
+		t.Errorf("Expected a SessionCacheMaxSize error got %+v", validation)
+	}
+}
+
+func TestValidateConfigJsonMalformed(t *testing.T) {
+	validation := testValidateConfigJson(t, `{"ServiceName":`)
+	if validation.Valid || len(validation.Errors) != 1 || validation.Errors[0].Message == "" {
+		t.Errorf("Expected a JSON error got %+v", validation)
+	}
+}
+
+func TestSetupJsonRejectsInvalidConfig(t *testing.T) {
+	config := testAllocateStringBuffer(t, `{"ServiceName":"s","ProductID":"p","Metastore":"memory"}`)
+	if result := SetupJson(cobhan.Ptr(&config)); result != ERR_BAD_CONFIG {
+		if result == cobhan.ERR_NONE {
+			Shutdown()
+		}
+		t.Errorf("Expected ERR_BAD_CONFIG for aws KMS without RegionMap got %v", result)
+	}
+}
+
+func TestValidateConfigJsonAmbiguousDuration(t *testing.T) {
+	validation := testValidateConfigJson(t, `{"ServiceName":"s","ProductID":"p","Metastore":"memory","KMS":"static","ExpireAfter":"90"}`)
+	if validation.Valid || len(validation.Errors) != 1 || validation.Errors[0].Field != "ExpireAfter" {
+		t.Errorf("Expected an ExpireAfter error got %+v", validation)
+	}
+}
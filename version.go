@@ -0,0 +1,233 @@
+package main
+
+import (
+	"C"
+)
+import (
+	"runtime"
+	"runtime/debug"
+	"unsafe"
+
+	"github.com/godaddy/cobhan-go"
+
+	"github.com/godaddy/asherah-cobhan/internal/asherah"
+)
+
+// Version is the release of this library. Release builds set it with
+// -ldflags "-X main.Version=<version>"; otherwise it comes from the module build info.
+var Version = ""
+
+// dependencyModules are the modules whose versions GetVersionJson reports, keyed by the name used in
+// the report.
+var dependencyModules = map[string]string{
+	"appencryption": "github.com/godaddy/asherah/go/appencryption",
+	"securememory":  "github.com/godaddy/asherah/go/securememory",
+	"cobhan-go":     "github.com/godaddy/cobhan-go",
+}
+
+// features names each capability a wrapper may probe for with GetVersionJson. Add a feature
+// whenever exports or options are added, and never rename one.
+var features = []string{
+	"instances",            // CreateInstance, DestroyInstance and the ...WithInstance exports
+	"batch",                // EncryptBatchToJson, DecryptBatchFromJson
+	"streaming",            // EncryptStream*, DecryptStream*, AbortStream
+	"timeouts",             // OperationTimeout and the ...WithTimeout exports
+	"last-error",           // GetLastErrorJson, ClearLastError
+	"log-callback",         // SetLogCallback
+	"log-level",            // LogLevel and LogFormat options
+	"metrics",              // EnableMetrics, GetMetricsJson
+	"prometheus",           // MetricsListenAddress
+	"tracing",              // TracingEndpoint and the ...WithTraceparent exports
+	"health-check",         // HealthCheck
+	"validate-config",      // ValidateConfigJson
+	"setup-from-env",       // SetupFromEnv, SetupFromEnvAndJson
+	"duration-strings",     // "90d" style durations and ...Seconds duration fields
+	"setup-from-file",      // SetupFromFile
+	"reconfigure",          // ReconfigureJson
+	"config-introspection", // GetConfigJson
+	"version",              // GetVersionJson
+	"rotate-keys",          // RotateKeys
+	"revoke-key",           // RevokeKey
+	"reencrypt",            // Reencrypt, ReencryptBatch
+	"inspect-drr",          // InspectDataRowRecord
+	"list-keys",            // ListKeys
+	"migrate-keys",         // MigrateKeys
+}
+
+// exports lists every function exported by this library. A test keeps it in sync with the
+// //export directives.
+var exports = []string{
+	"AbortStream",
+	"ClearLastError",
+	"CreateInstance",
+	"Decrypt",
+	"DecryptBatchFromJson",
+	"DecryptBatchFromJsonWithInstance",
+	"DecryptFromJson",
+	"DecryptFromJsonWithInstance",
+	"DecryptFromJsonWithTimeout",
+	"DecryptFromJsonWithTraceparent",
+	"DecryptStreamBegin",
+	"DecryptStreamBeginWithInstance",
+	"DecryptStreamFinish",
+	"DecryptStreamUpdate",
+	"DecryptWithInstance",
+	"DestroyInstance",
+	"Encrypt",
+	"EncryptBatchToJson",
+	"EncryptBatchToJsonWithInstance",
+	"EncryptStreamBegin",
+	"EncryptStreamBeginWithInstance",
+	"EncryptStreamFinish",
+	"EncryptStreamUpdate",
+	"EncryptToJson",
+	"EncryptToJsonWithInstance",
+	"EncryptToJsonWithTimeout",
+	"EncryptToJsonWithTraceparent",
+	"EncryptWithInstance",
+	"EstimateBuffer",
+	"EstimateStreamChunkBuffer",
+	"EstimateStreamHeaderBuffer",
+	"GetConfigJson",
+	"GetConfigJsonWithInstance",
+	"GetLastErrorJson",
+	"GetMetricsJson",
+	"GetVersionJson",
+	"HealthCheck",
+	"HealthCheckWithInstance",
+	"InspectDataRowRecord",
+	"InspectDataRowRecordWithInstance",
+	"ListKeys",
+	"ListKeysWithInstance",
+	"MigrateKeys",
+	"ReconfigureJson",
+	"ReconfigureJsonWithInstance",
+	"Reencrypt",
+	"ReencryptBatch",
+	"ReencryptBatchWithInstance",
+	"ReencryptWithInstance",
+	"RevokeKey",
+	"RevokeKeyWithInstance",
+	"RotateKeys",
+	"RotateKeysWithInstance",
+	"SetEnv",
+	"SetLogCallback",
+	"SetupFromEnv",
+	"SetupFromEnvAndJson",
+	"SetupFromFile",
+	"SetupJson",
+	"Shutdown",
+	"ValidateConfigJson",
+}
+
+// VersionResult is written by GetVersionJson.
+type VersionResult struct {
+	BuildInfo
+	Dependencies map[string]string `json:"Dependencies"`
+	Metastores   []string          `json:"Metastores"`
+	KMS          []string          `json:"KMS"`
+	SQLDrivers   []string          `json:"SQLDrivers"`
+	Features     []string          `json:"Features"`
+	Exports      []string          `json:"Exports"`
+}
+
+// BuildInfo describes the binary, as reported by GetConfigJson and GetVersionJson.
+type BuildInfo struct {
+	Version    string `json:"Version"`
+	GoVersion  string `json:"GoVersion"`
+	OS         string `json:"OS"`
+	Arch       string `json:"Arch"`
+	Commit     string `json:"Commit,omitempty"`
+	CommitTime string `json:"CommitTime,omitempty"`
+	Modified   bool   `json:"Modified,omitempty"`
+	CGO        bool   `json:"CGO"`
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "unknown"
+		}
+		return info
+	}
+
+	if info.Version == "" {
+		info.Version = build.Main.Version
+	}
+
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		case "CGO_ENABLED":
+			info.CGO = setting.Value == "1"
+		}
+	}
+
+	return info
+}
+
+func dependencyVersions() map[string]string {
+	versions := map[string]string{}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return versions
+	}
+
+	for _, dep := range build.Deps {
+		for name, path := range dependencyModules {
+			if dep.Path == path {
+				versions[name] = dep.Version
+			}
+		}
+	}
+
+	return versions
+}
+
+/*
+  GetVersionJson writes the library version, git commit, Go version, the versions of the Asherah
+  and cobhan-go modules it was built with, the supported Metastore and KMS values, the
+  SQLMetastoreDBType values whose driver is built in, the feature names and every function the
+  library exports. It needs no Setup, so wrappers can call it right after loading the library to
+  check for the features they use. Builds without a version stamp report the Go module version,
+  typically "(devel)".
+*/
+//export GetVersionJson
+func GetVersionJson(outputJsonPtr unsafe.Pointer) (result int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = reportError(ERR_PANIC, "GetVersionJson: Panic: %v", r)
+		}
+	}()
+
+	version := VersionResult{
+		BuildInfo:    buildInfo(),
+		Dependencies: dependencyVersions(),
+		Metastores:   asherah.Choices("Metastore"),
+		KMS:          asherah.Choices("KMS"),
+		SQLDrivers:   asherah.SupportedSQLMetastoreDBTypes(),
+		Features:     features,
+		Exports:      exports,
+	}
+
+	result = cobhan.JsonToBuffer(&version, outputJsonPtr)
+	if result != cobhan.ERR_NONE {
+		return reportError(result, "GetVersionJson failed: JsonToBuffer returned %v for outputJsonPtr", cobhan.CobhanErrorToString(result))
+	}
+
+	return cobhan.ERR_NONE
+}
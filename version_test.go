@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/godaddy/cobhan-go"
+)
+
+func TestGetVersionJson(t *testing.T) {
+	buf := cobhan.AllocateBuffer(8192)
+	if result := GetVersionJson(cobhan.Ptr(&buf)); result != cobhan.ERR_NONE {
+		t.Fatalf("GetVersionJson returned %v", result)
+	}
+
+	var version VersionResult
+	if result := cobhan.BufferToJsonStruct(cobhan.Ptr(&buf), &version); result != cobhan.ERR_NONE {
+		t.Fatalf("BufferToJsonStruct returned %v", result)
+	}
+
+	if version.GoVersion != runtime.Version() {
+		t.Errorf("Expected GoVersion %v got %v", runtime.Version(), version.GoVersion)
+	}
+	if !slices.Equal(version.Metastores, []string{"rdbms", "dynamodb", "memory"}) || !slices.Equal(version.KMS, []string{"aws", "static"}) {
+		t.Errorf("Unexpected metastores %v or KMS %v", version.Metastores, version.KMS)
+	}
+	if !slices.Contains(version.SQLDrivers, "mysql") || !slices.Contains(version.SQLDrivers, "postgres") || slices.Contains(version.SQLDrivers, "oracle") {
+		t.Errorf("Unexpected SQL drivers %v", version.SQLDrivers)
+	}
+	if !slices.Contains(version.Features, "version") || !slices.Contains(version.Exports, "GetVersionJson") {
+		t.Errorf("Expected the version feature and export got %v %v", version.Features, version.Exports)
+	}
+}
+
+func TestExportsMatchDirectives(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatalf("Glob returned %v", err)
+	}
+
+	directive := regexp.MustCompile(`(?m)^//export (\w+)$`)
+	var found []string
+	for _, file := range files {
+		if file == "go_warmup.go" {
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile returned %v", err)
+		}
+		for _, match := range directive.FindAllStringSubmatch(string(source), -1) {
+			found = append(found, match[1])
+		}
+	}
+	slices.Sort(found)
+
+	if !slices.Equal(found, exports) {
+		t.Errorf("exports is out of date:\n got  %v\n want %v", exports, found)
+	}
+}